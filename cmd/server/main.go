@@ -11,7 +11,11 @@ import (
 func main() {
 	cfg := config.Load()
 
-	srv := server.New(cfg)
+	srv, err := server.New(cfg)
+	if err != nil {
+		log.Printf("Server failed to initialize: %v", err)
+		os.Exit(1)
+	}
 
 	if err := srv.Start(); err != nil {
 		log.Printf("Server failed to start: %v", err)
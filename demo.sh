@@ -29,14 +29,23 @@ else
     echo -e "Result: ${RED}FAILED ($HTTP_CODE)${NC}"
 fi
 
-# 3. Use Test Door to get Admin Key
-echo -e "\n${GREEN}3. bootstrapping Admin Credentials${NC}"
-ADMIN_KEY=$(curl -s -H "X-Timestamp: $TIMESTAMP" "$BASE_URL/api/test/generate-key?user_id=admin")
-echo -e "Generated Temporary Admin Key: ${GREEN}${ADMIN_KEY:0:10}...${NC}"
+# 3. Admin Credentials
+# Start the server with BOOTSTRAP_ADMINS=admin; at first startup it writes the
+# admin's API key to bootstrap-admin-admin.key in BOOTSTRAP_KEY_DIR (default: its working directory).
+echo -e "\n${GREEN}3. Using Bootstrap Admin Credentials${NC}"
+if [ -z "$ADMIN_KEY" ] && [ -r "${BOOTSTRAP_KEY_DIR:-.}/bootstrap-admin-admin.key" ]; then
+    ADMIN_KEY=$(cat "${BOOTSTRAP_KEY_DIR:-.}/bootstrap-admin-admin.key")
+fi
+if [ -z "$ADMIN_KEY" ]; then
+    echo -e "${RED}Set ADMIN_KEY, or BOOTSTRAP_KEY_DIR to where the server wrote bootstrap-admin-admin.key (BOOTSTRAP_ADMINS=admin).${NC}"
+    exit 1
+fi
+echo -e "Using Admin Key: ${GREEN}${ADMIN_KEY:0:10}...${NC}"
 
 # 4. Create User Key
 echo -e "\n${GREEN}4. Provisioning New User Identity${NC}"
 TIMESTAMP=$(date +%s)
+curl -s -o /dev/null -H "X-API-Key: $ADMIN_KEY" -H "X-Timestamp: $TIMESTAMP" -H "Content-Type: application/json" -d '{"id": "demo-user", "username": "demo-user"}' "$BASE_URL/api/admin/users"
 RESP=$(curl -s -H "X-API-Key: $ADMIN_KEY" -H "X-Timestamp: $TIMESTAMP" -H "Content-Type: application/json" -d '{"user_id": "demo-user", "name": "demo-key"}' "$BASE_URL/api/admin/keys/create")
 USER_KEY=$(echo $RESP | jq -r '.api_key')
 echo -e "Created Key for 'demo-user': ${GREEN}${USER_KEY:0:10}...${NC}"
@@ -0,0 +1,129 @@
+package adaptive
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/raakeshmj/apigatewayplane/internal/metrics"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+)
+
+// AIMD steps, applied once per interval
+const (
+	increaseStep  = 0.05 // Added to the factor while healthy
+	decreaseRatio = 0.8  // Multiplies the factor while unhealthy
+)
+
+// Source provides the health signals and takes the resulting gauges;
+// metrics.MetricsCollector is one
+type Source interface {
+	Recent(policyID string, window time.Duration) metrics.Signals
+	SetGauge(name string, value float64)
+	DeleteGauge(name string)
+}
+
+// Controller keeps a factor per adaptive policy that scales its rate limits.
+// Each step it reads p99 latency and the 5xx rate of the upstream's recent
+// responses to that policy's requests: if either is above the policy's
+// target the factor backs off, otherwise it grows back towards the policy's
+// maximum.
+type Controller struct {
+	source Source
+	window time.Duration // How far back signals look
+
+	mu      sync.RWMutex
+	factors map[string]float64 // By policy ID
+}
+
+func New(source Source, window time.Duration) *Controller {
+	return &Controller{source: source, window: window, factors: make(map[string]float64)}
+}
+
+// Run steps the controller every interval over the current policies until ctx is cancelled
+func (c *Controller) Run(ctx context.Context, interval time.Duration, policies func() []policy.Policy) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Step(policies())
+		}
+	}
+}
+
+// Step adjusts every adaptive policy's factor once
+func (c *Controller) Step(policies []policy.Policy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		a := p.Rules.Adaptive
+		if a == nil {
+			continue
+		}
+		seen[p.ID] = true
+		lo, hi := a.Bounds()
+		sig := c.source.Recent(p.ID, c.window)
+
+		f, ok := c.factors[p.ID]
+		if !ok {
+			f = math.Min(1, hi)
+		}
+		unhealthy := (a.TargetP99Ms > 0 && sig.P99 > time.Duration(a.TargetP99Ms)*time.Millisecond) ||
+			(a.MaxErrorRate > 0 && sig.ErrorRate > a.MaxErrorRate)
+		next := f + increaseStep
+		if unhealthy {
+			next = f * decreaseRatio
+		}
+		next = math.Max(lo, math.Min(hi, next))
+
+		if next < f {
+			log.Printf("adaptive: tightening %s to %.2f of its limits (p99 %v, error rate %.3f)", p.ID, next, sig.P99, sig.ErrorRate)
+		}
+		c.factors[p.ID] = next
+		c.source.SetGauge("ratelimit_adaptive_factor:"+p.ID, next)
+		c.source.SetGauge("ratelimit_effective_rate:"+p.ID, p.Rules.RateLimit*next)
+	}
+
+	// Forget policies that were removed or stopped adapting
+	for id := range c.factors {
+		if !seen[id] {
+			delete(c.factors, id)
+			c.source.DeleteGauge("ratelimit_adaptive_factor:" + id)
+			c.source.DeleteGauge("ratelimit_effective_rate:" + id)
+		}
+	}
+}
+
+// Factor returns the current factor for a policy; 1 if it isn't adaptive
+func (c *Controller) Factor(p *policy.Policy) float64 {
+	if p == nil || p.Rules.Adaptive == nil {
+		return 1
+	}
+	c.mu.RLock()
+	f, ok := c.factors[p.ID]
+	c.mu.RUnlock()
+	if !ok {
+		_, hi := p.Rules.Adaptive.Bounds()
+		return math.Min(1, hi)
+	}
+	return f
+}
+
+// Adjust scales a limit of policy p by its current factor, keeping a burst of at least one
+func (c *Controller) Adjust(p *policy.Policy, l limiter.Limit) limiter.Limit {
+	f := c.Factor(p)
+	if f == 1 {
+		return l
+	}
+	l.Rate *= f
+	l.Burst = int(math.Max(1, math.Round(float64(l.Burst)*f)))
+	return l
+}
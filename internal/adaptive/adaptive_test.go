@@ -0,0 +1,97 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/raakeshmj/apigatewayplane/internal/metrics"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+)
+
+type fakeSource struct {
+	signals metrics.Signals            // For policies without their own
+	byID    map[string]metrics.Signals // By policy ID
+	gauges  map[string]float64
+}
+
+func (f *fakeSource) Recent(policyID string, _ time.Duration) metrics.Signals {
+	if sig, ok := f.byID[policyID]; ok {
+		return sig
+	}
+	return f.signals
+}
+func (f *fakeSource) SetGauge(name string, v float64) { f.gauges[name] = v }
+func (f *fakeSource) DeleteGauge(name string)         { delete(f.gauges, name) }
+
+func TestController_AIMD(t *testing.T) {
+	src := &fakeSource{gauges: map[string]float64{}}
+	c := New(src, 10*time.Second)
+	p := policy.Policy{ID: "api", Rules: policy.Rules{RateLimit: 100, Burst: 50, Adaptive: &policy.AdaptiveRule{
+		TargetP99Ms: 200, MaxErrorRate: 0.05, MinFactor: 0.25,
+	}}}
+	policies := []policy.Policy{p}
+
+	// Slow upstream: back off multiplicatively down to the floor
+	src.signals = metrics.Signals{Samples: 100, P99: time.Second}
+	c.Step(policies)
+	if f := c.Factor(&p); f != decreaseRatio {
+		t.Fatalf("Expected factor %.2f, got %.2f", decreaseRatio, f)
+	}
+	for i := 0; i < 20; i++ {
+		c.Step(policies)
+	}
+	if f := c.Factor(&p); f != 0.25 {
+		t.Fatalf("Expected factor held at min 0.25, got %.2f", f)
+	}
+	if got := c.Adjust(&p, limiter.Limit{Rate: 100, Burst: 50}); got.Rate != 25 || got.Burst != 13 {
+		t.Errorf("Expected rate 25 burst 13, got %+v", got)
+	}
+	if src.gauges["ratelimit_effective_rate:api"] != 25 {
+		t.Errorf("Expected effective rate gauge 25, got %v", src.gauges)
+	}
+
+	// Errors alone also count as unhealthy
+	src.signals = metrics.Signals{Samples: 100, P99: time.Millisecond, ErrorRate: 0.2}
+	c.Step(policies)
+	if f := c.Factor(&p); f != 0.25 {
+		t.Fatalf("Expected factor to stay at min, got %.2f", f)
+	}
+
+	// Recovery: grow back additively, never past the max
+	src.signals = metrics.Signals{Samples: 100, P99: 50 * time.Millisecond}
+	c.Step(policies)
+	if f := c.Factor(&p); f != 0.25+increaseStep {
+		t.Fatalf("Expected factor %.2f, got %.2f", 0.25+increaseStep, f)
+	}
+	for i := 0; i < 50; i++ {
+		c.Step(policies)
+	}
+	if f := c.Factor(&p); f != 1 {
+		t.Fatalf("Expected factor back at 1, got %.2f", f)
+	}
+
+	// Removed policies are forgotten
+	c.Step(nil)
+	if _, ok := src.gauges["ratelimit_adaptive_factor:api"]; ok {
+		t.Error("Expected gauge of removed policy to be dropped")
+	}
+}
+
+func TestController_PerPolicySignals(t *testing.T) {
+	slow := metrics.Signals{Samples: 100, P99: time.Second}
+	src := &fakeSource{byID: map[string]metrics.Signals{"reports": slow}, gauges: map[string]float64{}}
+	c := New(src, 10*time.Second)
+	rule := &policy.AdaptiveRule{TargetP99Ms: 200, MaxFactor: 2}
+	reports := policy.Policy{ID: "reports", Rules: policy.Rules{RateLimit: 10, Adaptive: rule}}
+	orders := policy.Policy{ID: "orders", Rules: policy.Rules{RateLimit: 10, Adaptive: rule}}
+
+	// A slow upstream behind one policy doesn't tighten another's limits
+	c.Step([]policy.Policy{reports, orders})
+	if f := c.Factor(&reports); f != decreaseRatio {
+		t.Errorf("Expected reports at %.2f, got %.2f", decreaseRatio, f)
+	}
+	if f := c.Factor(&orders); f != 1+increaseStep {
+		t.Errorf("Expected orders at %.2f, got %.2f", 1+increaseStep, f)
+	}
+}
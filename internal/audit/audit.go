@@ -11,13 +11,14 @@ import (
 
 // LogEntry defines the structured audit log
 type LogEntry struct {
-	Timestamp time.Time              `json:"timestamp"`
-	TenantID  string                 `json:"tenant_id,omitempty"` // For Multi-tenancy
-	ActorID   string                 `json:"actor_id"`
-	Action    string                 `json:"action"`   // method + path
-	Resource  string                 `json:"resource"` // Path
-	Status    int                    `json:"status"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+	TenantID   string                 `json:"tenant_id,omitempty"` // For Multi-tenancy
+	ActorID    string                 `json:"actor_id"`
+	OnBehalfOf string                 `json:"on_behalf_of,omitempty"` // User a delegated actor acted for
+	Action     string                 `json:"action"`                 // method + path
+	Resource   string                 `json:"resource"`               // Path
+	Status     int                    `json:"status"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // Logger interface
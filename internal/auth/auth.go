@@ -16,12 +16,24 @@ import (
 var (
 	ErrInvalidToken = errors.New("invalid token")
 	ErrExpiredToken = errors.New("token has expired")
+	ErrUnknownUser  = errors.New("user does not exist")
+	ErrUserDisabled = errors.New("user is disabled")
 )
 
 type TokenClaims struct {
-	UserID string   `json:"user_id"`
-	Scopes []string `json:"scopes"`
+	UserID   string      `json:"user_id"`
+	TenantID string      `json:"tenant_id,omitempty"` // Empty means DefaultTenant
+	Scopes   []string    `json:"scopes"`
+	Actor    *ActorClaim `json:"act,omitempty"` // Set on delegated tokens (RFC 8693)
 	jwt.RegisteredClaims
+
+	// Every claim in the token, including ones without a field above
+	All jwt.MapClaims `json:"-"`
+}
+
+// ActorClaim identifies the party acting on behalf of the token's user
+type ActorClaim struct {
+	Subject string `json:"sub"`
 }
 
 // Password Hashing (Bcrypt)
@@ -44,7 +56,7 @@ func GenerateAPIKey() (string, string, string, error) {
 	}
 
 	rawKey := base64.URLEncoding.EncodeToString(bytes)
-	prefix := rawKey[:7] // Store first 7 chars for identification logic
+	prefix := KeyPrefix(rawKey) // Store first chars for identification logic
 
 	// Hash the raw key for storage
 	hash := sha256.Sum256([]byte(rawKey))
@@ -53,6 +65,14 @@ func GenerateAPIKey() (string, string, string, error) {
 	return rawKey, keyHash, prefix, nil
 }
 
+// KeyPrefix returns the identifying prefix of a raw key (first 7 chars)
+func KeyPrefix(rawKey string) string {
+	if len(rawKey) < 7 {
+		return rawKey
+	}
+	return rawKey[:7]
+}
+
 // HashAPIKey returns the SHA256 hash of the raw key
 func HashAPIKey(rawKey string) string {
 	hash := sha256.Sum256([]byte(rawKey))
@@ -88,6 +108,27 @@ func (m *JWTManager) Generate(userID string, scopes []string) (string, error) {
 	return token.SignedString([]byte(m.secretKey))
 }
 
+// GenerateDelegated issues a short-lived token for userID in tenantID on which
+// actorID is recorded as the acting party
+func (m *JWTManager) GenerateDelegated(userID, tenantID, actorID string, scopes []string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := TokenClaims{
+		UserID:   userID,
+		TenantID: tenantID,
+		Scopes:   scopes,
+		Actor:    &ActorClaim{Subject: actorID},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "api-control-plane",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(m.secretKey))
+}
+
 func (m *JWTManager) Verify(tokenStr string) (*TokenClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -105,5 +146,11 @@ func (m *JWTManager) Verify(tokenStr string) (*TokenClaims, error) {
 		return nil, ErrInvalidToken
 	}
 
+	// The signature was checked above, so reading the rest as a map is safe
+	claims.All = jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenStr, claims.All); err != nil {
+		return nil, ErrInvalidToken
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+)
+
+var (
+	ErrUnmappedCertificate = errors.New("client certificate does not map to a principal")
+)
+
+// CertRule maps a certificate identity to a principal.
+// Match is a path.Match pattern against one of the identities returned by
+// CertIdentities, e.g. "spiffe://prod.example.org/ns/billing/sa/*" or "dns:*.internal".
+type CertRule struct {
+	Match     string   `json:"match"`
+	Principal string   `json:"principal,omitempty"` // Defaults to the matched identity
+	Type      string   `json:"type,omitempty"`      // Defaults to "service"
+	Tenant    string   `json:"tenant,omitempty"`    // Defaults to DefaultTenant
+	Scopes    []string `json:"scopes,omitempty"`
+}
+
+// CertMapper resolves verified client certificates to principals
+type CertMapper struct {
+	rules []CertRule
+}
+
+// NewCertMapper creates a mapper. With no rules, the certificate's SPIFFE ID
+// (or subject CN) becomes the principal ID and no scopes are granted.
+func NewCertMapper(rules []CertRule) *CertMapper {
+	return &CertMapper{rules: rules}
+}
+
+// LoadCertRules reads a JSON array of CertRule from path
+func LoadCertRules(file string) ([]CertRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []CertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Map returns the principal for the leaf certificate of a verified chain
+func (m *CertMapper) Map(cert *x509.Certificate) (*Principal, error) {
+	ids := CertIdentities(cert)
+	if len(ids) == 0 {
+		return nil, ErrUnmappedCertificate
+	}
+
+	if len(m.rules) == 0 {
+		return &Principal{ID: defaultIdentity(cert), Type: PrincipalService, Method: MethodClientCert}, nil
+	}
+
+	// First matching rule wins (ordered list, like the policy engine)
+	for _, rule := range m.rules {
+		for _, id := range ids {
+			if ok, _ := path.Match(rule.Match, id); !ok {
+				continue
+			}
+			p := &Principal{
+				ID:       rule.Principal,
+				Type:     rule.Type,
+				Scopes:   rule.Scopes,
+				Method:   MethodClientCert,
+				TenantID: rule.Tenant,
+			}
+			if p.ID == "" {
+				p.ID = id
+			}
+			if p.Type == "" {
+				p.Type = PrincipalService
+			}
+			return p, nil
+		}
+	}
+
+	return nil, ErrUnmappedCertificate
+}
+
+// CertIdentities lists the identities carried by a certificate, most specific first:
+// URI SANs (SPIFFE IDs included) as-is, then "dns:<name>", "email:<addr>" and "cn:<subject CN>".
+func CertIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	for _, d := range cert.DNSNames {
+		ids = append(ids, "dns:"+d)
+	}
+	for _, e := range cert.EmailAddresses {
+		ids = append(ids, "email:"+e)
+	}
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, "cn:"+cert.Subject.CommonName)
+	}
+	return ids
+}
+
+// SPIFFEID returns the certificate's SPIFFE ID, if it has one
+func SPIFFEID(cert *x509.Certificate) string {
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+func defaultIdentity(cert *x509.Certificate) string {
+	if id := SPIFFEID(cert); id != "" {
+		return id
+	}
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return CertIdentities(cert)[0]
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testCert(t *testing.T, cn string, uris ...string) *x509.Certificate {
+	t.Helper()
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	for _, raw := range uris {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert.URIs = append(cert.URIs, u)
+	}
+	return cert
+}
+
+func TestCertMapper_Rules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.json")
+	err := os.WriteFile(file, []byte(`[
+		{"match": "spiffe://prod.example.org/ns/billing/sa/*", "principal": "billing", "tenant": "acme", "scopes": ["invoices:read"]},
+		{"match": "cn:*.internal"}
+	]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadCertRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewCertMapper(rules)
+
+	p, err := m.Map(testCert(t, "worker", "spiffe://prod.example.org/ns/billing/sa/worker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "billing" || p.TenantID != "acme" || p.Type != PrincipalService || p.Method != MethodClientCert {
+		t.Fatalf("Unexpected principal %+v", p)
+	}
+	if len(p.Scopes) != 1 || p.Scopes[0] != "invoices:read" {
+		t.Fatalf("Expected the rule's scopes, got %v", p.Scopes)
+	}
+
+	// Without a principal the matched identity is the ID
+	p, err = m.Map(testCert(t, "cache.internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "cn:cache.internal" || len(p.Scopes) != 0 {
+		t.Fatalf("Unexpected principal %+v", p)
+	}
+
+	// Nothing matches
+	if _, err := m.Map(testCert(t, "intruder", "spiffe://evil.example.org/ns/billing/sa/worker")); !errors.Is(err, ErrUnmappedCertificate) {
+		t.Fatalf("Expected ErrUnmappedCertificate, got %v", err)
+	}
+	if _, err := m.Map(&x509.Certificate{}); !errors.Is(err, ErrUnmappedCertificate) {
+		t.Fatalf("Expected a certificate without identities to be rejected, got %v", err)
+	}
+}
+
+func TestCertMapper_NoRules(t *testing.T) {
+	m := NewCertMapper(nil)
+
+	p, err := m.Map(testCert(t, "worker", "spiffe://prod.example.org/ns/billing/sa/worker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "spiffe://prod.example.org/ns/billing/sa/worker" || len(p.Scopes) != 0 {
+		t.Fatalf("Expected the SPIFFE ID without scopes, got %+v", p)
+	}
+
+	p, err = m.Map(testCert(t, "worker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "worker" {
+		t.Fatalf("Expected the subject CN, got %+v", p)
+	}
+}
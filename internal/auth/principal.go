@@ -0,0 +1,71 @@
+package auth
+
+import "strconv"
+
+// Authentication methods recorded on a Principal
+const (
+	MethodJWT        = "jwt"
+	MethodAPIKey     = "api_key"
+	MethodClientCert = "client_cert"
+)
+
+// Principal types
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
+// DefaultTenant is the operator's tenant; principals without a tenant belong to it
+const DefaultTenant = "default"
+
+// ScopeTokenExchange lets a service account obtain delegated tokens for users
+const ScopeTokenExchange = "token:exchange"
+
+// Principal is the authenticated identity behind a request
+type Principal struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Scopes   []string `json:"scopes,omitempty"`
+	Method   string   `json:"method"`
+	ActorID  string   `json:"actor_id,omitempty"` // Service acting on behalf of ID (delegated tokens)
+	TenantID string   `json:"tenant_id,omitempty"`
+	KeyID    string   `json:"key_id,omitempty"` // The API key used, for MethodAPIKey
+
+	Claims map[string]interface{} `json:"-"` // The verified token's claims, for MethodJWT
+}
+
+// Tenant returns the principal's tenant, DefaultTenant if unset
+func (p *Principal) Tenant() string {
+	return TenantOrDefault(p.TenantID)
+}
+
+// TenantOrDefault maps an unset tenant ID to DefaultTenant
+func TenantOrDefault(tenantID string) string {
+	if tenantID == "" {
+		return DefaultTenant
+	}
+	return tenantID
+}
+
+// Claim returns a token claim as a string, empty if absent or not a scalar
+func (p *Principal) Claim(name string) string {
+	switch v := p.Claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
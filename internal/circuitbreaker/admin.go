@@ -0,0 +1,167 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrUnknownBreaker = errors.New("unknown circuit breaker")
+	ErrNameRequired   = errors.New("circuit breaker name is required")
+)
+
+// Status is a breaker as operators see it
+type Status struct {
+	Name         string       `json:"name"`
+	State        string       `json:"state"`
+	Since        time.Time    `json:"since,omitempty"`           // When it entered the state
+	HalfOpenAt   *time.Time   `json:"half_open_at,omitempty"`    // When an open breaker starts probing
+	HalfOpenInMs int64        `json:"half_open_in_ms,omitempty"` // How long until then
+	Failures     int64        `json:"consecutive_failures"`
+	Successes    int64        `json:"probe_successes"`
+	Probes       int64        `json:"probes_in_flight"`
+	Window       *WindowStats `json:"window,omitempty"` // Sliding window counts while closed
+}
+
+// WindowStats counts a sliding window's calls
+type WindowStats struct {
+	Type   WindowType `json:"type"`
+	Size   int64      `json:"size"`
+	Calls  int64      `json:"calls"`
+	Failed int64      `json:"failed"`
+	Slow   int64      `json:"slow"`
+}
+
+// List returns every breaker that has been used or set by hand, by name
+func (cb *CircuitBreaker) List(ctx context.Context) ([]Status, error) {
+	names, err := cb.client.SMembers(ctx, registryKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	list := make([]Status, 0, len(names))
+	for _, name := range names {
+		st, err := cb.status(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, st)
+	}
+	return list, nil
+}
+
+// Status returns one breaker
+func (cb *CircuitBreaker) Status(ctx context.Context, name string) (Status, error) {
+	known, err := cb.client.SIsMember(ctx, registryKey, name).Result()
+	if err != nil {
+		return Status{}, err
+	}
+	if !known {
+		return Status{}, ErrUnknownBreaker
+	}
+	return cb.status(ctx, name)
+}
+
+func (cb *CircuitBreaker) status(ctx context.Context, name string) (Status, error) {
+	keys := breakerKeys(name)
+	now, err := cb.client.Time(ctx).Result()
+	if err != nil {
+		return Status{}, err
+	}
+	h, err := cb.client.HGetAll(ctx, keys[0]).Result()
+	if err != nil {
+		return Status{}, err
+	}
+	w, err := cb.client.HGetAll(ctx, keys[1]).Result()
+	if err != nil {
+		return Status{}, err
+	}
+
+	state := State(field(h, "state"))
+	st := Status{
+		Name:      name,
+		State:     state.String(),
+		Failures:  field(h, "failures"),
+		Successes: field(h, "successes"),
+		Probes:    field(h, "probes"),
+	}
+	if since := field(h, "since"); since > 0 {
+		st.Since = time.UnixMilli(since)
+	}
+	if until := field(h, "until"); state == StateOpen && until > 0 {
+		at := time.UnixMilli(until)
+		st.HalfOpenAt = &at
+		st.HalfOpenInMs = max(0, at.Sub(now).Milliseconds())
+	}
+	if state == StateClosed && len(w) > 0 {
+		st.Window = windowStats(w, now)
+	}
+	return st, nil
+}
+
+// windowStats sums a window hash as recordScript lays it out
+func windowStats(w map[string]string, now time.Time) *WindowStats {
+	ws := &WindowStats{Size: field(w, "size")}
+	if field(w, "window") == 1 {
+		ws.Type = WindowCount
+		ws.Calls, ws.Failed, ws.Slow = field(w, "calls"), field(w, "failed"), field(w, "slow")
+		return ws
+	}
+	ws.Type = WindowTime
+	sec := now.Unix()
+	for i := int64(0); i < ws.Size; i++ {
+		idx := strconv.FormatInt(i, 10)
+		if b, ok := w["b"+idx]; ok {
+			if at, _ := strconv.ParseInt(b, 10, 64); sec-at < ws.Size {
+				ws.Calls += field(w, "t"+idx)
+				ws.Failed += field(w, "f"+idx)
+				ws.Slow += field(w, "s"+idx)
+			}
+		}
+	}
+	return ws
+}
+
+func field(h map[string]string, name string) int64 {
+	v, _ := strconv.ParseInt(h[name], 10, 64)
+	return v
+}
+
+// Operators can only act on breakers that have been used, so a misspelled
+// name fails with ErrUnknownBreaker instead of creating a breaker nothing uses.
+
+// ForceOpen rejects every call through the breaker until it is closed or reset
+func (cb *CircuitBreaker) ForceOpen(ctx context.Context, name string) error {
+	return cb.set(ctx, name, StateForcedOpen, "forced_open")
+}
+
+// ForceClose admits every call through the breaker, without counting, until it is reset
+func (cb *CircuitBreaker) ForceClose(ctx context.Context, name string) error {
+	return cb.set(ctx, name, StateForcedClosed, "forced_closed")
+}
+
+// Reset closes the breaker and clears its counters and window
+func (cb *CircuitBreaker) Reset(ctx context.Context, name string) error {
+	return cb.set(ctx, name, StateClosed, "reset")
+}
+
+func (cb *CircuitBreaker) set(ctx context.Context, name string, to State, reason string) error {
+	if name == "" {
+		return ErrNameRequired
+	}
+	keys := append(breakerKeys(name), registryKey)
+	from, err := setStateScript.Run(ctx, cb.client, keys, int(to), name).Int64()
+	if err != nil {
+		return err
+	}
+	if from < 0 {
+		return ErrUnknownBreaker
+	}
+	cb.mirror(name, to, 0)
+	cb.transition(name, State(from), to, reason)
+	return nil
+}
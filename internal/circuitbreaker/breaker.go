@@ -2,111 +2,623 @@ package circuitbreaker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	ErrCircuitOpen = errors.New("circuit breaker is open")
+	ErrCircuitOpen   = errors.New("circuit breaker is open")
+	ErrInvalidConfig = errors.New("invalid circuit breaker config")
 )
 
 type State int
 
 const (
-	StateClosed   State = 0
-	StateOpen     State = 1
-	StateHalfOpen State = 2
+	StateClosed       State = 0
+	StateOpen         State = 1
+	StateHalfOpen     State = 2
+	StateForcedOpen   State = 3 // Rejects every call until an operator changes it
+	StateForcedClosed State = 4 // Admits every call and counts nothing until an operator changes it
 )
 
-// Redis Keys:
-// cb:{service}:state -> 0 (Closed), 1 (Open), 2 (Half-Open)
-// cb:{service}:failures -> count
-// cb:{service}:successes -> count (for Half-Open)
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	case StateForcedOpen:
+		return "forced_open"
+	case StateForcedClosed:
+		return "forced_closed"
+	default:
+		return "closed"
+	}
+}
+
+// Transition is a breaker changing state
+type Transition struct {
+	Breaker string    `json:"breaker"`
+	From    State     `json:"-"`
+	To      State     `json:"-"`
+	At      time.Time `json:"at"`
+	Reason  string    `json:"reason"`          // failures, timeout, probe_failed, recovered, or the operator action
+	Local   bool      `json:"local,omitempty"` // Decided by this instance alone while Redis was down
+}
+
+// MarshalJSON reports states by name
+func (t Transition) MarshalJSON() ([]byte, error) {
+	type plain Transition
+	return json.Marshal(struct {
+		plain
+		From string `json:"from"`
+		To   string `json:"to"`
+	}{plain(t), t.From.String(), t.To.String()})
+}
+
+// WindowType selects what a breaker judges while closed
+type WindowType string
+
+const (
+	WindowConsecutive WindowType = ""      // FailureThreshold failures in a row; any success starts over
+	WindowCount       WindowType = "count" // Failure and slow call rates of the last WindowSize calls
+	WindowTime        WindowType = "time"  // Failure and slow call rates of the calls in the last WindowSize seconds
+)
+
+// Window limits, so a record never scans more than this many entries
+const (
+	maxCountWindow = 10_000
+	maxTimeWindow  = 600
+)
+
+// defaultMinimumCalls is the volume a sliding window needs before it judges rates
+const defaultMinimumCalls = 10
+
+// Config sets when a breaker opens and how it recovers
+type Config struct {
+	FailureThreshold int64         // Consecutive failures that open the breaker, for WindowConsecutive
+	SuccessThreshold int64         // Consecutive successful probes that close it again
+	Timeout          time.Duration // How long it stays open before probing
+	HalfOpenProbes   int64         // Probes in flight at once while half-open; default 1
+
+	Window           WindowType
+	WindowSize       int64         // Calls for WindowCount, seconds for WindowTime
+	MinimumCalls     int64         // Calls the window needs before rates count; default 10, at most a count window
+	FailureRate      float64       // Percentage of failed calls that opens the breaker; 0 ignores failures
+	SlowCallDuration time.Duration // Calls that take longer are slow; 0 ignores duration
+	SlowCallRate     float64       // Percentage of slow calls that opens the breaker
+}
+
+// Validate rejects configs a breaker could not apply
+func (c Config) Validate() error {
+	if c.SuccessThreshold < 1 || c.Timeout <= 0 {
+		return fmt.Errorf("%w: success_threshold must be at least 1 and timeout positive", ErrInvalidConfig)
+	}
+	if c.HalfOpenProbes < 0 || c.MinimumCalls < 0 || c.SlowCallDuration < 0 {
+		return fmt.Errorf("%w: half_open_probes, minimum_calls and slow_call_duration must not be negative", ErrInvalidConfig)
+	}
+	if c.FailureRate < 0 || c.FailureRate > 100 || c.SlowCallRate < 0 || c.SlowCallRate > 100 {
+		return fmt.Errorf("%w: rates are percentages between 0 and 100", ErrInvalidConfig)
+	}
+	switch c.Window {
+	case WindowConsecutive:
+		if c.FailureThreshold < 1 {
+			return fmt.Errorf("%w: failure_threshold must be at least 1", ErrInvalidConfig)
+		}
+	case WindowCount, WindowTime:
+		limit := int64(maxCountWindow)
+		if c.Window == WindowTime {
+			limit = maxTimeWindow
+		}
+		if c.WindowSize < 1 || c.WindowSize > limit {
+			return fmt.Errorf("%w: a %s window holds 1 to %d", ErrInvalidConfig, c.Window, limit)
+		}
+		if c.FailureRate == 0 && c.SlowCallRate == 0 {
+			return fmt.Errorf("%w: a %s window needs failure_rate or slow_call_rate", ErrInvalidConfig, c.Window)
+		}
+		if c.SlowCallRate > 0 && c.SlowCallDuration == 0 {
+			return fmt.Errorf("%w: slow_call_rate needs slow_call_duration", ErrInvalidConfig)
+		}
+	default:
+		return fmt.Errorf("%w: unknown window %q", ErrInvalidConfig, c.Window)
+	}
+	return nil
+}
+
+func (c Config) probes() int64 {
+	if c.HalfOpenProbes <= 0 {
+		return 1
+	}
+	return c.HalfOpenProbes
+}
+
+func (c Config) minimumCalls() int64 {
+	n := c.MinimumCalls
+	if n <= 0 {
+		n = defaultMinimumCalls
+	}
+	if c.Window == WindowCount {
+		n = min(n, c.WindowSize)
+	}
+	return n
+}
+
+func (c Config) windowCode() int {
+	switch c.Window {
+	case WindowCount:
+		return 1
+	case WindowTime:
+		return 2
+	}
+	return 0
+}
+
+// registryKey lists every breaker that has been used, for admin listings
+const registryKey = "cb:breakers"
+
+// Each breaker is one Redis hash, cb:{service}, shared by all instances:
+//   state      0 (closed), 1 (open), 2 (half-open), 3 (forced open), 4 (forced closed)
+//   failures   consecutive failures while closed
+//   successes  consecutive successful probes while half-open
+//   probes     probes in flight while half-open
+//   since      when the state was entered, in ms on the Redis clock
+//   until      when an open breaker turns half-open
+// Sliding windows live in a second hash, cb:{service}:window, as a ring of
+// slots: one per call for count windows, one per second for time windows.
+// Both transitions and counters change in Lua, so instances never race.
+
+// acquireScript decides whether a call may go ahead, moving an open breaker
+// whose timeout has passed to half-open. A half-open breaker admits up to
+// max_probes calls at once; probes that never report back (their instance
+// died) are written off after another timeout.
+// KEYS[1] = breaker hash, KEYS[2] = registry set
+// ARGV = timeout_ms, max_probes, breaker name
+// Returns: {allowed (1/0), state, probe (1/0), transitioned (1/0)}
+var acquireScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local timeout, max_probes = tonumber(ARGV[1]), tonumber(ARGV[2])
+redis.call("SADD", KEYS[2], ARGV[3])
+
+local info = redis.call("HMGET", KEYS[1], "state", "since", "probes")
+local state = tonumber(info[1]) or 0
+local since = tonumber(info[2]) or now
+local probes = tonumber(info[3]) or 0
+
+if state == 0 or state == 4 then
+	return {1, state, 0, 0}
+end
+if state == 3 then
+	return {0, 3, 0, 0}
+end
+
+local moved = 0
+if state == 1 then
+	if now - since < timeout then
+		return {0, 1, 0, 0}
+	end
+	state, since, probes, moved = 2, now, 0, 1
+	redis.call("HSET", KEYS[1], "state", 2, "since", now, "successes", 0, "probes", 0)
+	redis.call("HDEL", KEYS[1], "until")
+elseif now - since >= timeout and probes > 0 then
+	probes = 0
+	redis.call("HSET", KEYS[1], "since", now, "probes", 0)
+end
+
+if probes >= max_probes then
+	return {0, 2, 0, moved}
+end
+redis.call("HINCRBY", KEYS[1], "probes", 1)
+return {1, 2, 1, moved}
+`)
+
+// recordScript applies a call's outcome. Outcomes of calls admitted in an
+// earlier state than the current one are ignored. A probe that was slow
+// counts as failed. Windows start over whenever the breaker opens or closes.
+// KEYS[1] = breaker hash, KEYS[2] = window hash
+// ARGV = failed (1/0), slow (1/0), probe (1/0), failure_threshold,
+// success_threshold, window (0 consecutive, 1 count, 2 time), window_size,
+// minimum_calls, failure_rate, slow_call_rate, timeout_ms
+// Returns: {state, transitioned (1/0), previous state}
+var recordScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local failed, slow, probe = ARGV[1] == "1", ARGV[2] == "1", ARGV[3] == "1"
+local failure_threshold, success_threshold = tonumber(ARGV[4]), tonumber(ARGV[5])
+local window, size, minimum = tonumber(ARGV[6]), tonumber(ARGV[7]), tonumber(ARGV[8])
+local failure_rate, slow_rate, timeout = tonumber(ARGV[9]), tonumber(ARGV[10]), tonumber(ARGV[11])
+
+local state = tonumber(redis.call("HGET", KEYS[1], "state")) or 0
+
+local function open()
+	redis.call("HSET", KEYS[1], "state", 1, "since", now, "until", now + timeout, "failures", 0, "successes", 0, "probes", 0)
+	redis.call("DEL", KEYS[2])
+	return {1, 1, state}
+end
+
+-- Adds the outcome to the window and returns its calls, failures and slow calls
+local function tally()
+	local f, s = failed and 1 or 0, slow and 1 or 0
+	if window == 1 then
+		local info = redis.call("HMGET", KEYS[2], "next", "calls", "failed", "slow")
+		local i = tonumber(info[1]) or 0
+		local calls, nf, ns = tonumber(info[2]) or 0, tonumber(info[3]) or 0, tonumber(info[4]) or 0
+		local old = tonumber(redis.call("HGET", KEYS[2], "c" .. i))
+		if old then
+			nf = nf - (old % 2)
+			ns = ns - math.floor(old / 2)
+		else
+			calls = calls + 1
+		end
+		nf, ns = nf + f, ns + s
+		redis.call("HSET", KEYS[2], "c" .. i, f + 2 * s, "next", (i + 1) % size, "calls", calls, "failed", nf, "slow", ns, "size", size, "window", window)
+		redis.call("EXPIRE", KEYS[2], 86400)
+		return calls, nf, ns
+	end
+
+	local sec = math.floor(now / 1000)
+	local i = sec % size
+	local at = tonumber(redis.call("HGET", KEYS[2], "b" .. i))
+	if at ~= sec then
+		redis.call("HSET", KEYS[2], "b" .. i, sec, "t" .. i, 0, "f" .. i, 0, "s" .. i, 0)
+	end
+	redis.call("HSET", KEYS[2], "size", size, "window", window)
+	redis.call("HINCRBY", KEYS[2], "t" .. i, 1)
+	redis.call("HINCRBY", KEYS[2], "f" .. i, f)
+	redis.call("HINCRBY", KEYS[2], "s" .. i, s)
+	redis.call("EXPIRE", KEYS[2], size + 1)
+
+	local calls, nf, ns = 0, 0, 0
+	for j = 0, size - 1 do
+		local b = redis.call("HMGET", KEYS[2], "b" .. j, "t" .. j, "f" .. j, "s" .. j)
+		local bsec = tonumber(b[1])
+		if bsec and sec - bsec < size then
+			calls = calls + tonumber(b[2])
+			nf = nf + tonumber(b[3])
+			ns = ns + tonumber(b[4])
+		end
+	end
+	return calls, nf, ns
+end
+
+if state == 0 and not probe then
+	if window == 0 then
+		if not failed then
+			redis.call("HSET", KEYS[1], "failures", 0)
+			return {0, 0, 0}
+		end
+		if redis.call("HINCRBY", KEYS[1], "failures", 1) >= failure_threshold then
+			return open()
+		end
+		return {0, 0, 0}
+	end
+
+	local calls, nf, ns = tally()
+	if calls >= minimum then
+		if failure_rate > 0 and nf * 100 >= failure_rate * calls then
+			return open()
+		end
+		if slow_rate > 0 and ns * 100 >= slow_rate * calls then
+			return open()
+		end
+	end
+	return {0, 0, 0}
+end
+
+if state == 2 and probe then
+	local probes = tonumber(redis.call("HINCRBY", KEYS[1], "probes", -1))
+	if probes < 0 then
+		redis.call("HSET", KEYS[1], "probes", 0)
+	end
+	if failed or slow then
+		return open()
+	end
+	if redis.call("HINCRBY", KEYS[1], "successes", 1) >= success_threshold then
+		redis.call("HSET", KEYS[1], "state", 0, "since", now, "failures", 0, "successes", 0, "probes", 0)
+		redis.call("DEL", KEYS[2])
+		return {0, 1, 2}
+	end
+	return {2, 0, 2}
+end
+
+return {state, 0, state}
+`)
+
+// setStateScript puts a registered breaker into a state by hand; closed resets it
+// KEYS[1] = breaker hash, KEYS[2] = window hash, KEYS[3] = registry set
+// ARGV = state, breaker name
+// Returns: the previous state, or -1 if no breaker has that name
+var setStateScript = redis.NewScript(`
+if redis.call("SISMEMBER", KEYS[3], ARGV[2]) == 0 then
+	return -1
+end
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local previous = tonumber(redis.call("HGET", KEYS[1], "state")) or 0
+redis.call("DEL", KEYS[1], KEYS[2])
+if ARGV[1] ~= "0" then
+	redis.call("HSET", KEYS[1], "state", ARGV[1], "since", now)
+end
+return previous
+`)
+
+// syncScript tells Redis about a trip this instance made alone while Redis
+// was down, unless the shared breaker has left closed meanwhile. The trip
+// keeps its age, so the breaker probes when the local one would have.
+// KEYS[1] = breaker hash, KEYS[2] = window hash, KEYS[3] = registry set
+// ARGV = ms since the trip, timeout_ms, breaker name
+// Returns: 1 if Redis took the trip
+var syncScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("SADD", KEYS[3], ARGV[3])
+local state = tonumber(redis.call("HGET", KEYS[1], "state")) or 0
+if state ~= 0 then
+	return 0
+end
+local since = now - tonumber(ARGV[1])
+redis.call("HSET", KEYS[1], "state", 1, "since", since, "until", since + tonumber(ARGV[2]), "failures", 0, "successes", 0, "probes", 0)
+redis.call("DEL", KEYS[2])
+return 1
+`)
 
+// CircuitBreaker cuts calls to a failing service off for a while. While
+// closed it watches calls as its Config's window says and opens once they
+// fail too often or run too slowly, rejecting every call. Once Timeout has
+// passed it turns half-open and lets up to HalfOpenProbes calls through at a
+// time: a failed or slow probe opens it again, SuccessThreshold consecutive
+// successful probes close it.
+//
+// The shared state lives in Redis, and every instance keeps a local copy.
+// When Redis can't be reached the local copy decides alone from this
+// instance's calls, so calls never fail just because Redis did. A breaker
+// that opened locally is pushed to Redis once it is back.
 type CircuitBreaker struct {
-	client           *redis.Client
-	failureThreshold int64
-	successThreshold int64
-	timeout          time.Duration
+	client *redis.Client
+	health *limiter.Replicas // Whether Redis is up; nil always tries Redis
+	cfg    Config            // For Execute
+	notify func(Transition)
+	watch  func(name string, state State)
+
+	mu    sync.Mutex
+	local map[string]*localBreaker
 }
 
-func New(client *redis.Client, failureThreshold, successThreshold int64, timeout time.Duration) *CircuitBreaker {
+func New(client *redis.Client, health *limiter.Replicas, cfg Config) *CircuitBreaker {
 	return &CircuitBreaker{
-		client:           client,
-		failureThreshold: failureThreshold,
-		successThreshold: successThreshold,
-		timeout:          timeout,
+		client: client,
+		health: health,
+		cfg:    cfg,
+		local:  make(map[string]*localBreaker),
 	}
 }
 
-// Execute wrapper
-func (cb *CircuitBreaker) Execute(ctx context.Context, serviceName string, action func() error) error {
-	stateKey := "cb:" + serviceName + ":state"
-	failureKey := "cb:" + serviceName + ":failures"
+// OnTransition makes the breaker call fn, from the instance that caused it,
+// whenever a breaker changes state. Set it before the breaker is used.
+func (cb *CircuitBreaker) OnTransition(fn func(Transition)) {
+	cb.notify = fn
+}
+
+// OnStateChange makes the breaker call fn whenever this instance's copy of a
+// breaker changes state, including when it adopts a transition another
+// instance or an operator made. Set it before the breaker is used.
+func (cb *CircuitBreaker) OnStateChange(fn func(name string, state State)) {
+	cb.watch = fn
+}
 
-	// 1. Check State
-	stateVal, err := cb.client.Get(ctx, stateKey).Int()
-	if err != nil && err != redis.Nil {
-		return err // Redis error
+func (cb *CircuitBreaker) changed(name string, state State) {
+	if cb.watch != nil {
+		cb.watch(name, state)
 	}
-	// Default Closed if nil
+}
 
-	state := State(stateVal)
+func (cb *CircuitBreaker) transition(name string, from, to State, reason string) {
+	cb.emit(Transition{Breaker: name, From: from, To: to, At: time.Now(), Reason: reason})
+}
 
-	if state == StateOpen {
-		return ErrCircuitOpen
+func (cb *CircuitBreaker) emit(tr Transition) {
+	where := ""
+	if tr.Local {
+		where = ", local"
 	}
+	log.Printf("circuitbreaker: %s is %s (%s%s)", tr.Breaker, tr.To, tr.Reason, where)
+	if cb.notify != nil {
+		cb.notify(tr)
+	}
+}
 
-	// Double Check Half-Open?
-	// If Open, we rely on TTL of the state key to transition to Half-Open?
-	// Or we check if time passed?
-	// Redis EXPIRE is great for this. If StateOpen key expires, it's gone (or we check existence).
-	// Let's say:
-	// - StateOpen set with TTL.
-	// - If key doesn't exist, we assume Closed (or we need explicit Half-Open logic).
-	// Better:
-	// - Open -> Set "state" to Open with TTL.
-	// - When TTL expires, key is gone -> Closed? No, should be Half-Open.
-	// Logic:
-	// - Check "open_lock" key. If exists, Circuit is Open. Return Error.
-	// - If not exists, proceed (Closed or Half-Open implicitly).
-
-	// Let's refine:
-	// Use a Lua script to check state and increment counters atomically?
-	// Or simple:
-	// Key: cb:{service}:failures
-
-	// If failures > threshold -> Set "cb:{service}:open" = 1 with TTL.
-
-	open, _ := cb.client.Exists(ctx, "cb:"+serviceName+":open").Result()
-	if open > 0 {
+// Execute runs action unless the service's breaker rejects it, and records
+// whether it failed. A rejected call returns ErrCircuitOpen.
+func (cb *CircuitBreaker) Execute(ctx context.Context, serviceName string, action func() error) error {
+	return cb.ExecuteWith(ctx, serviceName, cb.cfg, action)
+}
+
+// ExecuteWith is Execute with the service's own config. Every caller of a
+// service should pass the same one. It only ever returns ErrCircuitOpen or
+// action's error: Redis failing makes it decide locally instead.
+func (cb *CircuitBreaker) ExecuteWith(ctx context.Context, serviceName string, cfg Config, action func() error) error {
+	if cb.health == nil || cb.health.Healthy() {
+		allowed, probe, err := cb.acquireRemote(ctx, serviceName, cfg)
+		if err == nil {
+			if !allowed {
+				return ErrCircuitOpen
+			}
+			slow, opErr := run(cfg, action)
+			cb.recordRemote(ctx, serviceName, cfg, opErr != nil, slow, probe)
+			return opErr
+		}
+		log.Printf("circuitbreaker: redis unavailable for %s, deciding locally: %v", serviceName, err)
+		cb.markDown(ctx, err)
+	}
+
+	// Redis is unavailable: this instance decides alone
+	allowed, probe := cb.acquireLocal(serviceName, cfg)
+	if !allowed {
 		return ErrCircuitOpen
 	}
+	slow, opErr := run(cfg, action)
+	cb.recordLocal(serviceName, cfg, opErr != nil, slow, probe)
+	return opErr
+}
 
-	// Execute Action
-	opErr := action()
+// run calls action, timing it against the config's slow call duration
+func run(cfg Config, action func() error) (slow bool, err error) {
+	start := time.Now()
+	err = action()
+	return cfg.SlowCallDuration > 0 && time.Since(start) > cfg.SlowCallDuration, err
+}
 
-	if opErr != nil {
-		// Failure
-		// Increment failures
-		failures, _ := cb.client.Incr(ctx, failureKey).Result()
-		if failures >= cb.failureThreshold {
-			// Trip Breaker
-			cb.client.Set(ctx, "cb:"+serviceName+":open", "1", cb.timeout)
-			// Reset failures? Or keep them?
-			cb.client.Del(ctx, failureKey)
-		}
-		return opErr
+// markDown reports a Redis failure to the health tracker, unless the caller
+// gave up or Redis itself answered with an error
+func (cb *CircuitBreaker) markDown(ctx context.Context, err error) {
+	var reply redis.Error
+	if cb.health != nil && ctx.Err() == nil && !errors.As(err, &reply) {
+		cb.health.MarkDown(err)
+	}
+}
+
+func (cb *CircuitBreaker) acquireRemote(ctx context.Context, name string, cfg Config) (allowed, probe bool, err error) {
+	keys := breakerKeys(name)
+	if err := cb.sync(ctx, name, cfg); err != nil {
+		return false, false, err
+	}
+
+	vals, err := acquireScript.Run(ctx, cb.client, []string{keys[0], registryKey}, cfg.Timeout.Milliseconds(), cfg.probes(), name).Int64Slice()
+	if err != nil {
+		return false, false, err
+	}
+	cb.mirror(name, State(vals[1]), cfg.Timeout)
+	if vals[3] == 1 {
+		cb.transition(name, StateOpen, StateHalfOpen, "timeout")
+	}
+	return vals[0] == 1, vals[2] == 1, nil
+}
+
+func (cb *CircuitBreaker) recordRemote(ctx context.Context, name string, cfg Config, failed, slow, probe bool) {
+	// The caller's context may be done by now; the outcome still counts
+	ctx = context.WithoutCancel(ctx)
+	res, err := recordScript.Run(ctx, cb.client, breakerKeys(name),
+		flag(failed), flag(slow), flag(probe),
+		cfg.FailureThreshold, cfg.SuccessThreshold,
+		cfg.windowCode(), cfg.WindowSize, cfg.minimumCalls(),
+		strconv.FormatFloat(cfg.FailureRate, 'f', -1, 64), strconv.FormatFloat(cfg.SlowCallRate, 'f', -1, 64),
+		cfg.Timeout.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		// Redis went away mid-call; the local breaker takes the outcome instead
+		log.Printf("circuitbreaker: failed to record outcome for %s: %v", name, err)
+		cb.markDown(ctx, err)
+		cb.recordLocal(name, cfg, failed, slow, probe)
+		return
+	}
+	cb.mirror(name, State(res[0]), cfg.Timeout)
+	if res[1] == 1 {
+		cb.transition(name, State(res[2]), State(res[0]), reason(State(res[2]), State(res[0])))
 	}
+}
+
+// reason explains a transition a call's outcome caused
+func reason(from, to State) string {
+	switch {
+	case from == StateHalfOpen && to == StateOpen:
+		return "probe_failed"
+	case to == StateClosed:
+		return "recovered"
+	}
+	return "failures"
+}
 
-	// Success
-	// Should simplify: simpler is better.
-	// We are in Closed (implied).
-	// If success, maybe reset failures? (Sliding window or Reset on success?)
-	// Common: Reset failures on success (Consecutive failures).
-	cb.client.Del(ctx, failureKey)
+// breaker returns the local copy of a breaker; callers hold cb.mu
+func (cb *CircuitBreaker) breaker(name string) *localBreaker {
+	b, ok := cb.local[name]
+	if !ok {
+		b = &localBreaker{since: time.Now()}
+		cb.local[name] = b
+	}
+	return b
+}
+
+// mirror keeps the local copy in step with the state Redis reported
+func (cb *CircuitBreaker) mirror(name string, state State, timeout time.Duration) {
+	cb.mu.Lock()
+	moved := cb.breaker(name).mirror(state, time.Now(), timeout)
+	cb.mu.Unlock()
+	if moved {
+		cb.changed(name, state)
+	}
+}
+
+// sync pushes a trip made while Redis was down, before Redis decides again
+func (cb *CircuitBreaker) sync(ctx context.Context, name string, cfg Config) error {
+	cb.mu.Lock()
+	b := cb.breaker(name)
+	tripped, age := b.tripped, time.Since(b.since)
+	if b.state == StateHalfOpen {
+		age = cfg.Timeout // Probing already; let Redis probe too
+	}
+	cb.mu.Unlock()
+	if !tripped {
+		return nil
+	}
+
+	keys := append(breakerKeys(name), registryKey)
+	took, err := syncScript.Run(ctx, cb.client, keys, age.Milliseconds(), cfg.Timeout.Milliseconds(), name).Int64()
+	if err != nil {
+		return err
+	}
+	if took == 1 {
+		log.Printf("circuitbreaker: %s opened while redis was down; shared state is now open", name)
+	}
 
+	cb.mu.Lock()
+	cb.breaker(name).tripped = false
+	cb.mu.Unlock()
 	return nil
 }
+
+func (cb *CircuitBreaker) acquireLocal(name string, cfg Config) (allowed, probe bool) {
+	cb.mu.Lock()
+	allowed, probe, moved := cb.breaker(name).acquire(cfg, time.Now())
+	cb.mu.Unlock()
+
+	if moved {
+		cb.changed(name, StateHalfOpen)
+		cb.emit(Transition{Breaker: name, From: StateOpen, To: StateHalfOpen, At: time.Now(), Reason: "timeout", Local: true})
+	}
+	return allowed, probe
+}
+
+func (cb *CircuitBreaker) recordLocal(name string, cfg Config, failed, slow, probe bool) {
+	cb.mu.Lock()
+	b := cb.breaker(name)
+	from, to, moved := b.record(cfg, time.Now(), failed, slow, probe)
+	if moved {
+		b.tripped = to == StateOpen
+	}
+	cb.mu.Unlock()
+
+	if moved {
+		cb.changed(name, to)
+		cb.emit(Transition{Breaker: name, From: from, To: to, At: time.Now(), Reason: reason(from, to), Local: true})
+	}
+}
+
+// breakerKeys returns a breaker's state and window hashes
+func breakerKeys(name string) []string {
+	return []string{"cb:" + name, "cb:" + name + ":window"}
+}
+
+func flag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,275 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/redis/go-redis/v9"
+)
+
+var errBoom = errors.New("boom")
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Unix(1_700_000_000, 0)
+	mr.SetTime(now)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	cb := New(rdb, nil, Config{FailureThreshold: 3, SuccessThreshold: 2, Timeout: 10 * time.Second, HalfOpenProbes: 1})
+	fail := func() error { return errBoom }
+	ok := func() error { return nil }
+
+	// Three consecutive failures open it
+	for i := 0; i < 3; i++ {
+		cb.Execute(ctx, "svc", fail)
+	}
+	if err := cb.Execute(ctx, "svc", ok); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+
+	// After the timeout one probe goes through at a time
+	mr.SetTime(now.Add(10 * time.Second))
+	err := cb.Execute(ctx, "svc", func() error {
+		if err := cb.Execute(ctx, "svc", ok); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Expected a second concurrent probe to be rejected, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+
+	// A failed probe opens it again for another timeout
+	cb.Execute(ctx, "svc", fail)
+	if err := cb.Execute(ctx, "svc", ok); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen after a failed probe, got %v", err)
+	}
+
+	// Two successful probes close it
+	mr.SetTime(now.Add(20 * time.Second))
+	for i := 0; i < 2; i++ {
+		if err := cb.Execute(ctx, "svc", ok); err != nil {
+			t.Fatalf("probe %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		cb.Execute(ctx, "svc", fail)
+	}
+	if err := cb.Execute(ctx, "svc", ok); err != nil {
+		t.Fatalf("Expected a closed breaker, got %v", err)
+	}
+}
+
+func TestBreaker_FailureRateWindow(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1_700_000_000, 0))
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	cfg := Config{SuccessThreshold: 1, Timeout: 10 * time.Second, Window: WindowCount, WindowSize: 10, MinimumCalls: 10, FailureRate: 50}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cb := New(rdb, nil, Config{})
+
+	// Failing every other call never fails twice in a row, but trips at 10 calls
+	for i := 0; i < 10; i++ {
+		err := cb.ExecuteWith(ctx, "flaky", cfg, func() error {
+			if i%2 == 0 {
+				return errBoom
+			}
+			return nil
+		})
+		if errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected no rejection before the window fills, got one at call %d", i)
+		}
+	}
+	if err := cb.ExecuteWith(ctx, "flaky", cfg, func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen at a 50%% failure rate, got %v", err)
+	}
+}
+
+func TestBreaker_SlowCallRate(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1_700_000_000, 0))
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	cfg := Config{SuccessThreshold: 1, Timeout: 10 * time.Second, Window: WindowTime, WindowSize: 60, MinimumCalls: 4,
+		SlowCallDuration: time.Millisecond, SlowCallRate: 50}
+	cb := New(rdb, nil, Config{})
+	slow := func() error { time.Sleep(3 * time.Millisecond); return nil }
+	fast := func() error { return nil }
+
+	// Two slow calls of three stay below the minimum volume
+	for _, action := range []func() error{slow, slow, fast} {
+		cb.ExecuteWith(ctx, "slow", cfg, action)
+	}
+	if err := cb.ExecuteWith(ctx, "slow", cfg, fast); err != nil {
+		t.Fatalf("Expected a closed breaker below the minimum volume, got %v", err)
+	}
+	if err := cb.ExecuteWith(ctx, "slow", cfg, fast); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen at a 50%% slow call rate, got %v", err)
+	}
+}
+
+func TestBreaker_AdminControls(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Unix(1_700_000_000, 0)
+	mr.SetTime(now)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	cb := New(rdb, nil, Config{FailureThreshold: 2, SuccessThreshold: 1, Timeout: 10 * time.Second})
+	var seen []Transition
+	cb.OnTransition(func(tr Transition) { seen = append(seen, tr) })
+
+	cb.Execute(ctx, "svc", func() error { return errBoom })
+	cb.Execute(ctx, "svc", func() error { return errBoom })
+	st, err := cb.Status(ctx, "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "open" || st.HalfOpenInMs != 10_000 {
+		t.Fatalf("Expected open for another 10s, got %+v", st)
+	}
+
+	// Forced closed admits even failing calls without opening
+	if err := cb.ForceClose(ctx, "svc"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := cb.Execute(ctx, "svc", func() error { return errBoom }); !errors.Is(err, errBoom) {
+			t.Fatalf("Expected the call to run, got %v", err)
+		}
+	}
+
+	if err := cb.ForceOpen(ctx, "svc"); err != nil {
+		t.Fatal(err)
+	}
+	mr.SetTime(now.Add(time.Hour))
+	if err := cb.Execute(ctx, "svc", func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected a forced open breaker to stay open, got %v", err)
+	}
+
+	if err := cb.Reset(ctx, "svc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cb.Execute(ctx, "svc", func() error { return nil }); err != nil {
+		t.Fatalf("Expected a reset breaker to admit calls, got %v", err)
+	}
+
+	var got []string
+	for _, tr := range seen {
+		got = append(got, tr.From.String()+">"+tr.To.String())
+	}
+	want := "closed>open open>forced_closed forced_closed>forced_open forced_open>closed"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("Expected transitions %q, got %q", want, strings.Join(got, " "))
+	}
+
+	// A misspelled name must not create a breaker
+	if err := cb.ForceOpen(ctx, "scv"); !errors.Is(err, ErrUnknownBreaker) {
+		t.Fatalf("Expected ErrUnknownBreaker, got %v", err)
+	}
+	if err := cb.Reset(ctx, ""); !errors.Is(err, ErrNameRequired) {
+		t.Fatalf("Expected ErrNameRequired, got %v", err)
+	}
+	if list, err := cb.List(ctx); err != nil || len(list) != 1 || list[0].Name != "svc" {
+		t.Fatalf("Expected only svc listed, got %v, %v", list, err)
+	}
+}
+
+func TestBreaker_LocalFallback(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer rdb.Close()
+
+	health := limiter.NewReplicas(rdb, "replica-1", time.Minute)
+	cb := New(rdb, health, Config{FailureThreshold: 2, SuccessThreshold: 1, Timeout: 50 * time.Millisecond})
+	var seen []Transition
+	cb.OnTransition(func(tr Transition) { seen = append(seen, tr) })
+	mr.Close()
+
+	// Calls still run, and failures still open the breaker
+	for i := 0; i < 2; i++ {
+		if err := cb.Execute(ctx, "svc", func() error { return errBoom }); !errors.Is(err, errBoom) {
+			t.Fatalf("Expected the call to run without redis, got %v", err)
+		}
+	}
+	if err := cb.Execute(ctx, "svc", func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if len(seen) != 1 || !seen[0].Local || seen[0].To != StateOpen {
+		t.Fatalf("Expected a local transition to open, got %+v", seen)
+	}
+
+	// A successful probe closes it again
+	time.Sleep(60 * time.Millisecond)
+	if err := cb.Execute(ctx, "svc", func() error { return nil }); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := cb.Execute(ctx, "svc", func() error { return nil }); err != nil {
+		t.Fatalf("Expected a closed breaker, got %v", err)
+	}
+
+	// A trip made while redis was down reaches redis once it is back
+	cb.Execute(ctx, "svc", func() error { return errBoom })
+	cb.Execute(ctx, "svc", func() error { return errBoom })
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := health.Heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := cb.Execute(ctx, "svc", func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen after redis recovered, got %v", err)
+	}
+	if st, err := cb.Status(ctx, "svc"); err != nil || st.State != "open" {
+		t.Fatalf("Expected redis to hold the open state, got %+v, %v", st, err)
+	}
+}
+
+func TestBreaker_StateChangeFollowsOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	cfg := Config{FailureThreshold: 2, SuccessThreshold: 1, Timeout: time.Minute}
+	a, b := New(rdb, nil, cfg), New(rdb, nil, cfg)
+	var transitions int
+	var states []State
+	b.OnTransition(func(Transition) { transitions++ })
+	b.OnStateChange(func(name string, s State) { states = append(states, s) })
+
+	// b sees the breaker closed, then a opens it and an operator forces it closed
+	b.Execute(ctx, "svc", func() error { return nil })
+	a.Execute(ctx, "svc", func() error { return errBoom })
+	a.Execute(ctx, "svc", func() error { return errBoom })
+	if err := b.Execute(ctx, "svc", func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected b to follow the shared open state, got %v", err)
+	}
+	if err := a.ForceClose(ctx, "svc"); err != nil {
+		t.Fatal(err)
+	}
+	b.Execute(ctx, "svc", func() error { return nil })
+
+	if transitions != 0 {
+		t.Errorf("Expected b to report no transitions it didn't cause, got %d", transitions)
+	}
+	if len(states) != 2 || states[0] != StateOpen || states[1] != StateForcedClosed {
+		t.Errorf("Expected b to see open then forced_closed, got %v", states)
+	}
+}
@@ -0,0 +1,142 @@
+package circuitbreaker
+
+import (
+	"time"
+)
+
+// localBreaker is one breaker's in-process state machine. While Redis is
+// reachable it only mirrors the shared state. While Redis is down it decides
+// alone, from this instance's calls, with the same rules as the scripts.
+type localBreaker struct {
+	state     State
+	since     time.Time
+	until     time.Time // When an open breaker turns half-open
+	failures  int64
+	successes int64
+	probes    int64
+
+	// Sliding window: one slot per call for count windows, one per second for time windows
+	slots []slot
+	next  int
+
+	tripped bool // Opened while Redis was down; Redis doesn't know yet
+}
+
+type slot struct {
+	sec                 int64 // For time windows, the second the slot counts
+	calls, failed, slow int64
+}
+
+// mirror adopts the shared state Redis reported and reports whether it changed
+func (b *localBreaker) mirror(state State, now time.Time, timeout time.Duration) bool {
+	if state == b.state {
+		return false
+	}
+	b.enter(state, now, timeout)
+	b.tripped = false
+	return true
+}
+
+func (b *localBreaker) enter(state State, now time.Time, timeout time.Duration) {
+	b.state, b.since = state, now
+	b.until = time.Time{}
+	if state == StateOpen {
+		b.until = now.Add(timeout)
+	}
+	b.failures, b.successes, b.probes = 0, 0, 0
+	b.slots, b.next = nil, 0
+}
+
+// acquire is acquireScript for this instance alone
+func (b *localBreaker) acquire(cfg Config, now time.Time) (allowed, probe, moved bool) {
+	switch b.state {
+	case StateClosed, StateForcedClosed:
+		return true, false, false
+	case StateForcedOpen:
+		return false, false, false
+	case StateOpen:
+		if now.Before(b.until) {
+			return false, false, false
+		}
+		b.enter(StateHalfOpen, now, cfg.Timeout)
+		moved = true
+	default:
+		if now.Sub(b.since) >= cfg.Timeout && b.probes > 0 {
+			b.since, b.probes = now, 0
+		}
+	}
+	if b.probes >= cfg.probes() {
+		return false, false, moved
+	}
+	b.probes++
+	return true, true, moved
+}
+
+// record is recordScript for this instance alone; it reports the state
+// before and after and whether it changed
+func (b *localBreaker) record(cfg Config, now time.Time, failed, slow, probe bool) (State, State, bool) {
+	from := b.state
+	switch {
+	case b.state == StateClosed && !probe:
+		if b.judge(cfg, now, failed, slow) {
+			b.enter(StateOpen, now, cfg.Timeout)
+		}
+	case b.state == StateHalfOpen && probe:
+		b.probes = max(0, b.probes-1)
+		if failed || slow {
+			b.enter(StateOpen, now, cfg.Timeout)
+		} else if b.successes++; b.successes >= cfg.SuccessThreshold {
+			b.enter(StateClosed, now, cfg.Timeout)
+		}
+	}
+	return from, b.state, from != b.state
+}
+
+// judge counts a closed breaker's call and reports whether it should open
+func (b *localBreaker) judge(cfg Config, now time.Time, failed, slow bool) bool {
+	if cfg.Window == WindowConsecutive {
+		if !failed {
+			b.failures = 0
+			return false
+		}
+		b.failures++
+		return b.failures >= cfg.FailureThreshold
+	}
+
+	size := int(cfg.WindowSize)
+	if len(b.slots) != size {
+		b.slots, b.next = make([]slot, size), 0
+	}
+	out := slot{calls: 1, failed: flag64(failed), slow: flag64(slow)}
+	if cfg.Window == WindowCount {
+		b.slots[b.next] = out
+		b.next = (b.next + 1) % size
+	} else {
+		sec := now.Unix()
+		s := &b.slots[sec%int64(size)]
+		if s.sec != sec {
+			*s = slot{sec: sec}
+		}
+		s.calls, s.failed, s.slow = s.calls+1, s.failed+out.failed, s.slow+out.slow
+	}
+
+	var calls, nf, ns int64
+	for _, s := range b.slots {
+		if cfg.Window == WindowTime && now.Unix()-s.sec >= cfg.WindowSize {
+			continue
+		}
+		calls, nf, ns = calls+s.calls, nf+s.failed, ns+s.slow
+	}
+	if calls < cfg.minimumCalls() {
+		return false
+	}
+	return (cfg.FailureRate > 0 && float64(nf*100) >= cfg.FailureRate*float64(calls)) ||
+		(cfg.SlowCallRate > 0 && float64(ns*100) >= cfg.SlowCallRate*float64(calls))
+}
+
+func flag64(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
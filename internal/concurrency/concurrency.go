@@ -0,0 +1,228 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrLimitExceeded = errors.New("concurrency limit exceeded")
+)
+
+// Slot is one semaphore a request must hold while in flight
+type Slot struct {
+	Key string
+	Max int
+}
+
+// acquireScript takes a lease on every semaphore or on none. Each semaphore is
+// a sorted set of lease IDs scored by expiry (Unix ms on the Redis clock);
+// expired leases, such as those of a crashed instance, are dropped first.
+// KEYS = one sorted set per slot
+// ARGV = lease ttl (ms), lease id, then each slot's max
+// Returns: 1 when acquired, else 0
+var acquireScript = redis.NewScript(`
+redis.replicate_commands()
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local ttl = tonumber(ARGV[1])
+
+for i = 1, #KEYS do
+	redis.call("ZREMRANGEBYSCORE", KEYS[i], "-inf", now)
+	if redis.call("ZCARD", KEYS[i]) >= tonumber(ARGV[2 + i]) then
+		return 0
+	end
+end
+for i = 1, #KEYS do
+	redis.call("ZADD", KEYS[i], now + ttl, ARGV[2])
+	redis.call("PEXPIRE", KEYS[i], ttl)
+end
+return 1
+`)
+
+// renewScript pushes a held lease's expiry out by another ttl
+// KEYS = the lease's sorted sets
+// ARGV = lease ttl (ms), lease id
+var renewScript = redis.NewScript(`
+redis.replicate_commands()
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local ttl = tonumber(ARGV[1])
+
+for i = 1, #KEYS do
+	if redis.call("ZADD", KEYS[i], "XX", "CH", now + ttl, ARGV[2]) == 1 then
+		redis.call("PEXPIRE", KEYS[i], ttl)
+	end
+end
+return 1
+`)
+
+// Limiter caps in-flight requests with semaphores in Redis, shared by all
+// replicas. Leases expire unless renewed, so slots held by a crashed instance
+// come back after the lease TTL.
+//
+// Every instance also counts its own in-flight requests. A slot this
+// instance alone already fills is refused without a Redis call, and while
+// Redis is down each instance enforces its share (max / replicas, rounded up).
+type Limiter struct {
+	client *redis.Client
+	health *limiter.Replicas // nil means always try Redis
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func New(client *redis.Client, health *limiter.Replicas, ttl time.Duration) *Limiter {
+	return &Limiter{
+		client:   client,
+		health:   health,
+		ttl:      ttl,
+		inFlight: make(map[string]int),
+	}
+}
+
+// Lease is a request's hold on its slots; Release it when the request ends
+type Lease struct {
+	l      *Limiter
+	id     string
+	keys   []string
+	remote bool // Also held in Redis
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// Acquire takes a slot in every semaphore, or returns ErrLimitExceeded
+func (l *Limiter) Acquire(ctx context.Context, slots []Slot) (*Lease, error) {
+	if !l.reserve(slots, func(s Slot) int { return s.Max }) {
+		return nil, ErrLimitExceeded
+	}
+
+	lease := &Lease{l: l, id: db.NewID("lease"), keys: make([]string, len(slots))}
+	for i, s := range slots {
+		lease.keys[i] = s.Key
+	}
+
+	if l.health == nil || l.health.Healthy() {
+		ok, err := l.acquireRemote(ctx, lease, slots)
+		switch {
+		case err == nil && ok:
+			lease.remote = true
+			lease.stop = make(chan struct{})
+			go lease.keepAlive()
+			return lease, nil
+		case err == nil:
+			l.unreserve(lease.keys)
+			return nil, ErrLimitExceeded
+		}
+		log.Printf("concurrency: redis error, limiting locally: %v", err)
+		if l.health != nil && ctx.Err() == nil && !isReply(err) {
+			l.health.MarkDown(err)
+		}
+	}
+
+	// Redis is unavailable: this instance's count must also fit its share
+	l.unreserve(lease.keys)
+	if !l.reserve(slots, l.localShare) {
+		return nil, ErrLimitExceeded
+	}
+	return lease, nil
+}
+
+// Release frees the lease's slots; calling it again does nothing
+func (lease *Lease) Release(ctx context.Context) {
+	lease.once.Do(func() {
+		lease.l.unreserve(lease.keys)
+		if !lease.remote {
+			return
+		}
+		close(lease.stop)
+		// A failed release is reclaimed when the lease expires
+		pipe := lease.l.client.Pipeline()
+		for _, key := range lease.keys {
+			pipe.ZRem(ctx, key, lease.id)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("concurrency: failed to release lease %s: %v", lease.id, err)
+		}
+	})
+}
+
+// keepAlive renews the lease until it is released, so long requests keep their slots
+func (lease *Lease) keepAlive() {
+	ticker := time.NewTicker(lease.l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lease.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), lease.l.ttl/3)
+			err := renewScript.Run(ctx, lease.l.client, lease.keys, lease.l.ttl.Milliseconds(), lease.id).Err()
+			cancel()
+			if err != nil {
+				log.Printf("concurrency: failed to renew lease %s: %v", lease.id, err)
+			}
+		}
+	}
+}
+
+func (l *Limiter) acquireRemote(ctx context.Context, lease *Lease, slots []Slot) (bool, error) {
+	args := []interface{}{l.ttl.Milliseconds(), lease.id}
+	for _, s := range slots {
+		args = append(args, s.Max)
+	}
+	n, err := acquireScript.Run(ctx, l.client, lease.keys, args...).Int()
+	return n == 1, err
+}
+
+// reserve counts a request against every slot on this instance, unless one of
+// them already holds limit(slot) requests here
+func (l *Limiter) reserve(slots []Slot, limit func(Slot) int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range slots {
+		if l.inFlight[s.Key] >= limit(s) {
+			return false
+		}
+	}
+	for _, s := range slots {
+		l.inFlight[s.Key]++
+	}
+	return true
+}
+
+func (l *Limiter) unreserve(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if l.inFlight[key]--; l.inFlight[key] <= 0 {
+			delete(l.inFlight, key)
+		}
+	}
+}
+
+// localShare splits a slot's max evenly across live replicas, keeping at least one
+func (l *Limiter) localShare(s Slot) int {
+	n := 1
+	if l.health != nil {
+		n = l.health.Count()
+	}
+	return int(math.Max(1, math.Ceil(float64(s.Max)/float64(n))))
+}
+
+// isReply reports whether err was sent by Redis itself, which says nothing about its health
+func isReply(err error) bool {
+	var reply redis.Error
+	return errors.As(err, &reply)
+}
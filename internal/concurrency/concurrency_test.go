@@ -0,0 +1,68 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLimiter_SharedSemaphore(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1_700_000_000, 0))
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	// Two instances share the route's two slots
+	a, b := New(rdb, nil, 30*time.Second), New(rdb, nil, 30*time.Second)
+	slots := []Slot{{Key: "concurrency:route:export", Max: 2}}
+
+	first, err := a.Acquire(ctx, slots)
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	if _, err := b.Acquire(ctx, slots); err != nil {
+		t.Fatalf("second acquire: %v", err)
+	}
+	if _, err := b.Acquire(ctx, slots); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected ErrLimitExceeded, got %v", err)
+	}
+
+	first.Release(ctx)
+	if _, err := b.Acquire(ctx, slots); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+
+	// b never renews within the test, as if it had crashed: its leases lapse
+	mr.SetTime(time.Unix(1_700_000_031, 0))
+	if _, err := a.Acquire(ctx, slots); err != nil {
+		t.Fatalf("expired leases were not reclaimed: %v", err)
+	}
+}
+
+func TestLimiter_LocalWhileRedisDown(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:1", MaxRetries: -1, DialTimeout: 50 * time.Millisecond})
+	defer rdb.Close()
+
+	l := New(rdb, limiter.NewReplicas(rdb, "test", time.Second), 30*time.Second)
+	slots := []Slot{{Key: "concurrency:tenant:default:user:alice", Max: 1}}
+
+	lease, err := l.Acquire(ctx, slots)
+	if err != nil {
+		t.Fatalf("Expected local acquire, got %v", err)
+	}
+	if _, err := l.Acquire(ctx, slots); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected ErrLimitExceeded, got %v", err)
+	}
+	lease.Release(ctx)
+	lease.Release(ctx) // Idempotent
+	if _, err := l.Acquire(ctx, slots); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
@@ -1,23 +1,39 @@
 package db
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"time"
 )
 
+// Tenant isolates users, keys, service accounts and policies of one customer.
+// The "default" tenant is the operator's own and may administer all others.
+type Tenant struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
 type User struct {
 	ID           string    `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username"`
+	TenantID     string    `json:"tenant_id" db:"tenant_id"`
+	Username     string    `json:"username" db:"username"` // Unique
+	Email        string    `json:"email,omitempty" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"`
+	Disabled     bool      `json:"disabled" db:"disabled"` // Disabled users can't authenticate with any credential
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type APIKey struct {
 	ID        string    `json:"id" db:"id"`
-	UserID    string    `json:"user_id" db:"user_id"`
-	KeyHash   string    `json:"-" db:"key_hash"`    // SHA256 hash of the raw key
-	Prefix    string    `json:"prefix" db:"prefix"` // First few chars clear for identification
+	UserID    string    `json:"user_id" db:"user_id"`       // Owning user or service account ID
+	TenantID  string    `json:"tenant_id" db:"tenant_id"`   // Always the owner's tenant
+	OwnerType string    `json:"owner_type" db:"owner_type"` // "user" or "service"
+	KeyHash   string    `json:"-" db:"key_hash"`            // SHA256 hash of the raw key
+	Prefix    string    `json:"prefix" db:"prefix"`         // First few chars clear for identification
 	Name      string    `json:"name" db:"name"`
 	Scopes    []string  `json:"scopes" db:"scopes"` // e.g., "read", "write"
 	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
@@ -27,9 +43,65 @@ type APIKey struct {
 
 type Policy struct {
 	ID         string          `json:"id" db:"id"`
+	TenantID   string          `json:"tenant_id,omitempty" db:"tenant_id"` // Empty for global policies
 	Name       string          `json:"name" db:"name"`
 	Type       string          `json:"type" db:"type"`             // e.g., "rate_limit", "access_control"
 	Definition json.RawMessage `json:"definition" db:"definition"` // Flexible JSON config
 	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time       `json:"updated_at" db:"updated_at"`
 }
+
+// ServiceAccount is a non-human identity owned by a team.
+// It has no password; it authenticates with API keys restricted to Scopes.
+type ServiceAccount struct {
+	ID          string    `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	TenantID    string    `json:"tenant_id" db:"tenant_id"`
+	TeamID      string    `json:"team_id" db:"team_id"`
+	Description string    `json:"description,omitempty" db:"description"`
+	Scopes      []string  `json:"scopes" db:"scopes"` // Upper bound for the account's key scopes
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RoleSubject is the user or service account a role binding grants to.
+// Bindings match on all three fields, so a user never inherits the roles of
+// a service account, or of a subject in another tenant, that shares its ID.
+type RoleSubject struct {
+	SubjectType string `json:"subject_type" db:"subject_type"` // "user" or "service"
+	TenantID    string `json:"tenant_id" db:"tenant_id"`
+	SubjectID   string `json:"subject_id" db:"subject_id"`
+}
+
+// RoleBinding grants a role to a user or service account
+type RoleBinding struct {
+	RoleSubject
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// QuotaPlan caps how many requests a subject may make per calendar period
+type QuotaPlan struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Limit     int64     `json:"limit" db:"request_limit"` // Requests per period
+	Period    string    `json:"period" db:"period"`       // "day" or "month", aligned to UTC
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// PlanAssignment puts a user, API key or tenant on a quota plan
+type PlanAssignment struct {
+	SubjectType string    `json:"subject_type" db:"subject_type"` // "user", "key" or "tenant"
+	SubjectID   string    `json:"subject_id" db:"subject_id"`
+	TenantID    string    `json:"tenant_id" db:"tenant_id"` // The subject's tenant
+	PlanID      string    `json:"plan_id" db:"plan_id"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// NewID returns a random identifier such as "sa_3f9c2a7d1b6e4f08"
+func NewID(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + "_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,265 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown rate limit algorithm")
+)
+
+// Algorithm names a rate limiting strategy from the registry
+type Algorithm string
+
+const (
+	TokenBucket          Algorithm = "token_bucket"           // Bursts up to Burst, refilled at Rate
+	GCRA                 Algorithm = "gcra"                   // Same limits as token_bucket, tracked as a theoretical arrival time
+	SlidingWindowLog     Algorithm = "sliding_window_log"     // Exactly Burst requests in any window; one entry per request
+	SlidingWindowCounter Algorithm = "sliding_window_counter" // Burst per window, estimated from two fixed windows
+)
+
+// Limit is what a policy asks the limiter to enforce on one key. Window
+// algorithms allow Burst requests per Burst/Rate seconds.
+type Limit struct {
+	Algorithm Algorithm // Empty means TokenBucket
+	Rate      float64   // Tokens (requests) per second
+	Burst     int
+
+	// Batch mode (token bucket only): tokens taken from Redis at a time and
+	// how long unspent ones may be held before going back; 0 calls Redis per request
+	Lease    int
+	LeaseTTL time.Duration
+}
+
+// Window is the period the window algorithms count over
+func (l Limit) Window() time.Duration {
+	if l.Rate <= 0 {
+		return Never
+	}
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+func (l Limit) algorithm() Algorithm {
+	if l.Algorithm == "" {
+		return TokenBucket
+	}
+	return l.Algorithm
+}
+
+// Bucket is the in-process state of one key under an algorithm
+type Bucket interface {
+	// Take decides whether cost units can be spent at now and only spends
+	// them if commit is set and the answer is yes
+	Take(now time.Time, limit Limit, cost int64, commit bool) Result
+}
+
+// Implementation is an algorithm's Redis and in-process form. Both must make
+// the same decisions for the same sequence of calls.
+//
+// Lua is a function expression called as f(key, burst, rate, cost, now, apply)
+// with rate in micro-tokens per second and now in Unix microseconds from the
+// Redis clock. It returns allowed (1/0), remaining micro-tokens,
+// retry_after_ms and reset_after_ms, using -1 for a wait that never ends, and
+// writes state only when apply is true and the request is allowed.
+type Implementation struct {
+	Lua       string
+	NewBucket func() Bucket
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[Algorithm]Implementation{}
+	scripts    = map[string]*redis.Script{} // Per template, with every algorithm; rebuilt on Register
+)
+
+// Register adds or replaces an algorithm
+func Register(name Algorithm, impl Implementation) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = impl
+	scripts = map[string]*redis.Script{}
+}
+
+func lookup(name Algorithm) (Implementation, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	impl, ok := registry[name]
+	if !ok {
+		return Implementation{}, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, name)
+	}
+	return impl, nil
+}
+
+// Valid reports whether a is registered; empty selects the default
+func (a Algorithm) Valid() bool {
+	if a == "" {
+		return true
+	}
+	_, err := lookup(a)
+	return err == nil
+}
+
+// Algorithms lists the registered algorithms
+func Algorithms() []Algorithm {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	list := make([]Algorithm, 0, len(registry))
+	for name := range registry {
+		list = append(list, name)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// levelsScript checks every level first and spends tokens only when all of
+// them allow the request. Levels that allowed a denied request report their
+// untouched state.
+// KEYS = one bucket key per level
+// ARGV[1] = cost, then algorithm, burst, rate (micro-tokens per second) per level
+// Returns: {allowed (1/0), then allowed, remaining, retry_after_ms, reset_after_ms per level}
+const levelsScript = `
+redis.replicate_commands()
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local algorithms = {}
+%s
+
+local cost = tonumber(ARGV[1])
+local function level(i, n, apply)
+	local take = algorithms[ARGV[3 * i - 1]]
+	return {take(KEYS[i], tonumber(ARGV[3 * i]), tonumber(ARGV[3 * i + 1]), n, now, apply)}
+end
+
+local results = {}
+local all = 1
+for i = 1, #KEYS do
+	results[i] = level(i, cost, false)
+	if results[i][1] == 0 then
+		all = 0
+	end
+end
+
+local out = {all}
+for i = 1, #KEYS do
+	local r = results[i]
+	if all == 1 then
+		r = level(i, cost, true)
+	elseif r[1] == 1 then
+		r = level(i, 0, false)
+	end
+	for _, v in ipairs(r) do
+		out[#out + 1] = v
+	end
+end
+return out
+`
+
+// debitScript spends up to cost from every level, but never more than a
+// level has left, so it cannot be denied and never leaves a bucket in debt
+// KEYS, ARGV and Returns as levelsScript; the overall result is always 1
+const debitScript = `
+redis.replicate_commands()
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local algorithms = {}
+%s
+
+local cost = tonumber(ARGV[1])
+local function level(i, n, apply)
+	local take = algorithms[ARGV[3 * i - 1]]
+	return {take(KEYS[i], tonumber(ARGV[3 * i]), tonumber(ARGV[3 * i + 1]), n, now, apply)}
+end
+
+local out = {1}
+for i = 1, #KEYS do
+	local r = level(i, 0, false)
+	local n = math.min(cost, math.floor(r[2] / 1000000))
+	if n > 0 then
+		r = level(i, n, true)
+	end
+	for _, v in ipairs(r) do
+		out[#out + 1] = v
+	end
+end
+return out
+`
+
+// peekScript reports every level's state without spending anything
+// KEYS, ARGV and Returns as levelsScript; the cost is ignored
+const peekScript = `
+redis.replicate_commands()
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local algorithms = {}
+%s
+
+local out = {1}
+for i = 1, #KEYS do
+	local take = algorithms[ARGV[3 * i - 1]]
+	for _, v in ipairs({take(KEYS[i], tonumber(ARGV[3 * i]), tonumber(ARGV[3 * i + 1]), 0, now, false)}) do
+		out[#out + 1] = v
+	end
+end
+return out
+`
+
+// composedScript returns template with every registered algorithm
+func composedScript(template string) *redis.Script {
+	registryMu.RLock()
+	s := scripts[template]
+	registryMu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if s = scripts[template]; s == nil {
+		names := make([]string, 0, len(registry))
+		for name := range registry {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+
+		var defs strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&defs, "algorithms[%q] = %s\n", name, registry[Algorithm(name)].Lua)
+		}
+		s = redis.NewScript(fmt.Sprintf(template, defs.String()))
+		scripts[template] = s
+	}
+	return s
+}
+
+// Never is the wait reported when a bucket will not refill, such as at rate 0
+const Never = time.Duration(math.MaxInt64)
+
+// waitDuration converts a wait in milliseconds; -1 means never
+func waitDuration(ms int64) time.Duration {
+	if ms < 0 {
+		return Never
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// waitMillis rounds a wait in microseconds up to milliseconds, as the scripts do
+func waitMillis(us float64) int64 {
+	if us <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(us / 1000))
+}
@@ -0,0 +1,307 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Batch mode: for levels whose Limit sets Lease, an instance takes tokens from
+// the shared bucket Lease at a time and spends them in process, calling Redis
+// only when its lease runs short. Leased tokens have already left the shared
+// bucket, so replicas together never admit more than the limit; the cost is
+// that tokens held by one replica are unavailable to the others until spent or
+// returned, at most LeaseTTL after they were taken.
+
+// leaseScript tops up the leases of several token buckets
+// KEYS = bucket keys
+// ARGV = burst, rate (micro-tokens per second), want, need per level
+// Returns per level: granted tokens, then remaining micro-tokens,
+// retry_after_ms and reset_after_ms for need more tokens after the grant
+const leaseScript = `
+redis.replicate_commands()
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local take = %s
+
+local out = {}
+for i = 1, #KEYS do
+	local burst, rate = tonumber(ARGV[4 * i - 3]), tonumber(ARGV[4 * i - 2])
+	local want, need = tonumber(ARGV[4 * i - 1]), tonumber(ARGV[4 * i])
+
+	local _, remaining = take(KEYS[i], burst, rate, 0, now, false)
+	local n = math.min(want, math.floor(remaining / 1000000))
+	if n > 0 then
+		take(KEYS[i], burst, rate, n, now, true)
+	end
+	local _, left, retry_after, reset_after = take(KEYS[i], burst, rate, need, now, false)
+	out[#out + 1] = n
+	out[#out + 1] = left
+	out[#out + 1] = retry_after
+	out[#out + 1] = reset_after
+end
+return out
+`
+
+// returnScript puts unspent leased tokens back, never beyond capacity, with
+// the same millisecond refill as tokenBucketLua
+// KEYS = bucket keys
+// ARGV = burst, rate (micro-tokens per second), tokens per level
+var returnScript = redis.NewScript(`
+redis.replicate_commands()
+
+local t = redis.call("TIME")
+local now = math.floor((tonumber(t[1]) * 1000000 + tonumber(t[2])) / 1000)
+
+for i = 1, #KEYS do
+	local capacity = tonumber(ARGV[3 * i - 2]) * 1000000
+	local rate = tonumber(ARGV[3 * i - 1])
+	local returned = tonumber(ARGV[3 * i]) * 1000000
+
+	local info = redis.call("HMGET", KEYS[i], "tokens", "last_refill")
+	local tokens = tonumber(info[1])
+	if tokens then
+		local delta = math.max(0, now - tonumber(info[2]))
+		local filled = math.min(capacity, tokens + math.floor(delta * rate / 1000) + returned)
+		redis.call("HSET", KEYS[i], "tokens", filled, "last_refill", now)
+		if rate > 0 then
+			redis.call("PEXPIRE", KEYS[i], math.ceil((capacity - filled) * 1000 / rate) + 1000)
+		end
+	end
+end
+return 1
+`)
+
+var (
+	leaseOnce     sync.Once
+	leaseRedisLua *redis.Script
+)
+
+func leaseRedisScript() *redis.Script {
+	leaseOnce.Do(func() {
+		leaseRedisLua = redis.NewScript(fmt.Sprintf(leaseScript, tokenBucketLua))
+	})
+	return leaseRedisLua
+}
+
+// lease is the tokens this instance holds for one bucket
+type lease struct {
+	limit    Limit
+	tokens   int64
+	takenAt  time.Time // When the oldest held tokens were leased
+	last     Result    // Shared bucket as of the last top-up
+	lastSeen time.Time // When last was read
+	dryUntil time.Time // Deny without asking Redis until then; the shared bucket ran dry
+}
+
+// leasePool holds the leases of one RedisLimiter
+type leasePool struct {
+	mu     sync.Mutex
+	leases map[string]*lease // By bucket key
+}
+
+// allowLeased is AllowN for levels that all have a Lease
+func (l *RedisLimiter) allowLeased(ctx context.Context, levels []Level, cost int64) (Decision, error) {
+	keys := make([]string, len(levels))
+	for i, lvl := range levels {
+		if lvl.Limit.algorithm() != TokenBucket {
+			return Decision{}, fmt.Errorf("%w: batch mode needs %s, not %s", ErrUnknownAlgorithm, TokenBucket, lvl.Limit.algorithm())
+		}
+		keys[i] = bucketKey(lvl.Key, lvl.Limit)
+	}
+
+	if d, ok := l.spendLeased(keys, levels, cost); ok {
+		return d, nil
+	}
+
+	// Top up the levels that are short, then try once more. A level whose
+	// shared bucket ran dry denies locally until it has refilled.
+	var short []int
+	args := []interface{}{}
+	now := l.now()
+	l.pool.mu.Lock()
+	for i, lvl := range levels {
+		ls := l.pool.get(keys[i], lvl.Limit)
+		held := ls.tokens
+		if held >= cost {
+			continue
+		}
+		if now.Before(ls.dryUntil) {
+			// Decided under the same lock, so a concurrent top-up can't make
+			// this denial spend tokens
+			d := l.pool.decide(keys, levels, cost)
+			l.pool.mu.Unlock()
+			return d, ErrRateLimitExceeded
+		}
+		short = append(short, i)
+		want := max(int64(lvl.Limit.Lease), cost) - held
+		args = append(args, lvl.Limit.Burst, microRate(lvl.Limit.Rate), want, cost-held)
+	}
+	l.pool.mu.Unlock()
+
+	shortKeys := make([]string, len(short))
+	for j, i := range short {
+		shortKeys[j] = keys[i]
+	}
+	vals, err := leaseRedisScript().Run(ctx, l.client, shortKeys, args...).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+
+	now = l.now()
+	l.pool.mu.Lock()
+	for j, i := range short {
+		v := vals[4*j:]
+		ls := l.pool.get(keys[i], levels[i].Limit)
+		if ls.tokens == 0 && v[0] > 0 {
+			ls.takenAt = now
+		}
+		ls.tokens += v[0]
+		ls.last = Result{
+			Remaining:  float64(v[1]) / tokenScale,
+			RetryAfter: waitDuration(v[2]),
+			ResetAfter: waitDuration(v[3]),
+		}
+		ls.lastSeen = now
+		// Other replicas' leases come back within LeaseTTL, so look again by then
+		if ls.tokens < cost {
+			ls.dryUntil = now.Add(min(ls.last.RetryAfter, levels[i].Limit.LeaseTTL))
+		}
+	}
+	l.pool.mu.Unlock()
+
+	d, ok := l.spendLeased(keys, levels, cost)
+	if !ok {
+		return d, ErrRateLimitExceeded
+	}
+	return d, nil
+}
+
+// spendLeased takes cost from every level's lease if all of them hold enough,
+// and reports the levels either way
+func (l *RedisLimiter) spendLeased(keys []string, levels []Level, cost int64) (Decision, bool) {
+	l.pool.mu.Lock()
+	defer l.pool.mu.Unlock()
+
+	d := l.pool.decide(keys, levels, cost)
+	if d.Allowed {
+		for i, lvl := range levels {
+			l.pool.get(keys[i], lvl.Limit).tokens -= cost
+			d.Levels[i].Remaining -= float64(cost)
+		}
+	}
+	return d, d.Allowed
+}
+
+// decide reports whether every level's lease holds cost, without spending
+// anything. Callers hold p.mu.
+func (p *leasePool) decide(keys []string, levels []Level, cost int64) Decision {
+	d := Decision{Allowed: true, Levels: make([]Result, len(levels))}
+	for i, lvl := range levels {
+		ls := p.get(keys[i], lvl.Limit)
+		d.Levels[i].Allowed = ls.tokens >= cost
+		d.Allowed = d.Allowed && d.Levels[i].Allowed
+		// Shared bucket as last seen plus what this instance still holds
+		d.Levels[i].Remaining = ls.last.Remaining + float64(ls.tokens)
+		d.Levels[i].ResetAfter = ls.last.ResetAfter
+		if !d.Levels[i].Allowed {
+			d.Levels[i].RetryAfter = ls.last.RetryAfter
+		}
+	}
+	return d
+}
+
+// debitLeased spends a debit from the leases first and the rest from the shared buckets
+func (l *RedisLimiter) debitLeased(ctx context.Context, levels []Level, cost int64) (Decision, error) {
+	d := Decision{Allowed: true, Levels: make([]Result, len(levels))}
+	for i, lvl := range levels {
+		key := bucketKey(lvl.Key, lvl.Limit)
+		l.pool.mu.Lock()
+		ls := l.pool.get(key, lvl.Limit)
+		n := min(ls.tokens, cost)
+		ls.tokens -= n
+		held, last := ls.tokens, ls.last
+		l.pool.mu.Unlock()
+
+		if n == cost {
+			d.Levels[i] = Result{Allowed: true, Remaining: last.Remaining + float64(held), ResetAfter: last.ResetAfter}
+			continue
+		}
+		rd, err := l.run(ctx, debitScript, []Level{lvl}, cost-n)
+		if err != nil {
+			return Decision{}, err
+		}
+		d.Levels[i] = rd.Levels[0]
+		d.Levels[i].Remaining += float64(held)
+	}
+	return d, nil
+}
+
+// get returns the lease for a bucket, creating an empty one. Callers hold p.mu.
+func (p *leasePool) get(key string, limit Limit) *lease {
+	ls, ok := p.leases[key]
+	if !ok {
+		ls = &lease{}
+		p.leases[key] = ls
+	}
+	ls.limit = limit
+	return ls
+}
+
+// RunLeases returns leased tokens that were held longer than their LeaseTTL,
+// checking every interval, and returns all of them when ctx is cancelled
+func (l *RedisLimiter) RunLeases(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			shutdown, cancel := context.WithTimeout(context.Background(), time.Second)
+			l.ReturnLeases(shutdown, true)
+			cancel()
+			return
+		case <-ticker.C:
+			l.ReturnLeases(ctx, false)
+		}
+	}
+}
+
+// ReturnLeases gives expired leases, or all of them, back to the shared buckets
+func (l *RedisLimiter) ReturnLeases(ctx context.Context, all bool) error {
+	now := l.now()
+	var keys []string
+	var args []interface{}
+	returned := map[string]*lease{}
+
+	l.pool.mu.Lock()
+	for key, ls := range l.pool.leases {
+		expired := all || now.Sub(ls.takenAt) >= ls.limit.LeaseTTL
+		if ls.tokens > 0 && expired {
+			keys = append(keys, key)
+			args = append(args, ls.limit.Burst, microRate(ls.limit.Rate), ls.tokens)
+			returned[key] = &lease{limit: ls.limit, tokens: ls.tokens}
+			ls.tokens = 0
+		}
+		// Forget buckets nobody has used for a while
+		if ls.tokens == 0 && now.Sub(ls.lastSeen) > localIdleTTL {
+			delete(l.pool.leases, key)
+		}
+	}
+	l.pool.mu.Unlock()
+
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := returnScript.Run(ctx, l.client, keys, args...).Err(); err != nil {
+		// The tokens are lost; the buckets refill as usual
+		log.Printf("ratelimit: failed to return %d leased buckets: %v", len(keys), err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// replicas returns n limiters sharing one Redis whose clock stands still
+func replicas(tb testing.TB, n int) []*RedisLimiter {
+	mr := miniredis.RunT(tb)
+	mr.SetTime(epoch)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	tb.Cleanup(func() { rdb.Close() })
+
+	list := make([]*RedisLimiter, n)
+	for i := range list {
+		list[i] = NewRedisLimiter(rdb)
+	}
+	return list
+}
+
+// admit spreads requests round-robin over the replicas and counts the admitted ones
+func admit(tb testing.TB, rs []*RedisLimiter, levels []Level, requests int) int {
+	admitted := 0
+	for i := 0; i < requests; i++ {
+		_, err := rs[i%len(rs)].AllowN(context.Background(), levels, 1)
+		switch {
+		case err == nil:
+			admitted++
+		case !errors.Is(err, ErrRateLimitExceeded):
+			tb.Fatalf("allow: %v", err)
+		}
+	}
+	return admitted
+}
+
+func TestBatch_NeverOverAdmits(t *testing.T) {
+	rs := replicas(t, 4)
+	levels := []Level{
+		{Key: "user:a", Limit: Limit{Rate: 0.001, Burst: 100, Lease: 10, LeaseTTL: time.Minute}},
+		{Key: "global", Limit: Limit{Rate: 0.001, Burst: 1000, Lease: 10, LeaseTTL: time.Minute}},
+	}
+	if got := admit(t, rs, levels, 500); got != 100 {
+		t.Fatalf("Expected exactly the burst of 100 admitted, got %d", got)
+	}
+}
+
+func TestBatch_ReturnsUnusedTokens(t *testing.T) {
+	ctx := context.Background()
+	rs := replicas(t, 2)
+	a, b := rs[0], rs[1]
+	levels := []Level{{Key: "k", Limit: Limit{Rate: 0.001, Burst: 20, Lease: 10, LeaseTTL: time.Second}}}
+
+	// a leases 10 and spends one; b can only lease the other 10
+	admit(t, []*RedisLimiter{a}, levels, 1)
+	if got := admit(t, []*RedisLimiter{b}, levels, 20); got != 10 {
+		t.Fatalf("Expected b to get 10, got %d", got)
+	}
+
+	// Not held long enough yet
+	a.ReturnLeases(ctx, false)
+	if got := admit(t, []*RedisLimiter{b}, levels, 20); got != 0 {
+		t.Fatalf("Expected nothing for b before the lease expires, got %d", got)
+	}
+
+	// Once a's lease expires it goes back, and b looks again after its own LeaseTTL
+	later := func() time.Time { return time.Now().Add(time.Second) }
+	a.now, b.now = later, later
+	if err := a.ReturnLeases(ctx, false); err != nil {
+		t.Fatalf("return: %v", err)
+	}
+	if got := admit(t, []*RedisLimiter{b}, levels, 20); got != 9 {
+		t.Fatalf("Expected a's 9 unused tokens for b, got %d", got)
+	}
+}
+
+func TestBatch_DenialWhileDrySpendsNothing(t *testing.T) {
+	l := replicas(t, 1)[0]
+	levels := []Level{
+		{Key: "user:a", Limit: Limit{Rate: 0.001, Burst: 100, Lease: 10, LeaseTTL: time.Minute}},
+		{Key: "tenant:t", Limit: Limit{Rate: 0.001, Burst: 5, Lease: 10, LeaseTTL: time.Minute}},
+	}
+	if got := admit(t, []*RedisLimiter{l}, levels, 10); got != 5 {
+		t.Fatalf("Expected the tenant burst of 5 admitted, got %d", got)
+	}
+
+	// The tenant level is dry now; denials must leave the user lease alone
+	userKey := bucketKey(levels[0].Key, levels[0].Limit)
+	held := l.pool.leases[userKey].tokens
+	d, err := l.AllowN(context.Background(), levels, 1)
+	if !errors.Is(err, ErrRateLimitExceeded) || d.Allowed || !d.Levels[0].Allowed || d.Levels[1].Allowed {
+		t.Fatalf("Expected a denial by the tenant level, got %+v (%v)", d, err)
+	}
+	if got := l.pool.leases[userKey].tokens; got != held {
+		t.Errorf("Expected the user lease to keep %d tokens, got %d", held, got)
+	}
+}
+
+// Compare Redis round trips per request and over-admission with and without
+// leases: go test -bench . -benchmem ./internal/limiter
+func benchmarkReplicas(b *testing.B, lease int) {
+	rs := replicas(b, 4)
+	const burst = 10_000
+	levels := []Level{{Key: "bench", Limit: Limit{Rate: 0.001, Burst: burst, Lease: lease, LeaseTTL: time.Minute}}}
+
+	b.ResetTimer()
+	admitted := admit(b, rs, levels, b.N)
+	b.StopTimer()
+
+	b.ReportMetric(float64(max(0, admitted-burst)), "over-admitted")
+	b.ReportMetric(float64(min(b.N, burst)-admitted), "under-admitted")
+}
+
+func BenchmarkRedisLimiter_PerRequest(b *testing.B) { benchmarkReplicas(b, 0) }
+func BenchmarkRedisLimiter_Lease10(b *testing.B)    { benchmarkReplicas(b, 10) }
+func BenchmarkRedisLimiter_Lease100(b *testing.B)   { benchmarkReplicas(b, 100) }
+
+func TestRedisLimiter_PeekAndReset(t *testing.T) {
+	ctx := context.Background()
+	l := replicas(t, 1)[0]
+	levels := []Level{{Key: "user:a", Limit: Limit{Rate: 0.001, Burst: 5}}}
+
+	admit(t, []*RedisLimiter{l}, levels, 3)
+	for i := 0; i < 2; i++ {
+		d, err := l.Peek(ctx, levels)
+		if err != nil {
+			t.Fatalf("peek: %v", err)
+		}
+		if d.Levels[0].Remaining != 2 {
+			t.Fatalf("Expected 2 tokens left without spending, got %v", d.Levels[0].Remaining)
+		}
+	}
+
+	if err := l.Reset(ctx, "user:a"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if got := admit(t, []*RedisLimiter{l}, levels, 10); got != 5 {
+		t.Fatalf("Expected a full bucket of 5 after reset, got %d", got)
+	}
+}
@@ -0,0 +1,209 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Divisible by 3s so the sliding window counter's fixed windows line up
+var epoch = time.Unix(1_700_000_001, 0)
+
+// backend is one limiter implementation with a controllable clock
+type backend struct {
+	name    string
+	limiter Limiter
+	setTime func(time.Time)
+}
+
+func backends(t *testing.T) []backend {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	local := NewLocalLimiter(nil)
+	return []backend{
+		{name: "redis", limiter: NewRedisLimiter(rdb), setTime: mr.SetTime},
+		{name: "memory", limiter: local, setTime: func(now time.Time) { local.now = func() time.Time { return now } }},
+	}
+}
+
+func allowLevels(t *testing.T, l Limiter, levels ...Level) Decision {
+	t.Helper()
+	d, err := l.AllowN(context.Background(), levels, 1)
+	if err != nil && !errors.Is(err, ErrRateLimitExceeded) {
+		t.Fatalf("allow: %v", err)
+	}
+	if errors.Is(err, ErrRateLimitExceeded) == d.Allowed {
+		t.Fatalf("denial and ErrRateLimitExceeded disagree: %+v %v", d, err)
+	}
+	return d
+}
+
+func allow(t *testing.T, l Limiter, limit Limit) Result {
+	t.Helper()
+	return allowLevels(t, l, Level{Key: "k", Limit: limit}).Levels[0]
+}
+
+func TestConformance_Semantics(t *testing.T) {
+	// rate 1/s, burst 3: the window algorithms count over 3s
+	cases := []struct {
+		algorithm Algorithm
+		retry     time.Duration // After the burst is spent
+	}{
+		{TokenBucket, time.Second},
+		{GCRA, time.Second},
+		{SlidingWindowLog, 3 * time.Second},
+		// The previous window's 3 requests weigh 3 at its end, 2 a second later
+		{SlidingWindowCounter, 4 * time.Second},
+	}
+
+	for _, tc := range cases {
+		for _, b := range backends(t) {
+			t.Run(string(tc.algorithm)+"/"+b.name, func(t *testing.T) {
+				limit := Limit{Algorithm: tc.algorithm, Rate: 1, Burst: 3}
+				b.setTime(epoch)
+
+				for i := 0; i < 3; i++ {
+					res := allow(t, b.limiter, limit)
+					if !res.Allowed || res.Remaining != float64(2-i) {
+						t.Fatalf("request %d: %+v", i, res)
+					}
+				}
+				res := allow(t, b.limiter, limit)
+				if res.Allowed || res.RetryAfter != tc.retry {
+					t.Fatalf("expected denial with retry %v, got %+v", tc.retry, res)
+				}
+
+				b.setTime(epoch.Add(tc.retry - time.Millisecond))
+				if res := allow(t, b.limiter, limit); res.Allowed {
+					t.Fatalf("allowed before retry: %+v", res)
+				}
+
+				b.setTime(epoch.Add(tc.retry))
+				if res := allow(t, b.limiter, limit); !res.Allowed {
+					t.Fatalf("expected a request to pass after retry, got %+v", res)
+				}
+			})
+		}
+	}
+}
+
+// The Redis and in-process forms of every algorithm must agree call for call
+func TestConformance_BackendsAgree(t *testing.T) {
+	for _, algorithm := range Algorithms() {
+		t.Run(string(algorithm), func(t *testing.T) {
+			bs := backends(t)
+			limit := Limit{Algorithm: algorithm, Rate: 2.5, Burst: 4}
+			rng := rand.New(rand.NewSource(1))
+
+			now := epoch
+			for i := 0; i < 200; i++ {
+				now = now.Add(time.Duration(rng.Intn(700)) * time.Millisecond)
+				var want Result
+				for j, b := range bs {
+					b.setTime(now)
+					got := allow(t, b.limiter, limit)
+					if j == 0 {
+						want = got
+					} else if got != want {
+						t.Fatalf("call %d: %s returned %+v, %s returned %+v", i, bs[0].name, want, b.name, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucket_SlowRate(t *testing.T) {
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			limit := Limit{Rate: 0.1, Burst: 1}
+
+			// 0.1 rps with a burst of 1: one request, then a 10s wait
+			b.setTime(epoch)
+			res := allow(t, b.limiter, limit)
+			if !res.Allowed || res.RetryAfter != 10*time.Second || res.ResetAfter != 10*time.Second {
+				t.Fatalf("first request: %+v", res)
+			}
+
+			// 2.5s later a quarter token has accrued
+			b.setTime(epoch.Add(2500 * time.Millisecond))
+			res = allow(t, b.limiter, limit)
+			if res.Allowed || res.Remaining != 0.25 || res.RetryAfter != 7500*time.Millisecond {
+				t.Fatalf("expected 0.25 tokens and 7.5s to go: %+v", res)
+			}
+
+			b.setTime(epoch.Add(10 * time.Second))
+			if res := allow(t, b.limiter, limit); !res.Allowed {
+				t.Fatalf("expected a token after 10s: %+v", res)
+			}
+		})
+	}
+}
+
+// A level that denies must keep the others from spending tokens
+func TestConformance_LevelsAllOrNothing(t *testing.T) {
+	for _, algorithm := range Algorithms() {
+		for _, b := range backends(t) {
+			t.Run(string(algorithm)+"/"+b.name, func(t *testing.T) {
+				b.setTime(epoch)
+				user := Level{Name: "user", Key: "user:a", Limit: Limit{Algorithm: algorithm, Rate: 1, Burst: 5}}
+				tenant := Level{Name: "tenant", Key: "tenant:acme", Limit: Limit{Algorithm: algorithm, Rate: 1, Burst: 2}}
+
+				for i := 0; i < 2; i++ {
+					if d := allowLevels(t, b.limiter, user, tenant); !d.Allowed {
+						t.Fatalf("request %d: %+v", i, d)
+					}
+				}
+				d := allowLevels(t, b.limiter, user, tenant)
+				if d.Allowed || !d.Levels[0].Allowed || d.Levels[1].Allowed || d.Limiting() != 1 {
+					t.Fatalf("expected the tenant level to deny: %+v", d)
+				}
+				if d.Levels[0].Remaining != 3 {
+					t.Fatalf("denied request drained the user level: %+v", d.Levels[0])
+				}
+
+				// The user bucket holds exactly what the two passing requests left
+				if d := allowLevels(t, b.limiter, user); !d.Allowed || d.Levels[0].Remaining != 2 {
+					t.Fatalf("unexpected user bucket %+v", d)
+				}
+			})
+		}
+	}
+}
+
+func TestConformance_WeightedCost(t *testing.T) {
+	ctx := context.Background()
+	for _, algorithm := range Algorithms() {
+		for _, b := range backends(t) {
+			t.Run(string(algorithm)+"/"+b.name, func(t *testing.T) {
+				levels := []Level{{Key: "k", Limit: Limit{Algorithm: algorithm, Rate: 1, Burst: 10}}}
+				b.setTime(epoch)
+
+				d, err := b.limiter.AllowN(ctx, levels, 4)
+				if err != nil || d.Levels[0].Remaining != 6 {
+					t.Fatalf("cost 4: %+v %v", d, err)
+				}
+				// Too expensive: denied and nothing spent
+				d, err = b.limiter.AllowN(ctx, levels, 7)
+				if !errors.Is(err, ErrRateLimitExceeded) || d.Levels[0].Remaining != 6 {
+					t.Fatalf("cost 7: %+v %v", d, err)
+				}
+				// A debit larger than the balance only empties the bucket
+				d, err = b.limiter.Debit(ctx, levels, 20)
+				if err != nil || !d.Allowed || d.Levels[0].Remaining != 0 {
+					t.Fatalf("debit: %+v %v", d, err)
+				}
+				if res := allow(t, b.limiter, levels[0].Limit); res.Allowed {
+					t.Fatalf("expected denial after debit, got %+v", res)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrUnavailable = errors.New("rate limit backend unavailable")
+)
+
+// Limiter is the contract shared by the Redis and in-process limiters
+type Limiter interface {
+	AllowN(ctx context.Context, levels []Level, cost int64) (Decision, error)
+	Debit(ctx context.Context, levels []Level, cost int64) (Decision, error)
+}
+
+// Failover wraps the Redis limiter. Once a call fails it returns ErrUnavailable
+// without touching Redis until the replica heartbeat succeeds again, so callers
+// can fall back (see reliability.FailLocal) without paying a timeout per request.
+type Failover struct {
+	primary Limiter
+	health  *Replicas
+}
+
+func NewFailover(primary Limiter, health *Replicas) *Failover {
+	return &Failover{primary: primary, health: health}
+}
+
+func (f *Failover) Allow(ctx context.Context, levels []Level) (Decision, error) {
+	return f.AllowN(ctx, levels, 1)
+}
+
+func (f *Failover) AllowN(ctx context.Context, levels []Level, cost int64) (Decision, error) {
+	return f.call(ctx, func() (Decision, error) { return f.primary.AllowN(ctx, levels, cost) })
+}
+
+func (f *Failover) Debit(ctx context.Context, levels []Level, cost int64) (Decision, error) {
+	return f.call(ctx, func() (Decision, error) { return f.primary.Debit(ctx, levels, cost) })
+}
+
+func (f *Failover) call(ctx context.Context, fn func() (Decision, error)) (Decision, error) {
+	if !f.health.Healthy() {
+		return Decision{}, ErrUnavailable
+	}
+
+	res, err := fn()
+	if unreachable(ctx, err) {
+		f.health.MarkDown(err)
+	}
+	return res, err
+}
+
+// unreachable reports whether err means Redis could not be reached. Denials,
+// bad limits and errors Redis itself replied with (a script error, say) say
+// nothing about its health.
+func unreachable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ErrRateLimitExceeded) || errors.Is(err, ErrUnknownAlgorithm) || errors.Is(err, ErrNoLevels) {
+		return false
+	}
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
@@ -0,0 +1,73 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// gcraLua keeps the theoretical arrival time (TAT) in microseconds: a request
+// is allowed while it arrives no earlier than TAT minus the burst tolerance,
+// and each allowed request pushes TAT one emission interval on
+const gcraLua = `function(key, burst, rate, cost, now, apply)
+	if rate <= 0 then
+		return 0, 0, -1, -1
+	end
+
+	local interval = 1000000000000 / rate
+	local tolerance = interval * burst
+
+	local tat = tonumber(redis.call("GET", key)) or now
+	tat = math.max(tat, now)
+
+	local allowed = 0
+	local new_tat = tat + interval * cost
+	if now >= new_tat - tolerance then
+		allowed = 1
+		tat = new_tat
+		if apply then
+			redis.call("SET", key, tat, "PX", math.ceil((tat - now) / 1000) + 1000)
+		end
+	end
+
+	local remaining = math.max(0, math.floor((now - tat + tolerance) * rate / 1000000))
+	local retry_after = math.max(0, math.ceil((tat + interval * cost - tolerance - now) / 1000))
+	local reset_after = math.ceil((tat - now) / 1000)
+	return allowed, remaining, retry_after, reset_after
+end`
+
+type gcraBucket struct {
+	tat float64 // Unix microseconds; zero before the first request
+}
+
+func (b *gcraBucket) Take(now time.Time, limit Limit, cost int64, commit bool) Result {
+	rate := float64(microRate(limit.Rate))
+	if rate <= 0 {
+		return Result{RetryAfter: waitDuration(-1), ResetAfter: waitDuration(-1)}
+	}
+
+	us := float64(now.UnixMicro())
+	interval := 1e12 / rate
+	tolerance := interval * float64(limit.Burst)
+
+	tat := math.Max(b.tat, us)
+	res := Result{}
+	if newTAT := tat + interval*float64(cost); us >= newTAT-tolerance {
+		res.Allowed = true
+		tat = newTAT
+		if commit {
+			b.tat = tat
+		}
+	}
+
+	res.Remaining = math.Max(0, math.Floor((us-tat+tolerance)*rate/1e6)) / tokenScale
+	res.RetryAfter = waitDuration(waitMillis(tat + interval*float64(cost) - tolerance - us))
+	res.ResetAfter = waitDuration(waitMillis(tat - us))
+	return res
+}
+
+func init() {
+	Register(GCRA, Implementation{
+		Lua:       gcraLua,
+		NewBucket: func() Bucket { return &gcraBucket{} },
+	})
+}
@@ -3,6 +3,7 @@ package limiter
 import (
 	"context"
 	"errors"
+	"math"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -10,104 +11,175 @@ import (
 
 var (
 	ErrRateLimitExceeded = errors.New("rate limit exceeded")
+	ErrNoLevels          = errors.New("no rate limit levels given")
 )
 
-// luaScript implements the token bucket algorithm atomically
-// KEYS[1] = rate limit key
-// ARGV[1] = capacity (burst size)
-// ARGV[2] = refill rate (tokens per second)
-// ARGV[3] = current timestamp (unix seconds)
-// ARGV[4] = requested tokens
-// Returns: [allowed (1/0), remaining_tokens]
-const luaScript = `
-local key = KEYS[1]
-local capacity = tonumber(ARGV[1])
-local rate = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
-local requested = tonumber(ARGV[4])
-
-local info = redis.call("HMGET", key, "tokens", "last_refill")
-local tokens = tonumber(info[1])
-local last_refill = tonumber(info[2])
-
-if not tokens then
-	tokens = capacity
-	last_refill = now
-end
-
--- Calculate refill
-local delta = math.max(0, now - last_refill)
-local filled = tokens + (delta * rate)
-
-if filled > capacity then
-	filled = capacity
-end
-
-local allowed = 0
-if filled >= requested then
-	allowed = 1
-	filled = filled - requested
-end
-
--- Update state
-redis.call("HMSET", key, "tokens", filled, "last_refill", now)
-redis.call("EXPIRE", key, 60) -- Expire key if unused for 1 minute
-
-return {allowed, filled}
-`
-
-type TokenBucketLimiter struct {
+// Tokens are tracked as integer micro-tokens so fractional balances and slow
+// rates survive Redis, which truncates Lua numbers returned to the client
+const tokenScale = 1_000_000
+
+// Level is one of the limits a request is checked against, such as its
+// user's or its tenant's
+type Level struct {
+	Name  string // e.g. "user", "tenant"; for callers to report
+	Key   string
+	Limit Limit
+}
+
+// Result describes one level's bucket after a call to Allow
+type Result struct {
+	Allowed    bool          // This level alone would allow the request
+	Remaining  float64       // Tokens left in the bucket, fractions included
+	RetryAfter time.Duration // Until the next whole token is available; zero if one is
+	ResetAfter time.Duration // Until the bucket is full again
+}
+
+// Decision is the outcome across all levels. Tokens are only spent when
+// every level allows the request.
+type Decision struct {
+	Allowed bool
+	Levels  []Result // One per level, in the order given
+}
+
+// Limiting returns the index of the level that decided the outcome: the
+// denying level with the longest wait, or else the one with the fewest tokens left
+func (d Decision) Limiting() int {
+	best := 0
+	for i, r := range d.Levels {
+		b := d.Levels[best]
+		switch {
+		case r.Allowed != b.Allowed:
+			if !r.Allowed {
+				best = i
+			}
+		case !r.Allowed:
+			if r.RetryAfter > b.RetryAfter {
+				best = i
+			}
+		case r.Remaining < b.Remaining:
+			best = i
+		}
+	}
+	return best
+}
+
+// RedisLimiter runs the registered algorithms as one Lua script, so every
+// replica shares the same buckets and all levels are settled in a single round trip
+type RedisLimiter struct {
 	client *redis.Client
+	pool   leasePool // Batch mode leases
+	now    func() time.Time
 }
 
-func NewTokenBucketLimiter(client *redis.Client) *TokenBucketLimiter {
-	return &TokenBucketLimiter{client: client}
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+		pool:   leasePool{leases: make(map[string]*lease)},
+		now:    time.Now,
+	}
 }
 
-// Allow checks if the request is allowed.
-// rate: tokens per second
-// burst: maximum capacity
-func (l *TokenBucketLimiter) Allow(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
-	now := time.Now().Unix()
+// Allow takes one token from every level's bucket, or from none of them.
+// A denied request returns its Decision along with ErrRateLimitExceeded.
+func (l *RedisLimiter) Allow(ctx context.Context, levels []Level) (Decision, error) {
+	return l.AllowN(ctx, levels, 1)
+}
 
-	cmd := l.client.Eval(ctx, luaScript, []string{key}, burst, rate, now, 1)
-	result, err := cmd.Result()
-	if err != nil {
-		return false, 0, err
+// AllowN is Allow for a request that costs cost tokens
+func (l *RedisLimiter) AllowN(ctx context.Context, levels []Level, cost int64) (Decision, error) {
+	if leased(levels) {
+		return l.allowLeased(ctx, levels, cost)
+	}
+	d, err := l.run(ctx, levelsScript, levels, cost)
+	if err == nil && !d.Allowed {
+		return d, ErrRateLimitExceeded
 	}
+	return d, err
+}
 
-	resSlice := result.([]interface{})
-	allowed := resSlice[0].(int64) == 1
-	// Parse remaining tokens (interface{} -> string/int64 -> float64 tricky in redis, let's treat as int/float from lua)
-	// Lua numbers are returned as int64 if integer.
-	// But our calculation involves float (rate * delta), so `filled` might be float?
-	// Redis script returns integers if possible?
-
-	// Wait, HMAC returns strings usually. But Eval returns what Lua returns.
-	// tokens + (delta * rate) -> result is number.
-	// If it has decimal, Eval returns int64 (truncated) or error?
-	// Usually better to return string or just use integer math (multiply by 1000?).
-	// For simplicity, let's assume we get int64 for "allowed" and let's see what we get for "filled".
-	// The problem is "filled" needs to be precise for slow rates.
-	// Let's modify Lua script to work with micro-tokens or just return string.
-	// Or simply return integer tokens remaining.
-
-	// Let's cast safely.
-	remainingVal := resSlice[1]
-	var remaining float64
-	switch v := remainingVal.(type) {
-	case int64:
-		remaining = float64(v)
-	default:
-		// If float, might be tricky? Redis usually returns int64 for integers.
-		// Let's rely on basic types.
-		// We'll see in testing.
-		remaining = 0
+// Debit charges cost tokens after the fact, such as when a response reports
+// what a request really cost. Each level gives up what it has left, up to
+// cost; an emptied bucket makes the next requests wait.
+func (l *RedisLimiter) Debit(ctx context.Context, levels []Level, cost int64) (Decision, error) {
+	if leased(levels) {
+		return l.debitLeased(ctx, levels, cost)
 	}
+	return l.run(ctx, debitScript, levels, cost)
+}
+
+// Peek reports the levels' buckets as they are, spending nothing. Tokens
+// leased by replicas in batch mode are not included.
+func (l *RedisLimiter) Peek(ctx context.Context, levels []Level) (Decision, error) {
+	return l.run(ctx, peekScript, levels, 0)
+}
 
-	if !allowed {
-		return false, remaining, ErrRateLimitExceeded
+// Reset refills a bucket by deleting its state under every algorithm, and
+// drops any tokens this instance holds leased from it
+func (l *RedisLimiter) Reset(ctx context.Context, key string) error {
+	keys := make([]string, 0, len(Algorithms()))
+	l.pool.mu.Lock()
+	for _, a := range Algorithms() {
+		k := bucketKey(key, Limit{Algorithm: a})
+		keys = append(keys, k)
+		delete(l.pool.leases, k)
 	}
+	l.pool.mu.Unlock()
+	return l.client.Del(ctx, keys...).Err()
+}
+
+// leased reports whether levels run in batch mode; it takes every level
+func leased(levels []Level) bool {
+	if len(levels) == 0 {
+		return false
+	}
+	for _, lvl := range levels {
+		if lvl.Limit.Lease <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *RedisLimiter) run(ctx context.Context, template string, levels []Level, cost int64) (Decision, error) {
+	if len(levels) == 0 {
+		return Decision{}, ErrNoLevels
+	}
+
+	keys := make([]string, len(levels))
+	args := []interface{}{cost}
+	for i, lvl := range levels {
+		if _, err := lookup(lvl.Limit.algorithm()); err != nil {
+			return Decision{}, err
+		}
+		keys[i] = bucketKey(lvl.Key, lvl.Limit)
+		args = append(args, string(lvl.Limit.algorithm()), lvl.Limit.Burst, microRate(lvl.Limit.Rate))
+	}
+
+	vals, err := composedScript(template).Run(ctx, l.client, keys, args...).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+
+	d := Decision{Allowed: vals[0] == 1, Levels: make([]Result, len(levels))}
+	for i := range levels {
+		v := vals[1+4*i:]
+		d.Levels[i] = Result{
+			Allowed:    v[0] == 1,
+			Remaining:  float64(v[1]) / tokenScale,
+			RetryAfter: waitDuration(v[2]),
+			ResetAfter: waitDuration(v[3]),
+		}
+	}
+	return d, nil
+}
+
+// bucketKey namespaces state by algorithm, so changing a policy's algorithm
+// starts fresh instead of misreading the old algorithm's state
+func bucketKey(key string, limit Limit) string {
+	return key + ":" + string(limit.algorithm())
+}
 
-	return true, remaining, nil
+// microRate converts tokens per second to micro-tokens per second
+func microRate(rate float64) int64 {
+	return int64(math.Round(rate * tokenScale))
 }
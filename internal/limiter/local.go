@@ -0,0 +1,151 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Idle buckets are swept about this often
+const localIdleTTL = time.Minute
+
+type localBucket struct {
+	bucket Bucket
+	idleAt time.Time // Back to its initial state from here on; safe to drop
+}
+
+// LocalLimiter runs the registered algorithms in process. It stands in while
+// Redis is unreachable; each instance only sees its own traffic, so the
+// global rate and burst are divided by the number of live replicas.
+type LocalLimiter struct {
+	replicas *Replicas // nil means a single instance
+
+	mu        sync.Mutex
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLocalLimiter(replicas *Replicas) *LocalLimiter {
+	return &LocalLimiter{
+		replicas:  replicas,
+		buckets:   make(map[string]*localBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow has the same contract as RedisLimiter.Allow, with per-instance limits
+func (l *LocalLimiter) Allow(ctx context.Context, levels []Level) (Decision, error) {
+	return l.AllowN(ctx, levels, 1)
+}
+
+// AllowN has the same contract as RedisLimiter.AllowN, with per-instance limits
+func (l *LocalLimiter) AllowN(ctx context.Context, levels []Level, cost int64) (Decision, error) {
+	if err := checkLevels(levels); err != nil {
+		return Decision{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	// Check every level, then spend on all of them or report untouched state
+	buckets := make([]*localBucket, len(levels))
+	limits := make([]Limit, len(levels))
+	d := Decision{Allowed: true, Levels: make([]Result, len(levels))}
+	for i, lvl := range levels {
+		buckets[i], limits[i] = l.bucket(lvl), l.instanceShare(lvl.Limit)
+		d.Levels[i] = buckets[i].bucket.Take(now, limits[i], cost, false)
+		d.Allowed = d.Allowed && d.Levels[i].Allowed
+	}
+	for i, b := range buckets {
+		switch {
+		case d.Allowed:
+			d.Levels[i] = b.bucket.Take(now, limits[i], cost, true)
+		case d.Levels[i].Allowed:
+			d.Levels[i] = b.bucket.Take(now, limits[i], 0, false)
+		}
+		b.idleAt = now.Add(min(d.Levels[i].ResetAfter, 24*time.Hour))
+	}
+
+	if !d.Allowed {
+		return d, ErrRateLimitExceeded
+	}
+	return d, nil
+}
+
+// Debit has the same contract as RedisLimiter.Debit, with per-instance limits
+func (l *LocalLimiter) Debit(ctx context.Context, levels []Level, cost int64) (Decision, error) {
+	if err := checkLevels(levels); err != nil {
+		return Decision{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	d := Decision{Allowed: true, Levels: make([]Result, len(levels))}
+	for i, lvl := range levels {
+		b, limit := l.bucket(lvl), l.instanceShare(lvl.Limit)
+		d.Levels[i] = b.bucket.Take(now, limit, 0, false)
+		if n := min(cost, int64(math.Floor(d.Levels[i].Remaining))); n > 0 {
+			d.Levels[i] = b.bucket.Take(now, limit, n, true)
+		}
+		b.idleAt = now.Add(min(d.Levels[i].ResetAfter, 24*time.Hour))
+	}
+	return d, nil
+}
+
+func checkLevels(levels []Level) error {
+	if len(levels) == 0 {
+		return ErrNoLevels
+	}
+	for _, lvl := range levels {
+		if _, err := lookup(lvl.Limit.algorithm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bucket returns lvl's bucket, keyed like its Redis bucket so a level that
+// switches algorithms starts afresh. Callers hold l.mu.
+func (l *LocalLimiter) bucket(lvl Level) *localBucket {
+	key := bucketKey(lvl.Key, lvl.Limit)
+	b, ok := l.buckets[key]
+	if !ok {
+		impl, _ := lookup(lvl.Limit.algorithm())
+		b = &localBucket{bucket: impl.NewBucket()}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// instanceShare splits the global limit evenly across replicas; every
+// instance keeps a burst of at least one request
+func (l *LocalLimiter) instanceShare(limit Limit) Limit {
+	n := 1
+	if l.replicas != nil {
+		n = l.replicas.Count()
+	}
+	limit.Rate /= float64(n)
+	limit.Burst = int(math.Max(1, math.Ceil(float64(limit.Burst)/float64(n))))
+	return limit
+}
+
+// sweep drops idle buckets about once per idle TTL. Callers hold l.mu.
+func (l *LocalLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < localIdleTTL {
+		return
+	}
+	for key, b := range l.buckets {
+		if !now.Before(b.idleAt) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,62 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLocalLimiter_SplitsLimitAcrossReplicas(t *testing.T) {
+	replicas := NewReplicas(nil, "test", time.Second)
+	replicas.count = 4
+
+	l := NewLocalLimiter(replicas)
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	// Global burst 10 over 4 replicas leaves 3 (rounded up) for this one
+	for i := 0; i < 3; i++ {
+		if res, err := l.Allow(ctx, []Level{{Key: "k", Limit: Limit{Rate: 4, Burst: 10}}}); !res.Allowed || err != nil {
+			t.Fatalf("request %d: allowed=%v err=%v", i, res.Allowed, err)
+		}
+	}
+	res, err := l.Allow(ctx, []Level{{Key: "k", Limit: Limit{Rate: 4, Burst: 10}}})
+	if res.Allowed || !errors.Is(err, ErrRateLimitExceeded) {
+		t.Fatalf("expected limit, got allowed=%v err=%v", res.Allowed, err)
+	}
+	// Global rate 4/s is 1/s here
+	if res.Levels[0].RetryAfter != time.Second {
+		t.Fatalf("expected retry after 1s, got %v", res.Levels[0].RetryAfter)
+	}
+
+	now = now.Add(time.Second)
+	if res, _ := l.Allow(ctx, []Level{{Key: "k", Limit: Limit{Rate: 4, Burst: 10}}}); !res.Allowed {
+		t.Fatal("expected a token after one second")
+	}
+}
+
+func TestFailover_StopsCallingRedisWhenDown(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:1", MaxRetries: -1})
+	defer rdb.Close()
+
+	replicas := NewReplicas(rdb, "test", time.Second)
+	f := NewFailover(NewRedisLimiter(rdb), replicas)
+
+	ctx := context.Background()
+	if _, err := f.Allow(ctx, []Level{{Key: "k", Limit: Limit{Rate: 1, Burst: 1}}}); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("first call should surface the redis error, got %v", err)
+	}
+	if replicas.Healthy() {
+		t.Fatal("expected redis to be marked down")
+	}
+	if _, err := f.Allow(ctx, []Level{{Key: "k", Limit: Limit{Rate: 1, Burst: 1}}}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if err := replicas.Heartbeat(ctx); err == nil || replicas.Healthy() {
+		t.Fatal("heartbeat against a dead redis must keep it down")
+	}
+}
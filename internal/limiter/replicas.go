@@ -0,0 +1,110 @@
+package limiter
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const replicasKey = "ratelimit:replicas"
+
+// Replicas registers this instance in Redis with a heartbeat and tracks how
+// many instances are alive. The heartbeat doubles as the Redis health probe
+// that decides when rate limiting switches to and back from local buckets.
+type Replicas struct {
+	client     *redis.Client
+	instanceID string
+	ttl        time.Duration // Instances that missed heartbeats for this long are gone
+
+	mu      sync.RWMutex
+	count   int
+	healthy bool
+}
+
+func NewReplicas(client *redis.Client, instanceID string, ttl time.Duration) *Replicas {
+	return &Replicas{
+		client:     client,
+		instanceID: instanceID,
+		ttl:        ttl,
+		count:      1,
+		healthy:    true, // Assume up until a call fails
+	}
+}
+
+// Run sends a heartbeat every interval until ctx is cancelled
+func (r *Replicas) Run(ctx context.Context, interval time.Duration) {
+	r.Heartbeat(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.deregister()
+			return
+		case <-ticker.C:
+			r.Heartbeat(ctx)
+		}
+	}
+}
+
+// Heartbeat refreshes this instance's registration and the live replica count
+func (r *Replicas) Heartbeat(ctx context.Context) error {
+	now := time.Now()
+	var card *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, replicasKey, redis.Z{Score: float64(now.UnixMilli()), Member: r.instanceID})
+		pipe.ZRemRangeByScore(ctx, replicasKey, "-inf", strconv.FormatInt(now.Add(-r.ttl).UnixMilli(), 10))
+		card = pipe.ZCard(ctx, replicasKey)
+		return nil
+	})
+	if err != nil {
+		r.MarkDown(err)
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.healthy {
+		log.Printf("ratelimit: redis recovered, switching back from local limits")
+	}
+	r.healthy = true
+	if n := int(card.Val()); n > 0 {
+		r.count = n
+	}
+	return nil
+}
+
+// MarkDown flags Redis as unavailable until the next successful heartbeat
+func (r *Replicas) MarkDown(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.healthy {
+		log.Printf("ratelimit: redis unavailable, switching to local limits: %v", err)
+	}
+	r.healthy = false
+}
+
+// Healthy reports whether Redis answered the last call
+func (r *Replicas) Healthy() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.healthy
+}
+
+// Count returns the last known number of live replicas (at least 1)
+func (r *Replicas) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.count
+}
+
+func (r *Replicas) deregister() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r.client.ZRem(ctx, replicasKey, r.instanceID)
+}
@@ -0,0 +1,242 @@
+package limiter
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// slidingLogLua stores one sorted set entry per request, scored by its
+// arrival in microseconds; entries older than the window are dropped
+const slidingLogLua = `function(key, burst, rate, cost, now, apply)
+	if rate <= 0 then
+		return 0, 0, -1, -1
+	end
+	local window = burst * 1000000000000 / rate
+
+	redis.call("ZREMRANGEBYSCORE", key, "-inf", now - window)
+	local stored = redis.call("ZCARD", key)
+	local count = stored
+
+	local allowed = 0
+	if count + cost <= burst then
+		allowed = 1
+		count = count + cost
+		if apply then
+			local member = math.floor(now / 1000000) .. "." .. (now % 1000000) .. ":"
+			for i = stored + 1, count do
+				redis.call("ZADD", key, now, member .. i)
+			end
+			redis.call("PEXPIRE", key, math.ceil(window / 1000) + 1000)
+		end
+	end
+
+	-- Time until the entry at a 0-based rank drops out of the window;
+	-- ranks past the stored entries are this request's
+	local function expiry(rank)
+		local score = now
+		if rank < stored then
+			score = tonumber(redis.call("ZRANGE", key, rank, rank, "WITHSCORES")[2])
+		end
+		return math.max(0, math.ceil((score + window - now) / 1000))
+	end
+
+	local retry_after = 0
+	if count + cost > burst then
+		if cost > burst then
+			retry_after = -1
+		else
+			retry_after = expiry(count + cost - burst - 1)
+		end
+	end
+	local reset_after = 0
+	if count > 0 then
+		reset_after = expiry(count - 1)
+	end
+	return allowed, (burst - count) * 1000000, retry_after, reset_after
+end`
+
+type slidingLogBucket struct {
+	entries []float64 // Arrival times in Unix microseconds, oldest first
+}
+
+func (b *slidingLogBucket) Take(now time.Time, limit Limit, cost int64, commit bool) Result {
+	rate := float64(microRate(limit.Rate))
+	if rate <= 0 {
+		return Result{RetryAfter: waitDuration(-1), ResetAfter: waitDuration(-1)}
+	}
+
+	us := float64(now.UnixMicro())
+	burst := int64(limit.Burst)
+	window := float64(limit.Burst) * 1e12 / rate
+
+	// Drop entries at or before now - window, as ZREMRANGEBYSCORE does
+	cut := sort.Search(len(b.entries), func(i int) bool { return b.entries[i] > us-window })
+	b.entries = b.entries[cut:]
+	stored := int64(len(b.entries))
+	count := stored
+
+	res := Result{}
+	if count+cost <= burst {
+		res.Allowed = true
+		count += cost
+		if commit {
+			for i := int64(0); i < cost; i++ {
+				b.entries = append(b.entries, us)
+			}
+		}
+	}
+
+	expiry := func(rank int64) time.Duration {
+		score := us
+		if rank < stored {
+			score = b.entries[rank]
+		}
+		return waitDuration(waitMillis(score + window - us))
+	}
+	if count+cost > burst {
+		if cost > burst {
+			res.RetryAfter = waitDuration(-1)
+		} else {
+			res.RetryAfter = expiry(count + cost - burst - 1)
+		}
+	}
+	if count > 0 {
+		res.ResetAfter = expiry(count - 1)
+	}
+	res.Remaining = float64(burst - count)
+	return res
+}
+
+// slidingCounterLua keeps counts for the current and previous fixed windows
+// and weights the previous one by how much of it still overlaps
+const slidingCounterLua = `function(key, burst, rate, cost, now, apply)
+	if rate <= 0 then
+		return 0, 0, -1, -1
+	end
+	local window = burst * 1000000000000 / rate
+
+	local index = math.floor(now / window)
+	local elapsed = now - index * window
+
+	local info = redis.call("HMGET", key, "index", "curr", "prev")
+	local stored = tonumber(info[1])
+	local curr = tonumber(info[2]) or 0
+	local prev = tonumber(info[3]) or 0
+	if stored == index - 1 then
+		prev = curr
+		curr = 0
+	elseif stored ~= index then
+		prev = 0
+		curr = 0
+	end
+
+	local estimate = prev * (window - elapsed) / window + curr
+
+	local allowed = 0
+	if estimate + cost <= burst then
+		allowed = 1
+		curr = curr + cost
+		estimate = estimate + cost
+		if apply then
+			redis.call("HSET", key, "index", index, "curr", curr, "prev", prev)
+			redis.call("PEXPIRE", key, math.ceil(2 * window / 1000) + 1000)
+		end
+	end
+
+	-- Milliseconds until the estimate leaves room for cost
+	local function millis(us)
+		return math.max(0, math.ceil(us / 1000))
+	end
+
+	local retry_after = 0
+	if estimate + cost > burst then
+		if cost > burst then
+			retry_after = -1
+		elseif curr + cost <= burst then
+			retry_after = millis(window - (burst - curr - cost) * window / prev - elapsed)
+		else
+			retry_after = millis(window - elapsed + window - (burst - cost) * window / curr)
+		end
+	end
+
+	local reset_after = 0
+	if curr > 0 then
+		reset_after = millis(2 * window - elapsed)
+	elseif prev > 0 then
+		reset_after = millis(window - elapsed)
+	end
+
+	return allowed, math.max(0, math.floor((burst - estimate) * 1000000)), retry_after, reset_after
+end`
+
+type slidingCounterBucket struct {
+	index      float64
+	curr, prev float64
+}
+
+func (b *slidingCounterBucket) Take(now time.Time, limit Limit, cost int64, commit bool) Result {
+	rate := float64(microRate(limit.Rate))
+	if rate <= 0 {
+		return Result{RetryAfter: waitDuration(-1), ResetAfter: waitDuration(-1)}
+	}
+
+	us := float64(now.UnixMicro())
+	burst := float64(limit.Burst)
+	n := float64(cost)
+	window := burst * 1e12 / rate
+
+	index := math.Floor(us / window)
+	elapsed := us - index*window
+
+	curr, prev := b.curr, b.prev
+	switch b.index {
+	case index:
+	case index - 1:
+		prev, curr = curr, 0
+	default:
+		prev, curr = 0, 0
+	}
+
+	estimate := prev*(window-elapsed)/window + curr
+
+	res := Result{}
+	if estimate+n <= burst {
+		res.Allowed = true
+		curr += n
+		estimate += n
+		if commit {
+			b.index, b.curr, b.prev = index, curr, prev
+		}
+	}
+
+	if estimate+n > burst {
+		switch {
+		case n > burst:
+			res.RetryAfter = waitDuration(-1)
+		case curr+n <= burst:
+			res.RetryAfter = waitDuration(waitMillis(window - (burst-curr-n)*window/prev - elapsed))
+		default:
+			res.RetryAfter = waitDuration(waitMillis(window - elapsed + window - (burst-n)*window/curr))
+		}
+	}
+	switch {
+	case curr > 0:
+		res.ResetAfter = waitDuration(waitMillis(2*window - elapsed))
+	case prev > 0:
+		res.ResetAfter = waitDuration(waitMillis(window - elapsed))
+	}
+	res.Remaining = math.Max(0, math.Floor((burst-estimate)*1e6)) / tokenScale
+	return res
+}
+
+func init() {
+	Register(SlidingWindowLog, Implementation{
+		Lua:       slidingLogLua,
+		NewBucket: func() Bucket { return &slidingLogBucket{} },
+	})
+	Register(SlidingWindowCounter, Implementation{
+		Lua:       slidingCounterLua,
+		NewBucket: func() Bucket { return &slidingCounterBucket{} },
+	})
+}
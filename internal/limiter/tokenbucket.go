@@ -0,0 +1,101 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// tokenBucketLua refills in whole micro-tokens per elapsed millisecond
+const tokenBucketLua = `function(key, burst, rate, cost, now, apply)
+	local capacity = burst * 1000000
+	local requested = cost * 1000000
+	now = math.floor(now / 1000)
+
+	local info = redis.call("HMGET", key, "tokens", "last_refill")
+	local tokens = tonumber(info[1])
+	local last_refill = tonumber(info[2])
+	if not tokens then
+		tokens = capacity
+		last_refill = now
+	end
+
+	local delta = math.max(0, now - last_refill)
+	local filled = math.min(capacity, tokens + math.floor(delta * rate / 1000))
+
+	local allowed = 0
+	if filled >= requested then
+		allowed = 1
+		filled = filled - requested
+	end
+
+	-- Milliseconds until a given balance is reached
+	local function wait(target)
+		if filled >= target then
+			return 0
+		end
+		if rate <= 0 then
+			return -1
+		end
+		return math.ceil((target - filled) * 1000 / rate)
+	end
+	local retry_after = wait(requested)
+	local reset_after = wait(capacity)
+
+	-- An idle bucket expires once it would be full anyway
+	if apply and allowed == 1 then
+		redis.call("HSET", key, "tokens", filled, "last_refill", now)
+		if reset_after >= 0 then
+			redis.call("PEXPIRE", key, reset_after + 1000)
+		end
+	end
+	return allowed, filled, retry_after, reset_after
+end`
+
+type tokenBucket struct {
+	tokens     int64 // Micro-tokens
+	lastRefill int64 // Unix milliseconds
+	started    bool
+}
+
+func (b *tokenBucket) Take(now time.Time, limit Limit, cost int64, commit bool) Result {
+	capacity := int64(limit.Burst) * tokenScale
+	rate := microRate(limit.Rate)
+	requested := cost * tokenScale
+	ms := now.UnixMilli()
+
+	tokens, last := b.tokens, b.lastRefill
+	if !b.started {
+		tokens, last = capacity, ms
+	}
+	delta := max(0, ms-last)
+	filled := min(capacity, tokens+int64(math.Floor(float64(delta)*float64(rate)/1000)))
+
+	res := Result{Allowed: filled >= requested}
+	if res.Allowed {
+		filled -= requested
+		if commit {
+			b.tokens, b.lastRefill, b.started = filled, ms, true
+		}
+	}
+
+	wait := func(target int64) time.Duration {
+		if filled >= target {
+			return 0
+		}
+		if rate <= 0 {
+			return waitDuration(-1)
+		}
+		return waitDuration(int64(math.Ceil(float64(target-filled) * 1000 / float64(rate))))
+	}
+	res.Remaining = float64(filled) / tokenScale
+	res.RetryAfter = wait(requested)
+	res.ResetAfter = wait(capacity)
+	return res
+}
+
+func init() {
+	Register(TokenBucket, Implementation{
+		Lua:       tokenBucketLua,
+		NewBucket: func() Bucket { return &tokenBucket{} },
+	})
+}
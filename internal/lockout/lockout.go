@@ -0,0 +1,263 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrUnknownKind = errors.New("unknown lockout kind")
+)
+
+// Kinds of subject that failed attempts are counted against
+const (
+	KindIP        = "ip"
+	KindKeyPrefix = "key_prefix" // Per client IP, see KeyPrefix
+)
+
+// Block states
+const (
+	StateNone    = ""
+	StateBackoff = "backoff"
+	StateLocked  = "lockout"
+)
+
+// Redis Keys:
+// authfail:{kind}:{value} -> failure count within Window
+// authblock:{kind}:{value} -> "backoff" or "lockout" with TTL = remaining block time
+// authlock:index -> ZSET of "{kind}:{value}" scored by lockout expiry (unix ms)
+const indexKey = "authlock:index"
+
+// recordScript counts a failure and applies backoff or lockout atomically.
+// KEYS[1] = failure counter, KEYS[2] = block key, KEYS[3] = lockout index
+// ARGV[1] = window ms, ARGV[2] = backoff after, ARGV[3] = base backoff ms,
+// ARGV[4] = max backoff ms, ARGV[5] = lockout after, ARGV[6] = lockout ms,
+// ARGV[7] = index member, ARGV[8] = now ms
+// Returns: [failures, state, block ttl ms]
+const recordScript = `
+local failures = redis.call("INCR", KEYS[1])
+if failures == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+
+local backoff_after = tonumber(ARGV[2])
+local lockout_after = tonumber(ARGV[5])
+
+if failures >= lockout_after then
+	local ttl = tonumber(ARGV[6])
+	redis.call("SET", KEYS[2], "lockout", "PX", ttl)
+	redis.call("ZADD", KEYS[3], tonumber(ARGV[8]) + ttl, ARGV[7])
+	return {failures, "lockout", ttl}
+end
+
+if failures >= backoff_after then
+	local delay = tonumber(ARGV[3]) * math.pow(2, failures - backoff_after)
+	delay = math.min(delay, tonumber(ARGV[4]))
+	redis.call("SET", KEYS[2], "backoff", "PX", math.floor(delay))
+	return {failures, "backoff", math.floor(delay)}
+end
+
+return {failures, "", 0}
+`
+
+// Config controls thresholds for failed authentication attempts
+type Config struct {
+	Window          time.Duration // Failures older than this are forgotten
+	BackoffAfter    int64         // Failures before progressive backoff starts
+	BaseBackoff     time.Duration // First backoff delay, doubled per further failure
+	MaxBackoff      time.Duration
+	LockoutAfter    int64 // Failures before a temporary lockout
+	LockoutDuration time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Window:          15 * time.Minute,
+		BackoffAfter:    5,
+		BaseBackoff:     time.Second,
+		MaxBackoff:      30 * time.Second,
+		LockoutAfter:    20,
+		LockoutDuration: 15 * time.Minute,
+	}
+}
+
+// Subject identifies who failed: a client IP, or an API key prefix tried
+// from one client IP
+type Subject struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// KeyPrefix returns the subject for attempts on an API key prefix from ip,
+// valued "<prefix>@<ip>". Prefixes are counted per client so that guessing
+// keys with someone's prefix locks out the guesser, not the key's owner.
+func KeyPrefix(prefix, ip string) Subject {
+	return Subject{Kind: KindKeyPrefix, Value: prefix + "@" + ip}
+}
+
+func (s Subject) member() string {
+	return s.Kind + ":" + s.Value
+}
+
+// Decision is the outcome of a check
+type Decision struct {
+	State      string        // StateNone, StateBackoff or StateLocked
+	Subject    Subject       // The subject that is blocked
+	RetryAfter time.Duration // Remaining block time
+}
+
+// Blocked reports whether the request must be rejected
+func (d Decision) Blocked() bool {
+	return d.State != StateNone
+}
+
+// Lockout is an active lockout, as listed for admins
+type Lockout struct {
+	Subject
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Guard counts failed authentication attempts in Redis
+type Guard struct {
+	client *redis.Client
+	cfg    Config
+	logger audit.Logger
+}
+
+func New(client *redis.Client, cfg Config, logger audit.Logger) *Guard {
+	return &Guard{client: client, cfg: cfg, logger: logger}
+}
+
+// Check returns the strictest block currently applied to any of the subjects
+func (g *Guard) Check(ctx context.Context, subjects ...Subject) (Decision, error) {
+	pipe := g.client.Pipeline()
+	states := make([]*redis.StringCmd, len(subjects))
+	ttls := make([]*redis.DurationCmd, len(subjects))
+	for i, s := range subjects {
+		states[i] = pipe.Get(ctx, blockKey(s))
+		ttls[i] = pipe.PTTL(ctx, blockKey(s))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return Decision{}, err
+	}
+
+	var d Decision
+	for i, s := range subjects {
+		state, err := states[i].Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return Decision{}, err
+		}
+		ttl := ttls[i].Val()
+		if ttl < 0 {
+			continue
+		}
+		// Lockout beats backoff; otherwise keep the longest wait
+		if d.State == StateLocked && state != StateLocked {
+			continue
+		}
+		if state == StateLocked && d.State != StateLocked || ttl > d.RetryAfter {
+			d = Decision{State: state, Subject: s, RetryAfter: ttl}
+		}
+	}
+	return d, nil
+}
+
+// RecordFailure counts a failed attempt against each subject.
+// Newly started lockouts are written to the audit log.
+func (g *Guard) RecordFailure(ctx context.Context, subjects ...Subject) error {
+	now := time.Now()
+	for _, s := range subjects {
+		res, err := g.client.Eval(ctx, recordScript,
+			[]string{failKey(s), blockKey(s), indexKey},
+			g.cfg.Window.Milliseconds(), g.cfg.BackoffAfter, g.cfg.BaseBackoff.Milliseconds(),
+			g.cfg.MaxBackoff.Milliseconds(), g.cfg.LockoutAfter, g.cfg.LockoutDuration.Milliseconds(),
+			s.member(), now.UnixMilli(),
+		).Slice()
+		if err != nil {
+			return err
+		}
+
+		failures, _ := res[0].(int64)
+		state, _ := res[1].(string)
+		// Locked subjects are rejected before verification, so a failure
+		// returning "lockout" always starts a new one
+		if state == StateLocked {
+			g.logger.Log(audit.LogEntry{
+				Timestamp: now,
+				Action:    "auth_lockout",
+				ActorID:   "system",
+				Resource:  "lockout:" + s.member(),
+				Status:    403,
+				Metadata: map[string]interface{}{
+					"kind":       s.Kind,
+					"subject":    s.Value,
+					"failures":   failures,
+					"expires_at": now.Add(g.cfg.LockoutDuration),
+				},
+			})
+		}
+	}
+	return nil
+}
+
+// RecordSuccess forgets earlier failures for a subject (used for key prefixes;
+// IP counters are kept so valid keys can't mask credential stuffing)
+func (g *Guard) RecordSuccess(ctx context.Context, s Subject) error {
+	return g.client.Del(ctx, failKey(s)).Err()
+}
+
+// List returns active lockouts
+func (g *Guard) List(ctx context.Context) ([]Lockout, error) {
+	now := time.Now().UnixMilli()
+	if err := g.client.ZRemRangeByScore(ctx, indexKey, "-inf", strconv.FormatInt(now, 10)).Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := g.client.ZRangeWithScores(ctx, indexKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Lockout, 0, len(entries))
+	for _, e := range entries {
+		member, _ := e.Member.(string)
+		kind, value, ok := strings.Cut(member, ":")
+		if !ok {
+			continue
+		}
+		list = append(list, Lockout{
+			Subject:   Subject{Kind: kind, Value: value},
+			ExpiresAt: time.UnixMilli(int64(e.Score)),
+		})
+	}
+	return list, nil
+}
+
+// Clear lifts any backoff or lockout on a subject and resets its failure count
+func (g *Guard) Clear(ctx context.Context, s Subject) error {
+	if s.Kind != KindIP && s.Kind != KindKeyPrefix {
+		return ErrUnknownKind
+	}
+	pipe := g.client.TxPipeline()
+	pipe.Del(ctx, failKey(s), blockKey(s))
+	pipe.ZRem(ctx, indexKey, s.member())
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func failKey(s Subject) string {
+	return "authfail:" + s.member()
+}
+
+func blockKey(s Subject) string {
+	return "authblock:" + s.member()
+}
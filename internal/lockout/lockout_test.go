@@ -0,0 +1,188 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/redis/go-redis/v9"
+)
+
+type recordingLogger struct {
+	entries []audit.LogEntry
+}
+
+func (l *recordingLogger) Log(e audit.LogEntry) {
+	l.entries = append(l.entries, e)
+}
+
+func newTestGuard(t *testing.T) (*Guard, *miniredis.Miniredis, *recordingLogger) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	logger := &recordingLogger{}
+	cfg := Config{
+		Window:          time.Minute,
+		BackoffAfter:    2,
+		BaseBackoff:     time.Second,
+		MaxBackoff:      4 * time.Second,
+		LockoutAfter:    5,
+		LockoutDuration: time.Hour,
+	}
+	return New(rdb, cfg, logger), mr, logger
+}
+
+func TestGuard_BackoffGrowsThenLocks(t *testing.T) {
+	ctx := context.Background()
+	g, _, logger := newTestGuard(t)
+	ip := Subject{Kind: KindIP, Value: "203.0.113.7"}
+
+	// One failure is free
+	if err := g.RecordFailure(ctx, ip); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := g.Check(ctx, ip); err != nil || d.Blocked() {
+		t.Fatalf("Expected no block after one failure, got %+v, %v", d, err)
+	}
+
+	// Backoff doubles from the base and stops at the maximum
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if err := g.RecordFailure(ctx, ip); err != nil {
+			t.Fatal(err)
+		}
+		d, err := g.Check(ctx, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.State != StateBackoff || d.RetryAfter != want {
+			t.Fatalf("Expected a %v backoff, got %+v", want, d)
+		}
+	}
+
+	// The fifth failure locks the subject out and is audited
+	if err := g.RecordFailure(ctx, ip); err != nil {
+		t.Fatal(err)
+	}
+	d, err := g.Check(ctx, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.State != StateLocked || d.RetryAfter != time.Hour || d.Subject != ip {
+		t.Fatalf("Expected a one hour lockout, got %+v", d)
+	}
+	if len(logger.entries) != 1 || logger.entries[0].Action != "auth_lockout" {
+		t.Fatalf("Expected one auth_lockout audit entry, got %+v", logger.entries)
+	}
+	list, err := g.List(ctx)
+	if err != nil || len(list) != 1 || list[0].Subject != ip {
+		t.Fatalf("Expected the lockout listed, got %+v, %v", list, err)
+	}
+}
+
+func TestGuard_LockoutBeatsLongerBackoff(t *testing.T) {
+	ctx := context.Background()
+	g, mr, _ := newTestGuard(t)
+	ip := Subject{Kind: KindIP, Value: "203.0.113.7"}
+	prefix := KeyPrefix("ak_1234", "192.0.2.1")
+
+	for i := 0; i < 5; i++ {
+		g.RecordFailure(ctx, prefix)
+	}
+	mr.Set(blockKey(ip), StateBackoff)
+	mr.SetTTL(blockKey(ip), 2*time.Hour)
+
+	d, err := g.Check(ctx, ip, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.State != StateLocked || d.Subject != prefix {
+		t.Fatalf("Expected the key prefix lockout, got %+v", d)
+	}
+}
+
+func TestGuard_SuccessResetsFailures(t *testing.T) {
+	ctx := context.Background()
+	g, mr, _ := newTestGuard(t)
+	prefix := KeyPrefix("ak_1234", "192.0.2.1")
+
+	g.RecordFailure(ctx, prefix)
+	if err := g.RecordSuccess(ctx, prefix); err != nil {
+		t.Fatal(err)
+	}
+	// Counting starts over, so the next failure is free again
+	g.RecordFailure(ctx, prefix)
+	if d, _ := g.Check(ctx, prefix); d.Blocked() {
+		t.Fatalf("Expected no block after a success reset the count, got %+v", d)
+	}
+
+	// Clear lifts an active block too
+	g.RecordFailure(ctx, prefix)
+	if d, _ := g.Check(ctx, prefix); d.State != StateBackoff {
+		t.Fatalf("Expected a backoff, got %+v", d)
+	}
+	if err := g.Clear(ctx, prefix); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := g.Check(ctx, prefix); d.Blocked() {
+		t.Fatalf("Expected Clear to lift the block, got %+v", d)
+	}
+	if mr.Exists(failKey(prefix)) {
+		t.Fatal("Expected Clear to reset the failure count")
+	}
+	if err := g.Clear(ctx, Subject{Kind: "user", Value: "bob"}); err != ErrUnknownKind {
+		t.Fatalf("Expected ErrUnknownKind, got %v", err)
+	}
+}
+
+func TestGuard_Expiry(t *testing.T) {
+	ctx := context.Background()
+	g, mr, _ := newTestGuard(t)
+	ip := Subject{Kind: KindIP, Value: "203.0.113.7"}
+
+	// Blocks lapse with their TTL
+	g.RecordFailure(ctx, ip)
+	g.RecordFailure(ctx, ip)
+	mr.FastForward(time.Second)
+	if d, _ := g.Check(ctx, ip); d.Blocked() {
+		t.Fatalf("Expected the backoff to have lapsed, got %+v", d)
+	}
+
+	// Failures older than the window are forgotten
+	mr.FastForward(time.Minute)
+	g.RecordFailure(ctx, ip)
+	if d, _ := g.Check(ctx, ip); d.Blocked() {
+		t.Fatalf("Expected the failure window to have reset, got %+v", d)
+	}
+
+	// Lockouts lapse too
+	for i := 0; i < 5; i++ {
+		g.RecordFailure(ctx, ip)
+	}
+	if d, _ := g.Check(ctx, ip); d.State != StateLocked {
+		t.Fatalf("Expected a lockout, got %+v", d)
+	}
+	mr.FastForward(time.Hour)
+	if d, _ := g.Check(ctx, ip); d.Blocked() {
+		t.Fatalf("Expected the lockout to have lapsed, got %+v", d)
+	}
+}
+
+func TestGuard_KeyPrefixPerClient(t *testing.T) {
+	ctx := context.Background()
+	g, _, _ := newTestGuard(t)
+	attacker, owner := KeyPrefix("ak_1234", "198.51.100.7"), KeyPrefix("ak_1234", "192.0.2.1")
+
+	for i := 0; i < 5; i++ {
+		g.RecordFailure(ctx, attacker)
+	}
+	if d, _ := g.Check(ctx, attacker); d.State != StateLocked {
+		t.Fatalf("Expected the guessing client to be locked out, got %+v", d)
+	}
+	if d, _ := g.Check(ctx, owner); d.Blocked() {
+		t.Fatalf("Expected the key's owner to be unaffected, got %+v", d)
+	}
+}
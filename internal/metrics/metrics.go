@@ -18,6 +18,17 @@ type MetricsCollector struct {
 	latencies  []time.Duration
 	maxSamples int
 	mu         sync.RWMutex
+
+	// Timestamped samples for controllers that react to current conditions
+	recent []sample
+	gauges map[string]float64
+}
+
+type sample struct {
+	at       time.Time
+	duration time.Duration
+	status   int
+	policyID string
 }
 
 func NewCollector(maxSamples int) *MetricsCollector {
@@ -25,10 +36,15 @@ func NewCollector(maxSamples int) *MetricsCollector {
 		StatusCounts: make(map[int]uint64),
 		latencies:    make([]time.Duration, 0, maxSamples),
 		maxSamples:   maxSamples,
+		recent:       make([]sample, 0, maxSamples),
+		gauges:       make(map[string]float64),
 	}
 }
 
-func (c *MetricsCollector) Record(duration time.Duration, statusCode int) {
+// Record counts a request served under policyID. Only responses from the
+// upstream are sampled for Recent: the gateway's own rejections, such as
+// 429s or an open breaker's 503s, say nothing about the upstream's health.
+func (c *MetricsCollector) Record(duration time.Duration, statusCode int, policyID string, upstream bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -48,6 +64,66 @@ func (c *MetricsCollector) Record(duration time.Duration, statusCode int) {
 		c.latencies = c.latencies[1:]
 		c.latencies = append(c.latencies, duration)
 	}
+
+	if !upstream {
+		return
+	}
+	if len(c.recent) == c.maxSamples {
+		c.recent = c.recent[1:]
+	}
+	c.recent = append(c.recent, sample{at: time.Now(), duration: duration, status: statusCode, policyID: policyID})
+}
+
+// Signals summarizes the requests sampled within the last window
+type Signals struct {
+	Samples   int
+	P99       time.Duration
+	ErrorRate float64 // Share of 5xx responses
+}
+
+// Recent returns the signals of upstream responses to requests under
+// policyID recorded within window
+func (c *MetricsCollector) Recent(policyID string, window time.Duration) Signals {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cutoff := time.Now().Add(-window)
+	var durations []time.Duration
+	failed := 0
+	for _, s := range c.recent {
+		if s.policyID != policyID || s.at.Before(cutoff) {
+			continue
+		}
+		durations = append(durations, s.duration)
+		if s.status >= 500 {
+			failed++
+		}
+	}
+	if len(durations) == 0 {
+		return Signals{}
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	idx99 := min(int(float64(len(durations))*0.99), len(durations)-1)
+	return Signals{
+		Samples:   len(durations),
+		P99:       durations[idx99],
+		ErrorRate: float64(failed) / float64(len(durations)),
+	}
+}
+
+// SetGauge records the current value of a named measurement, reported by GetStats
+func (c *MetricsCollector) SetGauge(name string, value float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gauges[name] = value
+}
+
+// DeleteGauge stops reporting a gauge
+func (c *MetricsCollector) DeleteGauge(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.gauges, name)
 }
 
 // Snapshot returns calculated stats
@@ -59,6 +135,8 @@ type Stats struct {
 	P95Latency    string         `json:"p95_latency"`
 	P99Latency    string         `json:"p99_latency"`
 	StatusCounts  map[int]uint64 `json:"status_counts"`
+
+	Gauges map[string]float64 `json:"gauges,omitempty"`
 }
 
 func (c *MetricsCollector) GetStats() Stats {
@@ -104,6 +182,10 @@ func (c *MetricsCollector) GetStats() Stats {
 	for k, v := range c.StatusCounts {
 		sc[k] = v
 	}
+	gauges := make(map[string]float64, len(c.gauges))
+	for k, v := range c.gauges {
+		gauges[k] = v
+	}
 
 	return Stats{
 		TotalRequests: c.TotalRequests,
@@ -113,5 +195,6 @@ func (c *MetricsCollector) GetStats() Stats {
 		P95Latency:    p95.String(),
 		P99Latency:    p99.String(),
 		StatusCounts:  sc,
+		Gauges:        gauges,
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
 )
 
 func AuditMiddleware(logger audit.Logger) Middleware {
@@ -18,24 +19,24 @@ func AuditMiddleware(logger audit.Logger) Middleware {
 				statusCode:     http.StatusOK, // Default
 			}
 
-			next.ServeHTTP(rw, r)
+			ctx, slot := withPrincipalSlot(r.Context())
+			next.ServeHTTP(rw, r.WithContext(ctx))
 
-			// Extract Actor (from Auth context)
-			actorID := "anonymous"
-			if u, ok := r.Context().Value(UserContextKey).(string); ok {
-				actorID = u
+			// Extract Actor and Tenant (filled in by Auth further down the chain)
+			actorID, onBehalfOf := Actor(*slot)
+			tenantID := auth.DefaultTenant
+			if *slot != nil {
+				tenantID = (*slot).Tenant()
 			}
 
-			// Tenant? (Mock: "default" or from context)
-			tenantID := "default"
-
 			entry := audit.LogEntry{
-				Timestamp: start,
-				TenantID:  tenantID,
-				ActorID:   actorID,
-				Action:    r.Method + " " + r.URL.Path,
-				Resource:  r.URL.Path,
-				Status:    rw.statusCode,
+				Timestamp:  start,
+				TenantID:   tenantID,
+				ActorID:    actorID,
+				OnBehalfOf: onBehalfOf,
+				Action:     r.Method + " " + r.URL.Path,
+				Resource:   r.URL.Path,
+				Status:     rw.statusCode,
 				Metadata: map[string]interface{}{
 					"remote_addr": r.RemoteAddr,
 					"duration_ms": time.Since(start).Milliseconds(),
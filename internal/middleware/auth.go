@@ -2,26 +2,43 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/lockout"
 )
 
 type ContextKey string
 
 const (
-	UserContextKey ContextKey = "user"
+	UserContextKey      ContextKey = "user"
+	PrincipalContextKey ContextKey = "principal"
+	TenantContextKey    ContextKey = "tenant"
+
+	// Set by outer middleware (audit) to learn the principal resolved further in
+	principalSlotKey ContextKey = "principal_slot"
 )
 
 type AuthProvider interface {
-	VerifyAPIKey(ctx context.Context, key string) (string, error) // Returns UserID
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// UserChecker rejects principals whose account was disabled or deleted
+type UserChecker interface {
+	CheckActive(ctx context.Context, p *auth.Principal) error
 }
 
 type AuthMiddleware struct {
 	jwtManager *auth.JWTManager
 	provider   AuthProvider
+	certMapper *auth.CertMapper // nil disables client certificate auth
+	guard      *lockout.Guard   // nil disables failed-attempt tracking
+	users      UserChecker      // nil skips the account status check
 }
 
 func NewAuth(jwtManager *auth.JWTManager, provider AuthProvider) *AuthMiddleware {
@@ -31,6 +48,24 @@ func NewAuth(jwtManager *auth.JWTManager, provider AuthProvider) *AuthMiddleware
 	}
 }
 
+// WithCertMapper enables authentication via verified TLS client certificates
+func (m *AuthMiddleware) WithCertMapper(mapper *auth.CertMapper) *AuthMiddleware {
+	m.certMapper = mapper
+	return m
+}
+
+// WithLockout enables brute-force protection for API key authentication
+func (m *AuthMiddleware) WithLockout(guard *lockout.Guard) *AuthMiddleware {
+	m.guard = guard
+	return m
+}
+
+// WithUserStatus rejects every credential of disabled or deleted users
+func (m *AuthMiddleware) WithUserStatus(users UserChecker) *AuthMiddleware {
+	m.users = users
+	return m
+}
+
 func (m *AuthMiddleware) Handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 1. Check Policy
@@ -41,7 +76,6 @@ func (m *AuthMiddleware) Handle(next http.Handler) http.Handler {
 
 		// 2. Extract Token
 		var tokenStr string
-		var apiKeyUserID string // To store userID if authenticated via API Key
 
 		// Check Authorization Header for Bearer token
 		authHeader := r.Header.Get("Authorization")
@@ -51,23 +85,48 @@ func (m *AuthMiddleware) Handle(next http.Handler) http.Handler {
 			// Check API Key Header
 			apiKey := r.Header.Get("X-API-Key")
 			if apiKey != "" {
+				subjects := []lockout.Subject{
+					{Kind: lockout.KindIP, Value: clientIP(r)},
+					lockout.KeyPrefix(auth.KeyPrefix(apiKey), clientIP(r)),
+				}
+				if m.rejectLockedOut(w, r, subjects) {
+					return
+				}
+
 				// Validate API Key using the middleware's provider
-				var err error
-				apiKeyUserID, err = m.provider.VerifyAPIKey(r.Context(), apiKey)
+				principal, err := m.provider.AuthenticateAPIKey(r.Context(), apiKey)
 				if err != nil {
-					// Simulating a delay to prevent timing attacks (basic)
-					time.Sleep(100 * time.Millisecond)
+					if m.guard != nil {
+						if gerr := m.guard.RecordFailure(r.Context(), subjects...); gerr != nil {
+							log.Printf("lockout: record failure: %v", gerr)
+						}
+					}
 					http.Error(w, "Unauthorized: invalid API key", http.StatusUnauthorized)
 					return
 				}
-				// If API Key is valid, inject UserID and proceed immediately
-				ctx := context.WithValue(r.Context(), UserContextKey, apiKeyUserID)
-				next.ServeHTTP(w, r.WithContext(ctx))
+				if m.guard != nil {
+					if gerr := m.guard.RecordSuccess(r.Context(), subjects[1]); gerr != nil {
+						log.Printf("lockout: record success: %v", gerr)
+					}
+				}
+				// If API Key is valid, inject principal and proceed immediately
+				m.serve(w, r, next, principal)
 				return
 			}
 		}
 
-		// 3. Handle Missing Token (if not already handled by API Key)
+		// 3. Client Certificate (mTLS), only when no explicit credential was sent
+		if tokenStr == "" && m.certMapper != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			principal, err := m.certMapper.Map(r.TLS.VerifiedChains[0][0])
+			if err != nil {
+				http.Error(w, "Unauthorized: client certificate not recognized", http.StatusUnauthorized)
+				return
+			}
+			m.serve(w, r, next, principal)
+			return
+		}
+
+		// 4. Handle Missing Token (if not already handled by API Key)
 		if tokenStr == "" {
 			if authRequired {
 				http.Error(w, "Unauthorized: missing credentials", http.StatusUnauthorized)
@@ -78,7 +137,7 @@ func (m *AuthMiddleware) Handle(next http.Handler) http.Handler {
 			return
 		}
 
-		// 4. Verify JWT (if Bearer token found)
+		// 5. Verify JWT (if Bearer token found)
 		claims, err := m.jwtManager.Verify(tokenStr)
 		if err != nil {
 			http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
@@ -86,7 +145,112 @@ func (m *AuthMiddleware) Handle(next http.Handler) http.Handler {
 		}
 
 		// Inject user into context and proceed
-		ctx := context.WithValue(r.Context(), UserContextKey, claims.UserID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		principal := &auth.Principal{
+			ID:       claims.UserID,
+			Type:     auth.PrincipalUser,
+			Scopes:   claims.Scopes,
+			Method:   auth.MethodJWT,
+			TenantID: claims.TenantID,
+			Claims:   claims.All,
+		}
+		if claims.Actor != nil {
+			principal.ActorID = claims.Actor.Subject
+		}
+		m.serve(w, r, next, principal)
 	})
 }
+
+// serve checks the principal's account status and passes the request on with it
+func (m *AuthMiddleware) serve(w http.ResponseWriter, r *http.Request, next http.Handler, p *auth.Principal) {
+	if m.users != nil {
+		if err := m.users.CheckActive(r.Context(), p); err != nil {
+			if errors.Is(err, auth.ErrUnknownUser) || errors.Is(err, auth.ErrUserDisabled) {
+				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			log.Printf("auth: user status check failed: %v", err)
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+}
+
+// rejectLockedOut writes 429 (backoff) or 403 (lockout) if any subject is blocked.
+// Redis errors fail open: brute-force protection must not take down authentication.
+func (m *AuthMiddleware) rejectLockedOut(w http.ResponseWriter, r *http.Request, subjects []lockout.Subject) bool {
+	if m.guard == nil {
+		return false
+	}
+
+	d, err := m.guard.Check(r.Context(), subjects...)
+	if err != nil {
+		log.Printf("lockout: check failed (Fail Open): %v", err)
+		return false
+	}
+	if !d.Blocked() {
+		return false
+	}
+
+	retry := int64(d.RetryAfter.Seconds() + 0.999) // Round up to whole seconds
+	w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+	if d.State == lockout.StateLocked {
+		http.Error(w, "Forbidden: too many failed attempts, temporarily locked out", http.StatusForbidden)
+	} else {
+		http.Error(w, "Too Many Requests: too many failed attempts, retry later", http.StatusTooManyRequests)
+	}
+	return true
+}
+
+// clientIP returns the host part of RemoteAddr
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withPrincipal stores the principal, its tenant and, for existing handlers, its ID under UserContextKey
+func withPrincipal(ctx context.Context, p *auth.Principal) context.Context {
+	if slot, ok := ctx.Value(principalSlotKey).(**auth.Principal); ok {
+		*slot = p
+	}
+	ctx = context.WithValue(ctx, UserContextKey, p.ID)
+	ctx = context.WithValue(ctx, TenantContextKey, p.Tenant())
+	return context.WithValue(ctx, PrincipalContextKey, p)
+}
+
+// withPrincipalSlot lets a middleware that runs before auth read the principal afterwards
+func withPrincipalSlot(ctx context.Context) (context.Context, **auth.Principal) {
+	slot := new(*auth.Principal)
+	return context.WithValue(ctx, principalSlotKey, slot), slot
+}
+
+// Actor returns the audit identities for a principal: the acting party and,
+// for delegated tokens, the user it acts on behalf of
+func Actor(p *auth.Principal) (actorID, onBehalfOf string) {
+	if p == nil {
+		return "anonymous", ""
+	}
+	if p.ActorID != "" {
+		return p.ActorID, p.ID
+	}
+	return p.ID, ""
+}
+
+// GetTenant returns the caller's tenant; anonymous requests belong to the default tenant
+func GetTenant(ctx context.Context) string {
+	if t, ok := ctx.Value(TenantContextKey).(string); ok {
+		return t
+	}
+	return auth.DefaultTenant
+}
+
+// GetPrincipal returns the authenticated principal, or nil for anonymous requests
+func GetPrincipal(ctx context.Context) *auth.Principal {
+	if p, ok := ctx.Value(PrincipalContextKey).(*auth.Principal); ok {
+		return p
+	}
+	return nil
+}
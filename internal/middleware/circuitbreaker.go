@@ -1,38 +1,64 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/raakeshmj/apigatewayplane/internal/circuitbreaker"
 )
 
-func CircuitBreakerMiddleware(cb *circuitbreaker.CircuitBreaker, serviceName string) Middleware {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+var (
+	errUpstreamStatus  = errors.New("upstream responded with a failure status")
+	errUpstreamTimeout = errors.New("upstream timed out")
+)
 
-			// Wrapper function for the "action"
-			// But wait, middleware wraps the HANDLER.
-			// The handler calls downstream.
-			// The middleware doesn't know if the handler "failed" unless the handler returns an error?
-			// `ServeHTTP` doesn't return error. It writes to ResponseWriter.
+type CircuitBreakerExecutor interface {
+	ExecuteWith(ctx context.Context, name string, cfg circuitbreaker.Config, action func() error) error
+}
 
-			// How to capture error?
-			// 1. Check HTTP Status Code (ResponseRecorder).
-			// 2. Panic?
+// CircuitBreaker runs requests through the breaker their policy names. The
+// response status, and the request timeout if the rule sets one, decide
+// whether a request failed. While the breaker is open requests get 503
+// without reaching the handler. It is the last middleware of the chain, so
+// it also marks the requests that do reach the handler for metrics.
+func CircuitBreaker(cb CircuitBreakerExecutor) Middleware {
+	return func(next http.Handler) http.Handler {
+		next = toUpstream(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := GetPolicy(r.Context())
+			if p == nil || p.Rules.CircuitBreaker == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rule := p.Rules.CircuitBreaker
 
-			// Capturing 5xx status codes is the standard way.
+			ctx := r.Context()
+			if rule.RequestTimeoutMs > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Duration(rule.RequestTimeoutMs)*time.Millisecond)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
 
+			// Capturing the status code is how we learn whether the handler failed
 			rw := &responseWriterInterceptor{
 				ResponseWriter: w,
 				statusCode:     http.StatusOK, // Default
 			}
 
-			err := cb.Execute(r.Context(), serviceName, func() error {
+			ran := false
+			err := cb.ExecuteWith(ctx, p.Breaker(), rule.Config(), func() error {
+				ran = true
 				next.ServeHTTP(rw, r)
 
-				// Interpret status code
-				if rw.statusCode >= 500 {
-					return http.ErrHandlerTimeout // Just a generic error marker
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return errUpstreamTimeout
+				}
+				if rule.Failed(rw.statusCode) {
+					return errUpstreamStatus
 				}
 				return nil
 			})
@@ -41,16 +67,13 @@ func CircuitBreakerMiddleware(cb *circuitbreaker.CircuitBreaker, serviceName str
 				http.Error(w, "Service Unavailable (Circuit Open)", http.StatusServiceUnavailable)
 				return
 			}
-
-			// If Execute returns error (500 from downstream), it's already written to RW?
-			// Yes, `next.ServeHTTP` wrote to `rw`.
-			// But `rw` buffers? No, it writes to `w`.
-			// Wait, `Execute` calls the function. The function calls `next.ServeHTTP`.
-			// If `next.ServeHTTP` writes 500, `cb.Execute` sees error, trips breaker.
-			// The client receives the 500.
-			// Next request -> `cb.Execute` sees Open -> returns ErrCircuitOpen -> We write 503.
-
-			// Perfect.
+			if err != nil && !ran {
+				// The breaker itself failed; serve the request rather than answer nothing
+				log.Printf("circuitbreaker: %s: %v", p.Breaker(), err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Any other error is the handler's outcome, already written to the client
 		})
 	}
 }
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/raakeshmj/apigatewayplane/internal/concurrency"
+)
+
+type ConcurrencyLimiter interface {
+	Acquire(ctx context.Context, slots []concurrency.Slot) (*concurrency.Lease, error)
+}
+
+// Concurrency holds a slot per client of the policy and per route for as
+// long as the request is in flight, as configured by the policy's concurrency rule.
+// Requests over a limit are rejected with the rule's status.
+func Concurrency(l ConcurrencyLimiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := GetPolicy(r.Context())
+			if p == nil || p.Rules.Concurrency == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rule := p.Rules.Concurrency
+
+			var slots []concurrency.Slot
+			if rule.PerClient > 0 {
+				slots = append(slots, concurrency.Slot{Key: "concurrency:policy:" + p.ID + ":" + clientKey(r), Max: rule.PerClient})
+			}
+			if rule.PerRoute > 0 {
+				slots = append(slots, concurrency.Slot{Key: "concurrency:route:" + p.ID, Max: rule.PerRoute})
+			}
+			if len(slots) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			lease, err := l.Acquire(r.Context(), slots)
+			if errors.Is(err, concurrency.ErrLimitExceeded) {
+				status := rule.RejectStatus
+				if status == 0 {
+					status = http.StatusTooManyRequests
+				}
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "Too Many Concurrent Requests", status)
+				return
+			}
+			if err != nil {
+				log.Printf("concurrency: acquire failed, failing open: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Release even if the client went away mid-request
+			defer lease.Release(context.WithoutCancel(r.Context()))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
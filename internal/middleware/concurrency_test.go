@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raakeshmj/apigatewayplane/internal/concurrency"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+)
+
+// recordingConcurrency rejects every request and remembers the slots asked for
+type recordingConcurrency struct{ slots []concurrency.Slot }
+
+func (c *recordingConcurrency) Acquire(ctx context.Context, slots []concurrency.Slot) (*concurrency.Lease, error) {
+	c.slots = slots
+	return nil, concurrency.ErrLimitExceeded
+}
+
+func TestConcurrency_PerClientSlotIsPerPolicy(t *testing.T) {
+	l := &recordingConcurrency{}
+	h := Concurrency(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	keys := map[string]bool{}
+	for _, id := range []string{"orders", "export"} {
+		p := &policy.Policy{ID: id, Rules: policy.Rules{Concurrency: &policy.ConcurrencyRule{PerClient: 1, PerRoute: 10}}}
+		ctx := context.WithValue(context.Background(), PolicyContextKey, p)
+		ctx = context.WithValue(ctx, TenantContextKey, "acme")
+		ctx = context.WithValue(ctx, UserContextKey, "alice")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+			t.Errorf("%s: expected 429 with Retry-After 1, got %d", id, w.Code)
+		}
+		if len(l.slots) != 2 {
+			t.Fatalf("%s: expected a client and a route slot, got %+v", id, l.slots)
+		}
+		want := "concurrency:policy:" + id + ":tenant:acme:user:alice"
+		if l.slots[0].Key != want || l.slots[0].Max != 1 {
+			t.Errorf("%s: expected client slot %s, got %+v", id, want, l.slots[0])
+		}
+		keys[l.slots[0].Key] = true
+	}
+	if len(keys) != 2 {
+		t.Errorf("Expected separate client slots per policy, got %v", keys)
+	}
+}
@@ -1,12 +1,22 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/raakeshmj/apigatewayplane/internal/metrics"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
 )
 
+const requestInfoKey ContextKey = "request_info"
+
+// requestInfo is filled in further down the chain for the metrics middleware
+type requestInfo struct {
+	policyID string // The policy the request ended up under
+	upstream bool   // Whether the request reached the handler behind the gateway
+}
+
 func MetricsMiddleware(collector *metrics.MetricsCollector) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -18,10 +28,30 @@ func MetricsMiddleware(collector *metrics.MetricsCollector) Middleware {
 				statusCode:     http.StatusOK,
 			}
 
-			next.ServeHTTP(rw, r)
+			info := &requestInfo{}
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), requestInfoKey, info)))
 
 			duration := time.Since(start)
-			collector.Record(duration, rw.statusCode)
+			collector.Record(duration, rw.statusCode, info.policyID, info.upstream)
 		})
 	}
 }
+
+// withPolicy attaches the policy to the request, for the rest of the chain and for metrics
+func withPolicy(ctx context.Context, p *policy.Policy) context.Context {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.policyID = p.ID
+	}
+	return context.WithValue(ctx, PolicyContextKey, p)
+}
+
+// toUpstream marks requests that get past every gateway check, so their
+// responses are the upstream's rather than the gateway's own
+func toUpstream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+			info.upstream = true
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/circuitbreaker"
+	"github.com/raakeshmj/apigatewayplane/internal/metrics"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+)
+
+// switchBreaker is open while open is set, and runs every call otherwise
+type switchBreaker struct{ open bool }
+
+func (b *switchBreaker) ExecuteWith(ctx context.Context, name string, cfg circuitbreaker.Config, action func() error) error {
+	if b.open {
+		return circuitbreaker.ErrCircuitOpen
+	}
+	return action()
+}
+
+func TestMetrics_SamplesUpstreamResponsesPerPolicy(t *testing.T) {
+	eng := policy.NewEngine()
+	eng.LoadPolicies([]policy.Policy{
+		{ID: "orders", Matcher: policy.Matcher{Path: "/orders"}, Rules: policy.Rules{CircuitBreaker: &policy.CircuitBreakerRule{}}},
+		{ID: "reports", Matcher: policy.Matcher{Path: "/reports"}},
+	})
+	collector := metrics.NewCollector(100)
+	breaker := &switchBreaker{}
+	throttle := false
+
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}),
+		MetricsMiddleware(collector),
+		PolicyEnforcer(eng),
+		func(next http.Handler) http.Handler { // Stands in for the gateway's own rejections
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if throttle {
+					http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		},
+		CircuitBreaker(breaker),
+	)
+	serve := func(path string) {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	serve("/orders")
+	serve("/reports")
+	breaker.open = true
+	serve("/orders") // 503 from the open breaker
+	throttle = true
+	serve("/orders")
+	serve("/reports")
+
+	for _, id := range []string{"orders", "reports"} {
+		if sig := collector.Recent(id, time.Minute); sig.Samples != 1 || sig.ErrorRate != 1 {
+			t.Errorf("%s: expected the one upstream 500, got %+v", id, sig)
+		}
+	}
+	if stats := collector.GetStats(); stats.TotalRequests != 5 {
+		t.Errorf("Expected every request in the totals, got %d", stats.TotalRequests)
+	}
+}
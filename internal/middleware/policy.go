@@ -32,8 +32,26 @@ func PolicyEnforcer(engine *policy.Engine) Middleware {
 				}
 			}
 
-			ctx := context.WithValue(r.Context(), PolicyContextKey, p)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(withPolicy(r.Context(), p)))
+		})
+	}
+}
+
+// TenantPolicyEnforcer runs after auth: when the caller's tenant has a policy
+// matching the request, it replaces the global one for the rest of the chain
+func TenantPolicyEnforcer(engine *policy.Engine) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := GetPrincipal(r.Context())
+			if p == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if tp := engine.EvaluateTenant(r, p.Tenant()); tp != nil {
+				r = r.WithContext(withPolicy(r.Context(), tp))
+			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
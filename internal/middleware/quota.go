@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/quota"
+)
+
+type QuotaEnforcer interface {
+	Quotas(ctx context.Context, p *auth.Principal) ([]quota.Quota, error)
+	Consume(ctx context.Context, quotas []quota.Quota) ([]quota.Usage, error)
+}
+
+// Quota counts each request against the caller's plans. Requests over any
+// quota get 429 until the period resets. Lookup or Redis failures let the
+// request through without quota headers.
+func Quota(q QuotaEnforcer, logger audit.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := GetPrincipal(r.Context())
+			quotas, err := q.Quotas(r.Context(), p)
+			if err != nil {
+				log.Printf("quota: plan lookup failed, failing open: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(quotas) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			usage, err := q.Consume(r.Context(), quotas)
+			if err != nil && err != quota.ErrQuotaExceeded {
+				log.Printf("quota: counter error, failing open: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, u := range usage {
+				for _, t := range u.Crossed {
+					logQuotaThreshold(logger, r, p, u, t)
+				}
+			}
+
+			// Headers describe the quota closest to running out
+			u := tightest(usage)
+			resetIn := max(0, int(time.Until(u.ResetAt).Seconds()+0.999))
+			w.Header().Set("X-Quota-Limit", fmt.Sprintf("%d", u.Limit))
+			w.Header().Set("X-Quota-Remaining", fmt.Sprintf("%d", u.Remaining()))
+			w.Header().Set("X-Quota-Reset", fmt.Sprintf("%d", resetIn))
+
+			if err == quota.ErrQuotaExceeded {
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", resetIn))
+				http.Error(w, "Quota Exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tightest returns the usage with the fewest requests left; among exhausted
+// ones, the one that resets last, since that is how long the caller must wait
+func tightest(usage []quota.Usage) quota.Usage {
+	best := usage[0]
+	for _, u := range usage[1:] {
+		switch {
+		case u.Remaining() < best.Remaining():
+			best = u
+		case u.Remaining() == best.Remaining() && u.ResetAt.After(best.ResetAt):
+			best = u
+		}
+	}
+	return best
+}
+
+func logQuotaThreshold(logger audit.Logger, r *http.Request, p *auth.Principal, u quota.Usage, threshold int) {
+	if logger == nil {
+		return
+	}
+	actorID, onBehalfOf := Actor(p)
+	logger.Log(audit.LogEntry{
+		Timestamp:  time.Now(),
+		TenantID:   GetTenant(r.Context()),
+		ActorID:    actorID,
+		OnBehalfOf: onBehalfOf,
+		Action:     "quota_threshold",
+		Resource:   fmt.Sprintf("quota:%s:%s", u.Subject.Type, u.Subject.ID),
+		Status:     http.StatusOK,
+		Metadata: map[string]interface{}{
+			"plan_id":   u.PlanID,
+			"threshold": threshold,
+			"used":      u.Used,
+			"limit":     u.Limit,
+			"period":    string(u.Period),
+		},
+	})
+}
@@ -3,91 +3,346 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/raakeshmj/apigatewayplane/internal/config"
 	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/raakeshmj/apigatewayplane/internal/overrides"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
 	"github.com/raakeshmj/apigatewayplane/internal/reliability"
 )
 
 type RateLimiter interface {
-	Allow(ctx context.Context, key string, rate float64, burst int) (bool, float64, error)
+	AllowN(ctx context.Context, levels []limiter.Level, cost int64) (limiter.Decision, error)
+	Debit(ctx context.Context, levels []limiter.Level, cost int64) (limiter.Decision, error)
 }
 
-// In-Memory mock or Redis interface
-// We need to support Context and errors.
-// Let's use the concrete struct for now or better an interface.
-// Since internal/limiter has the struct, let's inject it.
+// LimitAdjuster scales a policy's configured limits, e.g. adaptively
+type LimitAdjuster interface {
+	Adjust(p *policy.Policy, l limiter.Limit) limiter.Limit
+}
+
+// RateLimitOverrides supplies temporary per-principal limits, such as overrides.Store
+type RateLimitOverrides interface {
+	Lookup(policyID string, ids ...string) (overrides.Override, bool)
+}
+
+// ThrottleRecorder counts throttled requests per bucket, such as throttle.Tracker
+type ThrottleRecorder interface {
+	Record(ctx context.Context, key string) error
+}
 
-// Config defines rate limits per tier
+// RateLimitConfig defines rate limits per tier
 type RateLimitConfig struct {
 	Rate  float64
 	Burst int
 }
 
-func RateLimit(l *limiter.TokenBucketLimiter, cfgMgr *config.DynamicConfigManager) Middleware {
+// RateLimit enforces the matched policy's limits with l. When l reports a
+// backend failure the policy's failure strategy decides: fail_open lets the
+// request through, fail_local enforces it with local, fail_closed rejects it.
+// Requests spend the policy's cost; a cost header set by the upstream is
+// debited once its response headers are written. A non-nil adjust scales
+// every level's limit, such as adaptive.Controller does; an override for the
+// principal or its API key then replaces the per-user limit. Throttled
+// requests are counted against the bucket that denied them.
+func RateLimit(l RateLimiter, local RateLimiter, cfgMgr *config.DynamicConfigManager, adjust LimitAdjuster, ovr RateLimitOverrides, throttled ThrottleRecorder) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 1. Get Policy from Context
-			// Note: We need to import `middleware.GetPolicy` but we are IN `middleware` package.
-			// So we can call `GetPolicy` directly if it's exported, or just use context key if private.
-			// `PolicyContextKey` is unexported? No, it's exported `PolicyContextKey`.
-			// But `GetPolicy` is in `policy.go` (same package).
-
 			p := GetPolicy(r.Context())
+			if p != nil && len(p.Rules.RateLimitExempt) > 0 {
+				if principal := GetPrincipal(r.Context()); principal != nil && p.Rules.Exempt(principal.ID, principal.KeyID) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
 
-			// Configuration from Policy
-			rate := 1.0
-			burst := 5
+			strategy := reliability.FailLocal
+			cost := int64(1)
 			if p != nil {
-				rate = p.Rules.RateLimit
-				burst = p.Rules.Burst
+				strategy = p.Rules.OnFailure()
+				cost = p.Rules.RequestCost(r.Method)
 			}
-
-			// 2. Identify client
-			// We MUST use UserID if auth middleware ran before.
-			userID, ok := r.Context().Value(UserContextKey).(string)
-			key := ""
-			if ok {
-				key = "ratelimit:user:" + userID
-			} else {
-				// Fallback to IP
-				key = "ratelimit:ip:" + r.RemoteAddr
+			levels := rateLimitLevels(r, p)
+			if adjust != nil {
+				for i := range levels {
+					levels[i].Limit = adjust.Adjust(p, levels[i].Limit)
+				}
+			}
+			if ovr != nil && p != nil {
+				if principal := GetPrincipal(r.Context()); principal != nil {
+					if o, ok := ovr.Lookup(p.ID, principal.ID, principal.KeyID); ok {
+						user := &levels[0].Limit
+						user.Rate, user.Burst = o.RateLimit, o.Burst
+						user.Lease = min(user.Lease, o.Burst)
+					}
+				}
 			}
 
-			allowed, remaining, err := l.Allow(r.Context(), key, rate, burst)
+			headers := policy.HeaderSet("")
+			if p != nil {
+				headers = p.Rules.RateLimitHeaders
+			}
 
-			// Set Headers
-			w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", burst))
-			w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", int(remaining)))
-			w.Header().Set("X-RateLimit-Reset", "1") // Simplified
+			used := l // Debits go wherever the request was counted
+			d, err := l.AllowN(r.Context(), levels, cost)
 
-			if err != nil {
-				// If Redis fails, check strategy
-				if err == limiter.ErrRateLimitExceeded {
-					http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			if err != nil && err != limiter.ErrRateLimitExceeded {
+				// System error (Redis down): apply the policy's strategy
+				switch {
+				case strategy == reliability.FailLocal && local != nil:
+					// Local buckets only see this replica's traffic; don't advertise them
+					used, headers = local, policy.HeadersNone
+					d, err = local.AllowN(r.Context(), levels, cost)
+				case reliability.ShouldAllow(strategy, err):
+					log.Printf("ratelimit: backend error, failing open: %v", err)
+					next.ServeHTTP(w, r)
+					return
+				default:
+					log.Printf("ratelimit: backend error, failing closed: %v", err)
+					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
 					return
 				}
-
-				// System error (Redis down)
-				// Strategy: Fail Open
-				if reliability.ShouldAllow(reliability.FailOpen, err) {
-					// Log error but allow
-					fmt.Printf("Rate limiter error (Fail Open): %v\n", err)
+				if err != nil && err != limiter.ErrRateLimitExceeded {
+					log.Printf("ratelimit: local limiter error, failing open: %v", err)
 					next.ServeHTTP(w, r)
 					return
 				}
-
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
 			}
 
-			if !allowed {
+			setRateLimitHeaders(w.Header(), headers, levels, d, cost)
+
+			if !d.Allowed {
+				if throttled != nil && used == l {
+					if err := throttled.Record(r.Context(), levels[d.Limiting()].Key); err != nil {
+						log.Printf("ratelimit: failed to record throttled request: %v", err)
+					}
+				}
+				if wait := d.Levels[d.Limiting()].RetryAfter; wait != limiter.Never {
+					w.Header().Set("Retry-After", fmt.Sprintf("%d", max(1, ceilSeconds(wait))))
+				}
 				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 				return
 			}
 
+			if p != nil && p.Rules.Cost != nil && p.Rules.Cost.Header != "" {
+				w = &costWriter{
+					ResponseWriter: w,
+					r:              r,
+					limiter:        used,
+					levels:         levels,
+					headers:        headers,
+					header:         p.Rules.Cost.Header,
+					charged:        cost,
+				}
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// setRateLimitHeaders writes the headers in set. Following the IETF
+// RateLimit header draft, RateLimit-Policy lists every level as a quota of
+// burst tokens per window it takes to refill, and RateLimit reports the level
+// that decided the outcome; the legacy X-RateLimit-* headers describe that
+// level too.
+func setRateLimitHeaders(h http.Header, set policy.HeaderSet, levels []limiter.Level, d limiter.Decision, cost int64) {
+	i := d.Limiting()
+	res := d.Levels[i]
+
+	if set.IETF() {
+		policies := make([]string, len(levels))
+		for j, lvl := range levels {
+			policies[j] = fmt.Sprintf("%q;q=%d", lvl.Name, lvl.Limit.Burst)
+			if w := lvl.Limit.Window(); w != limiter.Never {
+				policies[j] += fmt.Sprintf(";w=%d", max(1, ceilSeconds(w)))
+			}
+		}
+		h.Set("RateLimit-Policy", strings.Join(policies, ", "))
+
+		state := fmt.Sprintf("%q;r=%d", levels[i].Name, int(res.Remaining))
+		if res.ResetAfter != limiter.Never {
+			state += fmt.Sprintf(";t=%d", ceilSeconds(res.ResetAfter))
+		}
+		h.Set("RateLimit", state)
+	}
+
+	if set.Legacy() {
+		h.Set("X-RateLimit-Limit", fmt.Sprintf("%d", levels[i].Limit.Burst))
+		h.Set("X-RateLimit-Remaining", fmt.Sprintf("%d", int(res.Remaining)))
+		if res.ResetAfter != limiter.Never {
+			h.Set("X-RateLimit-Reset", fmt.Sprintf("%d", ceilSeconds(res.ResetAfter)))
+		}
+		h.Set("X-RateLimit-Cost", fmt.Sprintf("%d", cost))
+	}
+}
+
+// costWriter debits the cost the upstream reports in a response header
+// beyond what the request already paid, before the headers go out
+type costWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	limiter RateLimiter
+	levels  []limiter.Level
+	headers policy.HeaderSet
+	header  string
+	charged int64
+	done    bool
+}
+
+func (cw *costWriter) WriteHeader(code int) {
+	if !cw.done {
+		cw.done = true
+		cw.debit()
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *costWriter) Write(b []byte) (int, error) {
+	if !cw.done {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *costWriter) debit() {
+	v := cw.Header().Get(cw.header)
+	if v == "" {
+		return
+	}
+	actual, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || actual <= cw.charged {
+		return
+	}
+	d, err := cw.limiter.Debit(cw.r.Context(), cw.levels, actual-cw.charged)
+	if err != nil {
+		log.Printf("ratelimit: failed to debit reported cost: %v", err)
+		return
+	}
+	setRateLimitHeaders(cw.Header(), cw.headers, cw.levels, d, actual)
+}
+
+// rateLimitLevels lists the buckets a request is checked against: always the
+// caller's own, plus any scoped limits of the policy that apply to it.
+// Keys are namespaced by tenant so tenants never share buckets; only global
+// policies reach the shared route and global buckets.
+func rateLimitLevels(r *http.Request, p *policy.Policy) []limiter.Level {
+	tenant := GetTenant(r.Context())
+	key := "ratelimit:" + clientKey(r)
+
+	if p == nil {
+		return []limiter.Level{{Name: "user", Key: key, Limit: limiter.Limit{Rate: 1.0, Burst: 5}}}
+	}
+	if parts := p.KeyTemplate(); len(parts) > 0 {
+		if custom, ok := renderKey(r, p, parts); ok {
+			// Own namespace per policy, so no template can render a default key
+			key = "ratelimit:tenant:" + tenant + ":custom:" + keyEscaper.Replace(p.ID) + ":" + custom
+		}
+	}
+	levels := []limiter.Level{{Name: "user", Key: key, Limit: p.Rules.Limit()}}
+
+	for _, sl := range p.Rules.Limits {
+		lvl := limiter.Level{Name: sl.Scope, Limit: p.Rules.ScopedLimit(sl)}
+		switch sl.Scope {
+		case policy.ScopeKey:
+			principal := GetPrincipal(r.Context())
+			if principal == nil || principal.KeyID == "" {
+				continue
+			}
+			lvl.Key = "ratelimit:tenant:" + tenant + ":key:" + principal.KeyID
+		case policy.ScopeTenant:
+			lvl.Key = "ratelimit:tenant:" + tenant
+		case policy.ScopeRoute:
+			lvl.Key = "ratelimit:route:" + p.ID
+			if p.TenantID != "" {
+				lvl.Key = "ratelimit:tenant:" + tenant + ":route:" + keyEscaper.Replace(p.ID)
+			}
+		case policy.ScopeGlobal:
+			if p.TenantID != "" {
+				// Rejected when saved; a tenant must not throttle every tenant
+				continue
+			}
+			lvl.Key = "ratelimit:global"
+		default:
+			continue
+		}
+		levels = append(levels, lvl)
+	}
+	return levels
+}
+
+// clientKey identifies the caller within its tenant: by user, or by client
+// IP for anonymous requests
+func clientKey(r *http.Request) string {
+	key := "tenant:" + GetTenant(r.Context())
+	if userID, ok := r.Context().Value(UserContextKey).(string); ok {
+		return key + ":user:" + userID
+	}
+	return key + ":ip:" + clientIP(r)
+}
+
+// keyEscaper escapes attribute values so they can't forge key separators
+var keyEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+// renderKey fills in the policy's parsed rate limit key template. It reports
+// false if an attribute the template names is missing from the request, in
+// which case the caller keys by client as usual.
+func renderKey(r *http.Request, p *policy.Policy, parts []policy.KeyPart) (string, bool) {
+	principal := GetPrincipal(r.Context())
+
+	var b strings.Builder
+	for _, part := range parts {
+		if part.Attr == "" {
+			b.WriteString(part.Literal)
+			continue
+		}
+		var v string
+		switch part.Attr {
+		case policy.KeyTenant:
+			v = GetTenant(r.Context())
+		case policy.KeyUser:
+			v, _ = r.Context().Value(UserContextKey).(string)
+		case policy.KeyIP:
+			v = clientIP(r)
+		case policy.KeyClient:
+			v, _ = r.Context().Value(UserContextKey).(string)
+			if v == "" {
+				v = clientIP(r)
+			}
+		case policy.KeyAPIKey:
+			if principal != nil {
+				v = principal.KeyID
+			}
+		case policy.KeyRoute:
+			v = p.ID
+		case policy.KeyMethod:
+			v = r.Method
+		case policy.KeyHeader:
+			v = r.Header.Get(part.Arg)
+		case policy.KeyClaim:
+			if principal != nil {
+				v = principal.Claim(part.Arg)
+			}
+		case policy.KeyPath:
+			n, _ := strconv.Atoi(part.Arg)
+			if segs := strings.Split(strings.Trim(r.URL.Path, "/"), "/"); n < len(segs) {
+				v = segs[n]
+			}
+		}
+		if v == "" {
+			return "", false
+		}
+		b.WriteString(keyEscaper.Replace(v))
+	}
+	return b.String(), true
+}
+
+// ceilSeconds rounds d up to whole seconds for headers
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+	"github.com/raakeshmj/apigatewayplane/internal/reliability"
+	"github.com/redis/go-redis/v9"
+)
+
+// loadPolicy returns p as an Engine holds it, with its key template parsed
+func loadPolicy(p policy.Policy) *policy.Policy {
+	eng := policy.NewEngine()
+	eng.LoadPolicies([]policy.Policy{p})
+	return &eng.Policies()[0]
+}
+
+func TestRateLimitLevels_CustomKeyNamespace(t *testing.T) {
+	p := loadPolicy(policy.Policy{ID: "orders", Rules: policy.Rules{RateLimit: 1, Burst: 1, RateLimitKey: "{header:X-Client-ID}"}})
+
+	tests := []struct {
+		client string
+		want   string
+	}{
+		{"mobile", "ratelimit:tenant:acme:custom:orders:mobile"},
+		// Would be the default per-user key of bob without the namespace and escaping
+		{"user:bob", "ratelimit:tenant:acme:custom:orders:user%3Abob"},
+		{"50%:x", "ratelimit:tenant:acme:custom:orders:50%25%3Ax"},
+		{"", "ratelimit:tenant:acme:ip:192.0.2.1"}, // Missing attribute keys by client
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/orders", nil)
+		if tt.client != "" {
+			r.Header.Set("X-Client-ID", tt.client)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), TenantContextKey, "acme"))
+		if got := rateLimitLevels(r, p)[0].Key; got != tt.want {
+			t.Errorf("client %q: expected key %s, got %s", tt.client, tt.want, got)
+		}
+	}
+}
+
+func TestRateLimitLevels_TenantPoliciesKeepToTheirTenant(t *testing.T) {
+	limits := []policy.ScopedLimit{{Scope: policy.ScopeRoute, RateLimit: 5, Burst: 5}, {Scope: policy.ScopeGlobal, RateLimit: 1, Burst: 1}}
+	r := httptest.NewRequest("GET", "/api/orders", nil)
+	r = r.WithContext(context.WithValue(r.Context(), TenantContextKey, "acme"))
+
+	global := rateLimitLevels(r, &policy.Policy{ID: "orders", Rules: policy.Rules{RateLimit: 10, Burst: 10, Limits: limits}})
+	if len(global) != 3 || global[1].Key != "ratelimit:route:orders" || global[2].Key != "ratelimit:global" {
+		t.Errorf("Expected shared route and global buckets for a global policy, got %+v", global)
+	}
+
+	// A stored tenant policy with a global limit predating validation must not throttle other tenants
+	tenant := rateLimitLevels(r, &policy.Policy{ID: "orders", TenantID: "acme", Rules: policy.Rules{RateLimit: 10, Burst: 10, Limits: limits}})
+	if len(tenant) != 2 || tenant[1].Key != "ratelimit:tenant:acme:route:orders" {
+		t.Errorf("Expected only a tenant route bucket for a tenant policy, got %+v", tenant)
+	}
+}
+
+// newRedisLimiter returns a limiter on a fresh miniredis whose clock stands still
+func newRedisLimiter(t *testing.T) (*limiter.RedisLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1_700_000_000, 0))
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1, DialerRetries: 1})
+	t.Cleanup(func() { rdb.Close() })
+	return limiter.NewRedisLimiter(rdb), mr
+}
+
+// serveRateLimited sends a request from alice of tenant acme under p through RateLimit
+func serveRateLimited(h http.Handler, p *policy.Policy) *httptest.ResponseRecorder {
+	ctx := context.WithValue(context.Background(), PolicyContextKey, p)
+	ctx = context.WithValue(ctx, TenantContextKey, "acme")
+	ctx = context.WithValue(ctx, UserContextKey, "alice")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/orders", nil).WithContext(ctx))
+	return w
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestRateLimit_IETFHeaders(t *testing.T) {
+	l, _ := newRedisLimiter(t)
+	h := RateLimit(l, nil, nil, nil, nil, nil)(okHandler)
+	p := &policy.Policy{ID: "orders", Rules: policy.Rules{
+		RateLimit: 1, Burst: 5, RateLimitHeaders: policy.HeadersIETF,
+		Limits: []policy.ScopedLimit{{Scope: policy.ScopeTenant, RateLimit: 10, Burst: 20}},
+	}}
+
+	w := serveRateLimited(h, p)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	// Each level is burst tokens per the time it takes to refill them
+	if got, want := w.Header().Get("RateLimit-Policy"), `"user";q=5;w=5, "tenant";q=20;w=2`; got != want {
+		t.Errorf("Expected RateLimit-Policy %s, got %s", want, got)
+	}
+	// The user level has the fewest tokens left; one refills in a second
+	if got, want := w.Header().Get("RateLimit"), `"user";r=4;t=1`; got != want {
+		t.Errorf("Expected RateLimit %s, got %s", want, got)
+	}
+	if got := w.Header().Get("X-RateLimit-Limit"); got != "" {
+		t.Errorf("Expected no legacy headers with ietf, got X-RateLimit-Limit %s", got)
+	}
+}
+
+func TestRateLimit_RetryAfter(t *testing.T) {
+	l, _ := newRedisLimiter(t)
+	h := RateLimit(l, nil, nil, nil, nil, nil)(okHandler)
+	p := &policy.Policy{ID: "orders", Rules: policy.Rules{RateLimit: 0.4, Burst: 2}}
+
+	for i := 0; i < 2; i++ {
+		if w := serveRateLimited(h, p); w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, w.Code)
+		}
+	}
+	w := serveRateLimited(h, p)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	// A token takes 2.5s; Retry-After rounds up to whole seconds
+	if got := w.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Expected Retry-After 3, got %q", got)
+	}
+	if got := w.Header().Get("RateLimit"); got != `"user";r=0;t=5` {
+		t.Errorf("Expected an empty user bucket, got RateLimit %s", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("Expected X-RateLimit-Remaining 0, got %q", got)
+	}
+}
+
+func TestRateLimit_NoHeadersWithoutRedis(t *testing.T) {
+	l, mr := newRedisLimiter(t)
+	mr.Close()
+	rateLimitHeaders := []string{"RateLimit", "RateLimit-Policy", "X-RateLimit-Limit", "X-RateLimit-Remaining"}
+
+	// fail_open lets requests through without counting them
+	h := RateLimit(l, limiter.NewLocalLimiter(nil), nil, nil, nil, nil)(okHandler)
+	open := &policy.Policy{ID: "open", Rules: policy.Rules{RateLimit: 1, Burst: 1, FailureStrategy: reliability.FailOpen}}
+	for i := 0; i < 3; i++ {
+		w := serveRateLimited(h, open)
+		if w.Code != http.StatusOK {
+			t.Fatalf("fail_open: expected 200, got %d", w.Code)
+		}
+		for _, name := range rateLimitHeaders {
+			if v := w.Header().Get(name); v != "" {
+				t.Errorf("fail_open: expected no %s header, got %q", name, v)
+			}
+		}
+	}
+
+	// fail_local enforces this replica's buckets but doesn't advertise them
+	local := &policy.Policy{ID: "local", Rules: policy.Rules{RateLimit: 1, Burst: 1, FailureStrategy: reliability.FailLocal}}
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := serveRateLimited(h, local)
+		if w.Code != want {
+			t.Fatalf("fail_local request %d: expected %d, got %d", i+1, want, w.Code)
+		}
+		for _, name := range rateLimitHeaders {
+			if v := w.Header().Get(name); v != "" {
+				t.Errorf("fail_local request %d: expected no %s header, got %q", i+1, name, v)
+			}
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+			t.Errorf("fail_local: expected Retry-After 1, got %q", w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestRateLimit_DebitsReportedCost(t *testing.T) {
+	l, _ := newRedisLimiter(t)
+	reported := "4"
+	h := RateLimit(l, nil, nil, nil, nil, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Cost", reported)
+		w.Write([]byte("ok"))
+	}))
+	p := &policy.Policy{ID: "search", Rules: policy.Rules{RateLimit: 1, Burst: 10, Cost: &policy.CostRule{Header: "X-Request-Cost"}}}
+
+	// One token up front, three more once the upstream reports four
+	w := serveRateLimited(h, p)
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "6" {
+		t.Errorf("Expected 6 tokens left after the debit, got %q", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Cost"); got != "4" {
+		t.Errorf("Expected X-RateLimit-Cost 4, got %q", got)
+	}
+	if got := w.Header().Get("RateLimit"); got != `"user";r=6;t=4` {
+		t.Errorf("Expected RateLimit to report the debit, got %s", got)
+	}
+
+	// A report below what was paid up front debits nothing more
+	reported = "1"
+	w = serveRateLimited(h, p)
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "5" {
+		t.Errorf("Expected 5 tokens left, got %q", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Cost"); got != "1" {
+		t.Errorf("Expected X-RateLimit-Cost 1, got %q", got)
+	}
+}
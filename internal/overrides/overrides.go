@@ -0,0 +1,206 @@
+package overrides
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidOverride = errors.New("invalid rate limit override")
+	ErrNotFound        = errors.New("rate limit override not found")
+)
+
+// hashKey holds every override, by principal and policy
+const hashKey = "ratelimit:overrides"
+
+// Override replaces the per-user limit of a principal, or of an API key,
+// until it expires
+type Override struct {
+	PrincipalID string    `json:"principal_id"`        // A principal or API key ID
+	PolicyID    string    `json:"policy_id,omitempty"` // Empty applies to every policy
+	TenantID    string    `json:"tenant_id"`
+	RateLimit   float64   `json:"rate_limit"`
+	Burst       int       `json:"burst"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+}
+
+func (o Override) field() string {
+	return o.PrincipalID + "|" + o.PolicyID
+}
+
+// Store keeps overrides in Redis so every replica honors them. Lookups are
+// served from an in-process copy that Run refreshes, so they cost no round trip.
+type Store struct {
+	client *redis.Client
+	now    func() time.Time
+
+	mu    sync.RWMutex
+	cache map[string]Override // By field
+}
+
+func New(client *redis.Client) *Store {
+	return &Store{client: client, now: time.Now, cache: make(map[string]Override)}
+}
+
+// Set creates or replaces the override for its principal and policy
+func (s *Store) Set(ctx context.Context, o Override) error {
+	switch {
+	case o.PrincipalID == "":
+		return fmt.Errorf("%w: principal_id is required", ErrInvalidOverride)
+	case o.RateLimit < 0 || o.Burst < 1:
+		return fmt.Errorf("%w: rate_limit must not be negative and burst must be at least 1", ErrInvalidOverride)
+	case !o.ExpiresAt.After(s.now()):
+		return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidOverride)
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	if err := s.client.HSet(ctx, hashKey, o.field(), data).Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cache[o.field()] = o
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns the live override for a principal and policy
+func (s *Store) Get(ctx context.Context, principalID, policyID string) (Override, error) {
+	data, err := s.client.HGet(ctx, hashKey, Override{PrincipalID: principalID, PolicyID: policyID}.field()).Bytes()
+	if err == redis.Nil {
+		return Override{}, ErrNotFound
+	}
+	if err != nil {
+		return Override{}, err
+	}
+	var o Override
+	if err := json.Unmarshal(data, &o); err != nil {
+		return Override{}, err
+	}
+	if !o.ExpiresAt.After(s.now()) {
+		return Override{}, ErrNotFound
+	}
+	return o, nil
+}
+
+// Delete removes an override before it expires
+func (s *Store) Delete(ctx context.Context, principalID, policyID string) error {
+	field := Override{PrincipalID: principalID, PolicyID: policyID}.field()
+	n, err := s.client.HDel(ctx, hashKey, field).Result()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.cache, field)
+	s.mu.Unlock()
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List returns the live overrides, by principal and then policy
+func (s *Store) List(ctx context.Context) ([]Override, error) {
+	all, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Override, 0, len(all))
+	for _, o := range all {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].PrincipalID != list[j].PrincipalID {
+			return list[i].PrincipalID < list[j].PrincipalID
+		}
+		return list[i].PolicyID < list[j].PolicyID
+	})
+	return list, nil
+}
+
+// Lookup returns the override for the first of ids that has one, preferring
+// one for policyID over one for every policy
+func (s *Store) Lookup(policyID string, ids ...string) (Override, bool) {
+	now := s.now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.cache) == 0 {
+		return Override{}, false
+	}
+	for _, policy := range []string{policyID, ""} {
+		for _, id := range ids {
+			if id == "" {
+				continue
+			}
+			if o, ok := s.cache[Override{PrincipalID: id, PolicyID: policy}.field()]; ok && o.ExpiresAt.After(now) {
+				return o, true
+			}
+		}
+	}
+	return Override{}, false
+}
+
+// Run refreshes the in-process copy every interval, picking up changes made
+// through other replicas, until ctx is cancelled
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("overrides: refresh failed, keeping the last copy: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh reloads the in-process copy from Redis
+func (s *Store) Refresh(ctx context.Context) error {
+	all, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cache = all
+	s.mu.Unlock()
+	return nil
+}
+
+// load reads the live overrides and deletes expired ones
+func (s *Store) load(ctx context.Context) (map[string]Override, error) {
+	raw, err := s.client.HGetAll(ctx, hashKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	all := make(map[string]Override, len(raw))
+	var expired []string
+	for field, data := range raw {
+		var o Override
+		if err := json.Unmarshal([]byte(data), &o); err != nil || !o.ExpiresAt.After(now) {
+			expired = append(expired, field)
+			continue
+		}
+		all[field] = o
+	}
+	if len(expired) > 0 {
+		s.client.HDel(ctx, hashKey, expired...)
+	}
+	return all, nil
+}
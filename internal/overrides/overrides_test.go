@@ -0,0 +1,58 @@
+package overrides
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStore_SharedAndExpiring(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+	a, b := New(rdb), New(rdb)
+	a.now, b.now = clock, clock
+
+	everywhere := Override{PrincipalID: "u1", RateLimit: 100, Burst: 200, ExpiresAt: now.Add(time.Hour)}
+	orders := Override{PrincipalID: "u1", PolicyID: "orders", RateLimit: 1, Burst: 1, ExpiresAt: now.Add(time.Minute)}
+	for _, o := range []Override{everywhere, orders} {
+		if err := a.Set(ctx, o); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if err := a.Set(ctx, Override{PrincipalID: "u1", Burst: 1, ExpiresAt: now}); !errors.Is(err, ErrInvalidOverride) {
+		t.Fatalf("Expected ErrInvalidOverride for an expired override, got %v", err)
+	}
+
+	// b sees a's overrides once it refreshes
+	if _, ok := b.Lookup("orders", "u1"); ok {
+		t.Fatal("Expected no override before refreshing")
+	}
+	if err := b.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := b.Lookup("orders", "key_1", "u1"); !ok || o.Burst != 1 {
+		t.Fatalf("Expected the policy's own override, got %+v, %v", o, ok)
+	}
+	if o, ok := b.Lookup("search", "u1"); !ok || o.Burst != 200 {
+		t.Fatalf("Expected the override for every policy, got %+v, %v", o, ok)
+	}
+
+	// Once the policy's override expires the general one applies again
+	now = now.Add(2 * time.Minute)
+	if o, ok := b.Lookup("orders", "u1"); !ok || o.Burst != 200 {
+		t.Fatalf("Expected the override for every policy, got %+v, %v", o, ok)
+	}
+	list, err := b.List(ctx)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("Expected one live override, got %v, %v", list, err)
+	}
+}
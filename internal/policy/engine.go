@@ -1,9 +1,20 @@
 package policy
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/circuitbreaker"
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/raakeshmj/apigatewayplane/internal/reliability"
+)
+
+var (
+	ErrInvalidRules = errors.New("invalid policy rules")
 )
 
 // Matcher defines criteria to apply a policy
@@ -17,15 +28,451 @@ type Rules struct {
 	AuthRequired bool    `json:"auth_required"`
 	RateLimit    float64 `json:"rate_limit"` // Requests per second
 	Burst        int     `json:"burst"`
+
+	// Rate limiting algorithm from the limiter registry; empty means token_bucket
+	Algorithm limiter.Algorithm `json:"algorithm,omitempty"`
+
+	// Further limits checked together with the per-user one above; a request
+	// only spends tokens when every level allows it
+	Limits []ScopedLimit `json:"limits,omitempty"`
+
+	// What to do when the shared rate limit store is unreachable; empty means fail_local
+	FailureStrategy reliability.FailureStrategy `json:"failure_strategy,omitempty"`
+
+	// Tokens a request spends from every level; nil means one
+	Cost *CostRule `json:"cost,omitempty"`
+
+	// Which rate limit headers responses carry; empty means both
+	RateLimitHeaders HeaderSet `json:"rate_limit_headers,omitempty"`
+
+	// Caps on requests in flight at once; nil means none
+	Concurrency *ConcurrencyRule `json:"concurrency,omitempty"`
+
+	// Scales every rate limit level with upstream health; nil keeps them fixed
+	Adaptive *AdaptiveRule `json:"adaptive,omitempty"`
+
+	// Lease tokens from Redis in batches instead of calling it per request
+	Batch *BatchRule `json:"batch,omitempty"`
+
+	// Bucket key of the per-user limit, such as "route:{route}:client:{header:X-Client-ID}"
+	// (see ParseKeyTemplate); empty keys by user, or client IP for anonymous requests
+	RateLimitKey string `json:"rate_limit_key,omitempty"`
+
+	// Principal or API key IDs that skip rate limiting
+	RateLimitExempt []string `json:"rate_limit_exempt,omitempty"`
+
+	// Cuts the upstream off while it keeps failing; nil means no breaker
+	CircuitBreaker *CircuitBreakerRule `json:"circuit_breaker,omitempty"`
+}
+
+// BatchRule trades accuracy for Redis round trips: each replica takes Size
+// tokens at a time from every level's shared bucket and spends them locally.
+// Replicas never admit more than the limit together, but up to Size tokens
+// per replica and level may sit unused for MaxHoldMs before the others can
+// have them. Token bucket levels only.
+type BatchRule struct {
+	Size      int `json:"size"`
+	MaxHoldMs int `json:"max_hold_ms,omitempty"` // Default 1000
+}
+
+// holdTTL returns how long unspent leased tokens are kept
+func (b *BatchRule) holdTTL() time.Duration {
+	if b.MaxHoldMs == 0 {
+		return time.Second
+	}
+	return time.Duration(b.MaxHoldMs) * time.Millisecond
+}
+
+// AdaptiveRule tightens the policy's rate limits while upstreams are slow or
+// failing and relaxes them again as they recover: limits are multiplied by a
+// factor that backs off multiplicatively and grows back additively (AIMD),
+// staying between MinFactor and MaxFactor
+type AdaptiveRule struct {
+	TargetP99Ms  int     `json:"target_p99_ms,omitempty"`  // Back off while p99 latency is above this
+	MaxErrorRate float64 `json:"max_error_rate,omitempty"` // Back off while the share of 5xx responses is above this
+	MinFactor    float64 `json:"min_factor,omitempty"`     // Default 0.1
+	MaxFactor    float64 `json:"max_factor,omitempty"`     // Default 1, the configured limits
+}
+
+// Bounds returns the factor range with defaults applied
+func (a AdaptiveRule) Bounds() (float64, float64) {
+	lo, hi := a.MinFactor, a.MaxFactor
+	if lo == 0 {
+		lo = 0.1
+	}
+	if hi == 0 {
+		hi = 1
+	}
+	return lo, hi
+}
+
+// ConcurrencyRule bounds how many requests may be in flight at once, which
+// rate limits alone don't when requests are slow. Zero leaves a scope unbounded.
+type ConcurrencyRule struct {
+	PerClient    int `json:"per_client,omitempty"`    // Per user, or per client IP for anonymous requests
+	PerRoute     int `json:"per_route,omitempty"`     // Shared by every request matching the policy
+	RejectStatus int `json:"reject_status,omitempty"` // 429 (default) or 503
+}
+
+// HeaderSet selects the rate limit headers sent to clients
+type HeaderSet string
+
+const (
+	HeadersBoth   HeaderSet = "both"   // IETF and legacy
+	HeadersIETF   HeaderSet = "ietf"   // RateLimit and RateLimit-Policy
+	HeadersLegacy HeaderSet = "legacy" // X-RateLimit-*
+	HeadersNone   HeaderSet = "none"   // Only Retry-After on 429
+)
+
+// IETF reports whether the set includes the RateLimit and RateLimit-Policy headers
+func (h HeaderSet) IETF() bool {
+	return h == "" || h == HeadersBoth || h == HeadersIETF
+}
+
+// Legacy reports whether the set includes the X-RateLimit-* headers
+func (h HeaderSet) Legacy() bool {
+	return h == "" || h == HeadersBoth || h == HeadersLegacy
+}
+
+// CostRule weighs requests for rate limiting. Expensive endpoints (exports,
+// searches) can cost more than one token, up front or once the upstream
+// reports what the request actually took.
+type CostRule struct {
+	Fixed   int64            `json:"fixed,omitempty"`   // Default 1
+	Methods map[string]int64 `json:"methods,omitempty"` // Per HTTP method, overriding Fixed
+	// Response header with the request's actual cost. Anything above the
+	// up-front cost is debited when the response is written; less is not refunded.
+	Header string `json:"header,omitempty"`
+}
+
+// CircuitBreakerRule guards the upstream behind a policy with a breaker (see
+// circuitbreaker.Config). Policies that name the same breaker share it, so an
+// upstream serving several routes is cut off for all of them at once.
+type CircuitBreakerRule struct {
+	Name             string                    `json:"name,omitempty"`              // Empty uses the policy ID; see Policy.Breaker
+	FailureThreshold int64                     `json:"failure_threshold,omitempty"` // Default 5
+	SuccessThreshold int64                     `json:"success_threshold,omitempty"` // Default 1
+	TimeoutMs        int64                     `json:"timeout_ms,omitempty"`        // Open this long before probing; default 30000
+	HalfOpenProbes   int64                     `json:"half_open_probes,omitempty"`  // Default 1
+	Window           circuitbreaker.WindowType `json:"window,omitempty"`            // count, time, or empty for consecutive failures
+	WindowSize       int64                     `json:"window_size,omitempty"`       // Calls, or seconds
+	MinimumCalls     int64                     `json:"minimum_calls,omitempty"`
+	FailureRate      float64                   `json:"failure_rate,omitempty"` // Percent
+	SlowCallMs       int64                     `json:"slow_call_ms,omitempty"`
+	SlowCallRate     float64                   `json:"slow_call_rate,omitempty"` // Percent
+
+	// Response statuses that count as failures; empty means every 5xx
+	FailureStatuses []int `json:"failure_statuses,omitempty"`
+	// Requests still running after this long are cancelled and count as failures; 0 sets no deadline
+	RequestTimeoutMs int64 `json:"request_timeout_ms,omitempty"`
+}
+
+// Config returns the breaker's settings with defaults filled in
+func (c *CircuitBreakerRule) Config() circuitbreaker.Config {
+	cfg := circuitbreaker.Config{
+		FailureThreshold: c.FailureThreshold,
+		SuccessThreshold: c.SuccessThreshold,
+		Timeout:          time.Duration(c.TimeoutMs) * time.Millisecond,
+		HalfOpenProbes:   c.HalfOpenProbes,
+		Window:           c.Window,
+		WindowSize:       c.WindowSize,
+		MinimumCalls:     c.MinimumCalls,
+		FailureRate:      c.FailureRate,
+		SlowCallDuration: time.Duration(c.SlowCallMs) * time.Millisecond,
+		SlowCallRate:     c.SlowCallRate,
+	}
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.SuccessThreshold == 0 {
+		cfg.SuccessThreshold = 1
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return cfg
+}
+
+// Failed reports whether a response status counts as a failure
+func (c *CircuitBreakerRule) Failed(status int) bool {
+	if len(c.FailureStatuses) == 0 {
+		return status >= 500
+	}
+	for _, s := range c.FailureStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CircuitBreakerRule) validate() error {
+	if c.TimeoutMs < 0 || c.SlowCallMs < 0 || c.RequestTimeoutMs < 0 {
+		return fmt.Errorf("%w: circuit_breaker durations must not be negative", ErrInvalidRules)
+	}
+	for _, s := range c.FailureStatuses {
+		if s < 100 || s > 599 {
+			return fmt.Errorf("%w: circuit_breaker failure status %d is not an HTTP status", ErrInvalidRules, s)
+		}
+	}
+	if err := c.Config().Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRules, err)
+	}
+	return nil
+}
+
+// Rate limit scopes for Rules.Limits. The policy's own rate_limit and burst
+// apply per user (or per client IP for anonymous requests).
+const (
+	ScopeKey    = "key"    // Per API key; skipped for other authentication methods
+	ScopeTenant = "tenant" // Shared by the caller's tenant
+	ScopeRoute  = "route"  // Shared by every request matching the policy
+	ScopeGlobal = "global" // Shared by every request to the gateway; global policies only
+)
+
+// ScopedLimit is one extra level of a hierarchical rate limit
+type ScopedLimit struct {
+	Scope     string            `json:"scope"`
+	RateLimit float64           `json:"rate_limit"`
+	Burst     int               `json:"burst"`
+	Algorithm limiter.Algorithm `json:"algorithm,omitempty"` // Empty inherits the policy's
+}
+
+// Validate rejects rules the middleware could not enforce
+func (r Rules) Validate() error {
+	if err := validateLimit(r.Algorithm, r.RateLimit); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, l := range r.Limits {
+		switch l.Scope {
+		case ScopeKey, ScopeTenant, ScopeRoute, ScopeGlobal:
+		default:
+			return fmt.Errorf("%w: unknown limit scope %q", ErrInvalidRules, l.Scope)
+		}
+		if seen[l.Scope] {
+			return fmt.Errorf("%w: duplicate limit scope %q", ErrInvalidRules, l.Scope)
+		}
+		seen[l.Scope] = true
+		if err := validateLimit(r.algorithmFor(l), l.RateLimit); err != nil {
+			return err
+		}
+	}
+	if r.FailureStrategy != "" && !r.FailureStrategy.Valid() {
+		return fmt.Errorf("%w: unknown failure_strategy %q", ErrInvalidRules, r.FailureStrategy)
+	}
+	switch r.RateLimitHeaders {
+	case "", HeadersBoth, HeadersIETF, HeadersLegacy, HeadersNone:
+	default:
+		return fmt.Errorf("%w: unknown rate_limit_headers %q", ErrInvalidRules, r.RateLimitHeaders)
+	}
+	if c := r.Concurrency; c != nil {
+		if c.PerClient < 0 || c.PerRoute < 0 {
+			return fmt.Errorf("%w: negative concurrency limit", ErrInvalidRules)
+		}
+		switch c.RejectStatus {
+		case 0, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		default:
+			return fmt.Errorf("%w: concurrency reject_status must be 429 or 503", ErrInvalidRules)
+		}
+	}
+	if a := r.Adaptive; a != nil {
+		lo, hi := a.Bounds()
+		switch {
+		case a.TargetP99Ms <= 0 && a.MaxErrorRate <= 0:
+			return fmt.Errorf("%w: adaptive needs target_p99_ms or max_error_rate", ErrInvalidRules)
+		case a.TargetP99Ms < 0 || a.MaxErrorRate < 0 || a.MaxErrorRate > 1:
+			return fmt.Errorf("%w: adaptive targets out of range", ErrInvalidRules)
+		case lo <= 0 || lo > hi:
+			return fmt.Errorf("%w: adaptive needs 0 < min_factor <= max_factor", ErrInvalidRules)
+		}
+	}
+	if err := r.validateBatch(); err != nil {
+		return err
+	}
+	if _, err := ParseKeyTemplate(r.RateLimitKey); err != nil {
+		return err
+	}
+	if r.CircuitBreaker != nil {
+		if err := r.CircuitBreaker.validate(); err != nil {
+			return err
+		}
+	}
+	return r.validateCost()
+}
+
+// validateBatch rejects batching of levels that can't take tokens back
+func (r Rules) validateBatch() error {
+	b := r.Batch
+	if b == nil {
+		return nil
+	}
+	if b.Size < 1 || b.MaxHoldMs < 0 {
+		return fmt.Errorf("%w: batch needs a positive size", ErrInvalidRules)
+	}
+	limits := []limiter.Limit{r.Limit()}
+	for _, l := range r.Limits {
+		limits = append(limits, r.ScopedLimit(l))
+	}
+	for _, l := range limits {
+		if l.Algorithm != "" && l.Algorithm != limiter.TokenBucket {
+			return fmt.Errorf("%w: batch requires token_bucket, not %s", ErrInvalidRules, l.Algorithm)
+		}
+		if b.Size > l.Burst {
+			return fmt.Errorf("%w: batch size %d exceeds burst %d", ErrInvalidRules, b.Size, l.Burst)
+		}
+	}
+	return nil
+}
+
+// validateCost rejects costs no level could ever allow
+func (r Rules) validateCost() error {
+	if r.Cost == nil {
+		return nil
+	}
+	highest := r.Cost.Fixed
+	if highest < 0 {
+		return fmt.Errorf("%w: negative cost", ErrInvalidRules)
+	}
+	for method, n := range r.Cost.Methods {
+		if n < 1 {
+			return fmt.Errorf("%w: cost for %s must be at least 1", ErrInvalidRules, method)
+		}
+		highest = max(highest, n)
+	}
+	bursts := []int{r.Burst}
+	for _, l := range r.Limits {
+		bursts = append(bursts, l.Burst)
+	}
+	for _, b := range bursts {
+		if highest > int64(b) {
+			return fmt.Errorf("%w: cost %d exceeds burst %d", ErrInvalidRules, highest, b)
+		}
+	}
+	return nil
+}
+
+func validateLimit(a limiter.Algorithm, rate float64) error {
+	if !a.Valid() {
+		return fmt.Errorf("%w: unknown algorithm %q", ErrInvalidRules, a)
+	}
+	if a != "" && a != limiter.TokenBucket && rate <= 0 {
+		return fmt.Errorf("%w: %s needs a positive rate_limit", ErrInvalidRules, a)
+	}
+	return nil
+}
+
+// algorithmFor returns the algorithm a scoped limit runs with
+func (r Rules) algorithmFor(l ScopedLimit) limiter.Algorithm {
+	if l.Algorithm == "" {
+		return r.Algorithm
+	}
+	return l.Algorithm
+}
+
+// Limit returns the per-user limit
+func (r Rules) Limit() limiter.Limit {
+	return r.batched(limiter.Limit{Algorithm: r.Algorithm, Rate: r.RateLimit, Burst: r.Burst})
+}
+
+// ScopedLimit returns the limit of one of Limits
+func (r Rules) ScopedLimit(l ScopedLimit) limiter.Limit {
+	return r.batched(limiter.Limit{Algorithm: r.algorithmFor(l), Rate: l.RateLimit, Burst: l.Burst})
+}
+
+func (r Rules) batched(l limiter.Limit) limiter.Limit {
+	if r.Batch != nil {
+		l.Lease, l.LeaseTTL = r.Batch.Size, r.Batch.holdTTL()
+	}
+	return l
+}
+
+// RequestCost returns what a request with the given method spends up front
+func (r Rules) RequestCost(method string) int64 {
+	if r.Cost == nil {
+		return 1
+	}
+	if n, ok := r.Cost.Methods[method]; ok {
+		return n
+	}
+	if r.Cost.Fixed > 0 {
+		return r.Cost.Fixed
+	}
+	return 1
+}
+
+// Exempt reports whether a principal or API key ID skips rate limiting
+func (r Rules) Exempt(ids ...string) bool {
+	for _, e := range r.RateLimitExempt {
+		for _, id := range ids {
+			if id != "" && id == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OnFailure returns the configured failure strategy or the default
+func (r Rules) OnFailure() reliability.FailureStrategy {
+	if r.FailureStrategy == "" {
+		return reliability.FailLocal
+	}
+	return r.FailureStrategy
 }
 
 // Policy is a named set of rules
 type Policy struct {
-	ID      string  `json:"id"`
-	Matcher Matcher `json:"matcher"`
-	Rules   Rules   `json:"rules"`
+	ID       string  `json:"id"`
+	TenantID string  `json:"tenant_id,omitempty"` // Empty for global policies
+	Priority int     `json:"priority,omitempty"`  // Lower is evaluated first when loaded from storage
+	Matcher  Matcher `json:"matcher"`
+	Rules    Rules   `json:"rules"`
+
+	keyTemplate []KeyPart // Rules.RateLimitKey, parsed when the policy is loaded
 }
 
+// KeyTemplate returns the parsed rate limit key template, or nil if the
+// policy has none or was not loaded into an Engine
+func (p *Policy) KeyTemplate() []KeyPart {
+	return p.keyTemplate
+}
+
+// Breaker returns the name of the breaker guarding the policy's requests:
+// Rules.CircuitBreaker.Name, or the policy ID. Names of tenant policies are
+// prefixed with "tenant:<id>:", so a tenant can only share or trip its own
+// breakers.
+func (p *Policy) Breaker() string {
+	name := p.ID
+	if c := p.Rules.CircuitBreaker; c != nil && c.Name != "" {
+		name = c.Name
+	}
+	if p.TenantID == "" {
+		return name
+	}
+	return "tenant:" + tenantEscaper.Replace(p.TenantID) + ":" + name
+}
+
+// Validate checks the rules and that a tenant policy only limits its own
+// tenant's traffic: a global limit would throttle every tenant's requests
+// at the rate the tenant chose.
+func (p *Policy) Validate() error {
+	if err := p.Rules.Validate(); err != nil {
+		return err
+	}
+	if p.TenantID != "" {
+		for _, l := range p.Rules.Limits {
+			if l.Scope == ScopeGlobal {
+				return fmt.Errorf("%w: tenant policies cannot set a global limit", ErrInvalidRules)
+			}
+		}
+	}
+	return nil
+}
+
+// tenantEscaper keeps a tenant ID containing ':' from forging another tenant's prefix
+var tenantEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
 // Engine evaluates requests against policies
 type Engine struct {
 	mu       sync.RWMutex
@@ -38,23 +485,50 @@ func NewEngine() *Engine {
 	}
 }
 
-// LoadPolicies replaces the current set
+// LoadPolicies replaces the current set. Key templates are parsed here, once,
+// rather than per request. Policies are expected to pass Validate first; one
+// whose template doesn't parse anyway keys by client.
 func (e *Engine) LoadPolicies(newPolicies []Policy) {
+	for i := range newPolicies {
+		newPolicies[i].keyTemplate, _ = ParseKeyTemplate(newPolicies[i].Rules.RateLimitKey)
+	}
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.policies = newPolicies
 }
 
-// Evaluate finds the first matching policy
+// Policies returns a copy of the current set
+func (e *Engine) Policies() []Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	out := make([]Policy, len(e.policies))
+	copy(out, e.policies)
+	return out
+}
+
+// Evaluate finds the first matching global policy
 // Conflict Resolution: First Match Wins (ordered list).
 // Production Note: Verify specificity sorting (Longest Path Match).
 func (e *Engine) Evaluate(r *http.Request) *Policy {
+	return e.evaluate(r, "")
+}
+
+// EvaluateTenant finds the first matching policy scoped to tenantID, or nil.
+// Tenant policies take precedence over global ones once the caller's tenant is known.
+func (e *Engine) EvaluateTenant(r *http.Request, tenantID string) *Policy {
+	if tenantID == "" {
+		return nil
+	}
+	return e.evaluate(r, tenantID)
+}
+
+func (e *Engine) evaluate(r *http.Request, tenantID string) *Policy {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	for i := range e.policies {
 		p := &e.policies[i]
-		if match(p.Matcher, r) {
+		if p.TenantID == tenantID && match(p.Matcher, r) {
 			return p
 		}
 	}
@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raakeshmj/apigatewayplane/internal/circuitbreaker"
+)
+
+func TestEngine_TenantPolicies(t *testing.T) {
+	eng := NewEngine()
+	eng.LoadPolicies([]Policy{
+		{ID: "acme-api", TenantID: "acme", Matcher: Matcher{Path: "/api"}, Rules: Rules{RateLimit: 50}},
+		{ID: "global-api", Matcher: Matcher{Path: "/api"}, Rules: Rules{RateLimit: 5}},
+	})
+	r := httptest.NewRequest("GET", "/api/orders", nil)
+
+	// Tenant policies never match before the tenant is known
+	if p := eng.Evaluate(r); p == nil || p.ID != "global-api" {
+		t.Errorf("Expected global-api, got %v", p)
+	}
+	if p := eng.EvaluateTenant(r, "acme"); p == nil || p.ID != "acme-api" {
+		t.Errorf("Expected acme-api, got %v", p)
+	}
+	if p := eng.EvaluateTenant(r, "globex"); p != nil {
+		t.Errorf("Expected no policy for globex, got %s", p.ID)
+	}
+}
+
+func TestEngine_ParsesKeyTemplatesOnLoad(t *testing.T) {
+	eng := NewEngine()
+	eng.LoadPolicies([]Policy{
+		{ID: "keyed", Matcher: Matcher{Path: "/api"}, Rules: Rules{RateLimitKey: "h:{header:X-Client-ID}"}},
+		{ID: "plain", Matcher: Matcher{Path: "/"}},
+	})
+	if p := eng.Evaluate(httptest.NewRequest("GET", "/api", nil)); len(p.KeyTemplate()) != 2 {
+		t.Errorf("Expected a parsed two-part template, got %+v", p.KeyTemplate())
+	}
+	if p := eng.Evaluate(httptest.NewRequest("GET", "/", nil)); p.KeyTemplate() != nil {
+		t.Errorf("Expected no template, got %+v", p.KeyTemplate())
+	}
+}
+
+func TestPolicy_Breaker(t *testing.T) {
+	named := &CircuitBreakerRule{Name: "unstable"}
+	tests := []struct {
+		p    Policy
+		want string
+	}{
+		{Policy{ID: "billing", Rules: Rules{CircuitBreaker: &CircuitBreakerRule{}}}, "billing"},
+		{Policy{ID: "billing", Rules: Rules{CircuitBreaker: named}}, "unstable"},
+		{Policy{ID: "acme-api", TenantID: "acme", Rules: Rules{CircuitBreaker: &CircuitBreakerRule{}}}, "tenant:acme:acme-api"},
+		// A tenant naming a shared breaker gets its own
+		{Policy{ID: "acme-api", TenantID: "acme", Rules: Rules{CircuitBreaker: named}}, "tenant:acme:unstable"},
+		{Policy{ID: "x", TenantID: "acme:unstable", Rules: Rules{CircuitBreaker: named}}, "tenant:acme%3Aunstable:unstable"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Breaker(); got != tt.want {
+			t.Errorf("%s/%s: expected breaker %q, got %q", tt.p.TenantID, tt.p.ID, tt.want, got)
+		}
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	valid := []Rules{
+		{RateLimit: 1, Burst: 1},
+		{RateLimit: 1, Burst: 1, Algorithm: "gcra", FailureStrategy: "fail_closed", RateLimitHeaders: HeadersIETF},
+		{RateLimit: 1, Burst: 1, Limits: []ScopedLimit{{Scope: ScopeTenant, RateLimit: 10, Burst: 20}, {Scope: ScopeGlobal, RateLimit: 100, Burst: 100}}},
+		{RateLimit: 1, Burst: 10, Cost: &CostRule{Fixed: 2, Methods: map[string]int64{"POST": 10}, Header: "X-Request-Cost"}},
+		{RateLimit: 1, Burst: 1, Concurrency: &ConcurrencyRule{PerClient: 2, PerRoute: 50, RejectStatus: 503}},
+		{RateLimit: 1, Burst: 1, RateLimitKey: "tenant:{tenant}:route:{route}:client:{header:X-Client-ID}:{path:2}", RateLimitExempt: []string{"svc-health"}},
+		{RateLimit: 1, Burst: 1, CircuitBreaker: &CircuitBreakerRule{Name: "billing", Window: circuitbreaker.WindowTime, WindowSize: 30, FailureRate: 50, FailureStatuses: []int{502, 503, 504}}},
+		{RateLimit: 10, Burst: 20, Limits: []ScopedLimit{{Scope: ScopeGlobal, RateLimit: 100, Burst: 200}}, Batch: &BatchRule{Size: 10, MaxHoldMs: 500}},
+		{RateLimit: 1, Burst: 1, Adaptive: &AdaptiveRule{TargetP99Ms: 250, MaxErrorRate: 0.05, MinFactor: 0.2, MaxFactor: 2}},
+	}
+	for _, r := range valid {
+		if err := r.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", r, err)
+		}
+	}
+
+	invalid := []Rules{
+		{Algorithm: "leaky"},
+		{Algorithm: "sliding_window_log", Burst: 10},
+		{FailureStrategy: "fail_maybe"},
+		{RateLimitHeaders: "draft-7"},
+		{Concurrency: &ConcurrencyRule{PerClient: 5, RejectStatus: 500}},
+		{Adaptive: &AdaptiveRule{MinFactor: 0.5}},
+		{Burst: 10, Batch: &BatchRule{Size: 20}},
+		{RateLimitKey: "user:{user}:{nope}"},
+		{RateLimitKey: "{header}"},
+		{RateLimitKey: "{path:-1}"},
+		{CircuitBreaker: &CircuitBreakerRule{Window: circuitbreaker.WindowCount, WindowSize: 20}},
+		{CircuitBreaker: &CircuitBreakerRule{FailureStatuses: []int{42}}},
+		{Burst: 10, Limits: []ScopedLimit{{Scope: ScopeGlobal, RateLimit: 1, Burst: 100, Algorithm: "gcra"}}, Batch: &BatchRule{Size: 5}},
+		{Adaptive: &AdaptiveRule{TargetP99Ms: 200, MinFactor: 2}}, // Above the default max
+		{Limits: []ScopedLimit{{Scope: "planet"}}},
+		{Limits: []ScopedLimit{{Scope: ScopeRoute}, {Scope: ScopeRoute}}},
+		{Algorithm: "gcra", RateLimit: 1, Limits: []ScopedLimit{{Scope: ScopeTenant}}}, // Inherits gcra without a rate
+		{Burst: 5, Cost: &CostRule{Methods: map[string]int64{"GET": 0}}},
+		{Burst: 5, Limits: []ScopedLimit{{Scope: ScopeTenant, Burst: 3}}, Cost: &CostRule{Fixed: 4}}, // Never fits the tenant level
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("Expected %+v to be invalid, got %v", r, err)
+		}
+	}
+}
+
+func TestRules_RequestCost(t *testing.T) {
+	r := Rules{Cost: &CostRule{Fixed: 3, Methods: map[string]int64{"POST": 10}}}
+	for method, want := range map[string]int64{"GET": 3, "POST": 10} {
+		if got := r.RequestCost(method); got != want {
+			t.Errorf("%s: expected cost %d, got %d", method, want, got)
+		}
+	}
+	if got := (Rules{}).RequestCost("GET"); got != 1 {
+		t.Errorf("Expected default cost 1, got %d", got)
+	}
+}
+
+func TestParseKeyTemplate(t *testing.T) {
+	parts, err := ParseKeyTemplate("tenant:{tenant}:h:{header:X-Client-ID}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KeyPart{{Literal: "tenant:"}, {Attr: KeyTenant}, {Literal: ":h:"}, {Attr: KeyHeader, Arg: "X-Client-ID"}}
+	if len(parts) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, parts)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("part %d: expected %+v, got %+v", i, want[i], parts[i])
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Attributes a rate limit key template can use, as {name} or {name:arg}
+const (
+	KeyTenant = "tenant" // The caller's tenant
+	KeyUser   = "user"   // The principal's ID
+	KeyIP     = "ip"     // The client IP, without port
+	KeyClient = "client" // The principal's ID, or the client IP for anonymous requests
+	KeyAPIKey = "key"    // The ID of the API key used
+	KeyRoute  = "route"  // The matched policy's ID
+	KeyMethod = "method" // The HTTP method
+	KeyHeader = "header" // {header:X-Client-ID}
+	KeyClaim  = "claim"  // {claim:org} from a verified JWT
+	KeyPath   = "path"   // {path:2} is the third path segment: "42" in /api/orders/42
+)
+
+var keyPlaceholder = regexp.MustCompile(`\{([a-z]+)(?::([^{}]+))?\}`)
+
+// KeyPart is a literal or an attribute of a parsed key template
+type KeyPart struct {
+	Literal string
+	Attr    string
+	Arg     string
+}
+
+// ParseKeyTemplate splits a template such as "tenant:{tenant}:route:{route}" into parts
+func ParseKeyTemplate(tmpl string) ([]KeyPart, error) {
+	var parts []KeyPart
+	last := 0
+	for _, m := range keyPlaceholder.FindAllStringSubmatchIndex(tmpl, -1) {
+		if m[0] > last {
+			parts = append(parts, KeyPart{Literal: tmpl[last:m[0]]})
+		}
+		part := KeyPart{Attr: tmpl[m[2]:m[3]]}
+		if m[4] >= 0 {
+			part.Arg = tmpl[m[4]:m[5]]
+		}
+		if err := part.validate(); err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		last = m[1]
+	}
+	if last < len(tmpl) {
+		parts = append(parts, KeyPart{Literal: tmpl[last:]})
+	}
+	return parts, nil
+}
+
+func (p KeyPart) validate() error {
+	switch p.Attr {
+	case KeyTenant, KeyUser, KeyIP, KeyClient, KeyAPIKey, KeyRoute, KeyMethod:
+		if p.Arg != "" {
+			return fmt.Errorf("%w: {%s} takes no argument", ErrInvalidRules, p.Attr)
+		}
+	case KeyHeader, KeyClaim:
+		if p.Arg == "" {
+			return fmt.Errorf("%w: {%s} needs a name, as in {%s:name}", ErrInvalidRules, p.Attr, p.Attr)
+		}
+	case KeyPath:
+		if n, err := strconv.Atoi(p.Arg); err != nil || n < 0 {
+			return fmt.Errorf("%w: {path} needs a segment index, as in {path:2}", ErrInvalidRules)
+		}
+	default:
+		return fmt.Errorf("%w: unknown key attribute {%s}", ErrInvalidRules, p.Attr)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// Period is a calendar period in UTC over which a quota counts
+type Period string
+
+const (
+	Day   Period = "day"
+	Month Period = "month"
+)
+
+// Valid reports whether p is a known period
+func (p Period) Valid() bool {
+	return p == Day || p == Month
+}
+
+// Bounds returns the start and end of the period containing t
+func (p Period) Bounds(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	if p == Month {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Subject types a plan can be assigned to
+const (
+	SubjectUser   = "user"
+	SubjectKey    = "key"
+	SubjectTenant = "tenant"
+)
+
+// Subject is who a quota counts requests for
+type Subject struct {
+	Type string `json:"subject_type"`
+	ID   string `json:"subject_id"`
+}
+
+// Quota is a subject's allowance under its plan
+type Quota struct {
+	Subject Subject
+	PlanID  string
+	Limit   int64
+	Period  Period
+}
+
+// Usage is a quota's state in the current period
+type Usage struct {
+	Quota
+	Used    int64
+	ResetAt time.Time
+	Crossed []int // Thresholds, in percent, that this request crossed
+}
+
+// Remaining returns how many requests are left this period
+func (u Usage) Remaining() int64 {
+	return max(0, u.Limit-u.Used)
+}
+
+// Thresholds at which usage is reported
+var Thresholds = []int{80, 100}
+
+// consumeScript counts a request against every quota, or against none when
+// any of them is used up
+// KEYS = one counter per quota
+// ARGV = limits, then the matching expiry times (unix seconds)
+// Returns: {allowed (1/0), used per quota}
+var consumeScript = redis.NewScript(`
+local n = #KEYS
+local used = {}
+local allowed = 1
+for i = 1, n do
+	used[i] = tonumber(redis.call("GET", KEYS[i])) or 0
+	if used[i] + 1 > tonumber(ARGV[i]) then
+		allowed = 0
+	end
+end
+
+if allowed == 1 then
+	for i = 1, n do
+		used[i] = redis.call("INCR", KEYS[i])
+		redis.call("EXPIREAT", KEYS[i], ARGV[n + i])
+	end
+end
+
+local out = {allowed}
+for i = 1, n do
+	out[#out + 1] = used[i]
+end
+return out
+`)
+
+// Counter keeps per-period request counts in Redis
+type Counter struct {
+	client *redis.Client
+}
+
+func NewCounter(client *redis.Client) *Counter {
+	return &Counter{client: client}
+}
+
+// Consume counts one request against all quotas, or against none of them if
+// any is exhausted; it then returns the usage of each with ErrQuotaExceeded
+func (c *Counter) Consume(ctx context.Context, quotas []Quota, now time.Time) ([]Usage, error) {
+	if len(quotas) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(quotas))
+	args := make([]interface{}, 2*len(quotas))
+	usage := make([]Usage, len(quotas))
+	for i, q := range quotas {
+		_, end := q.Period.Bounds(now)
+		keys[i] = counterKey(q.Subject, q.Period, now)
+		args[i] = q.Limit
+		// Keep counters a day past the period so usage can still be read around the boundary
+		args[len(quotas)+i] = end.Add(24 * time.Hour).Unix()
+		usage[i] = Usage{Quota: q, ResetAt: end}
+	}
+
+	vals, err := consumeScript.Run(ctx, c.client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := vals[0] == 1
+	for i := range usage {
+		usage[i].Used = vals[1+i]
+		if allowed {
+			usage[i].Crossed = crossed(usage[i].Used-1, usage[i].Used, usage[i].Limit)
+		}
+	}
+	if !allowed {
+		return usage, ErrQuotaExceeded
+	}
+	return usage, nil
+}
+
+// Get reads a quota's usage without counting a request
+func (c *Counter) Get(ctx context.Context, q Quota, now time.Time) (Usage, error) {
+	_, end := q.Period.Bounds(now)
+	used, err := c.client.Get(ctx, counterKey(q.Subject, q.Period, now)).Int64()
+	if err != nil && err != redis.Nil {
+		return Usage{}, err
+	}
+	return Usage{Quota: q, Used: used, ResetAt: end}, nil
+}
+
+// Reset clears a subject's usage in the current period
+func (c *Counter) Reset(ctx context.Context, s Subject, period Period, now time.Time) error {
+	return c.client.Del(ctx, counterKey(s, period, now)).Err()
+}
+
+// crossed lists the thresholds passed when usage went from before to after
+func crossed(before, after, limit int64) []int {
+	var list []int
+	for _, t := range Thresholds {
+		mark := int64(t) * limit
+		if before*100 < mark && after*100 >= mark {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+func counterKey(s Subject, period Period, now time.Time) string {
+	start, _ := period.Bounds(now)
+	return fmt.Sprintf("quota:%s:%s:%s:%s", s.Type, s.ID, period, start.Format("20060102"))
+}
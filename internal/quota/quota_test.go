@@ -0,0 +1,69 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPeriod_Bounds(t *testing.T) {
+	at := time.Date(2026, 1, 31, 23, 30, 0, 0, time.FixedZone("x", -3600))
+	start, end := Month.Bounds(at) // 00:30 on Feb 1st in UTC
+	if !start.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected month bounds %v - %v", start, end)
+	}
+	start, end = Day.Bounds(at)
+	if !start.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) || end.Sub(start) != 24*time.Hour {
+		t.Errorf("Unexpected day bounds %v - %v", start, end)
+	}
+}
+
+func TestCounter_Consume(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	c := NewCounter(rdb)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	user := Quota{Subject: Subject{SubjectUser, "alice"}, PlanID: "pro", Limit: 10, Period: Month}
+	tenant := Quota{Subject: Subject{SubjectTenant, "acme"}, PlanID: "free", Limit: 5, Period: Day}
+
+	var crossed [][]int
+	for i := 0; i < 5; i++ {
+		usage, err := c.Consume(ctx, []Quota{user, tenant}, now)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		crossed = append(crossed, usage[1].Crossed)
+	}
+	if want := [][]int{nil, nil, nil, {80}, {100}}; !reflect.DeepEqual(crossed, want) {
+		t.Errorf("Expected tenant thresholds %v, got %v", want, crossed)
+	}
+
+	// The exhausted tenant quota must not let the user's count grow
+	usage, err := c.Consume(ctx, []Quota{user, tenant}, now)
+	if !errors.Is(err, ErrQuotaExceeded) || usage[0].Used != 5 || usage[1].Remaining() != 0 {
+		t.Fatalf("Expected the tenant quota to deny, got %+v (%v)", usage, err)
+	}
+
+	// Tomorrow the daily quota starts over, the monthly one does not
+	tomorrow := now.Add(24 * time.Hour)
+	usage, err = c.Consume(ctx, []Quota{user, tenant}, tomorrow)
+	if err != nil || usage[0].Used != 6 || usage[1].Used != 1 {
+		t.Fatalf("Unexpected usage the next day: %+v (%v)", usage, err)
+	}
+
+	if err := c.Reset(ctx, user.Subject, Month, tomorrow); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if u, _ := c.Get(ctx, user, tomorrow); u.Used != 0 || !u.ResetAt.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected reset usage, got %+v", u)
+	}
+}
@@ -0,0 +1,169 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+var (
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+// Role is a named set of permissions assigned to users and service accounts
+type Role string
+
+const (
+	RoleAdmin      Role = "admin"
+	RoleKeyManager Role = "key-manager"
+	RoleAuditor    Role = "auditor"
+	RoleViewer     Role = "viewer"
+)
+
+// Permission is a single admin API action
+type Permission string
+
+const (
+	PermPolicyRead  Permission = "policies:read"
+	PermPolicyWrite Permission = "policies:write"
+	PermKeyCreate   Permission = "keys:create"
+	PermKeyRotate   Permission = "keys:rotate"
+	PermRoleRead    Permission = "roles:read"
+	PermRoleManage  Permission = "roles:manage"
+
+	PermLockoutRead   Permission = "lockouts:read"
+	PermLockoutManage Permission = "lockouts:manage"
+
+	PermServiceAccountRead   Permission = "service_accounts:read"
+	PermServiceAccountManage Permission = "service_accounts:manage"
+
+	PermUserRead   Permission = "users:read"
+	PermUserManage Permission = "users:manage"
+
+	PermTenantRead   Permission = "tenants:read"
+	PermTenantManage Permission = "tenants:manage"
+
+	PermQuotaRead   Permission = "quotas:read"
+	PermQuotaManage Permission = "quotas:manage"
+
+	PermRateLimitRead   Permission = "ratelimits:read"
+	PermRateLimitManage Permission = "ratelimits:manage"
+
+	PermBreakerRead   Permission = "circuit_breakers:read"
+	PermBreakerManage Permission = "circuit_breakers:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermPolicyRead, PermPolicyWrite,
+		PermKeyCreate, PermKeyRotate,
+		PermRoleRead, PermRoleManage,
+		PermLockoutRead, PermLockoutManage,
+		PermServiceAccountRead, PermServiceAccountManage,
+		PermUserRead, PermUserManage,
+		PermTenantRead, PermTenantManage,
+		PermQuotaRead, PermQuotaManage,
+		PermRateLimitRead, PermRateLimitManage,
+		PermBreakerRead, PermBreakerManage,
+	},
+	RoleKeyManager: {PermPolicyRead, PermKeyCreate, PermKeyRotate, PermServiceAccountRead, PermUserRead, PermQuotaRead, PermRateLimitRead},
+	RoleAuditor:    {PermPolicyRead, PermRoleRead, PermLockoutRead, PermServiceAccountRead, PermUserRead, PermTenantRead, PermQuotaRead, PermRateLimitRead, PermBreakerRead},
+	RoleViewer:     {PermPolicyRead},
+}
+
+// ValidRole reports whether role is one of the built-in roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[Role(role)]
+	return ok
+}
+
+// Permissions returns the permissions granted by role
+func Permissions(role Role) []Permission {
+	return rolePermissions[role]
+}
+
+// Grants reports whether role includes perm
+func Grants(role Role, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer checks a subject's role bindings against a permission
+type Authorizer struct {
+	roles repository.RoleRepository
+}
+
+func NewAuthorizer(roles repository.RoleRepository) *Authorizer {
+	return &Authorizer{roles: roles}
+}
+
+// Authorize returns the subject's roles and whether any of them grants perm
+func (a *Authorizer) Authorize(ctx context.Context, subject db.RoleSubject, perm Permission) ([]string, bool, error) {
+	roles, err := a.Roles(ctx, subject)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, r := range roles {
+		if Grants(Role(r), perm) {
+			return roles, true, nil
+		}
+	}
+	return roles, false, nil
+}
+
+// Roles lists the roles bound to a subject
+func (a *Authorizer) Roles(ctx context.Context, subject db.RoleSubject) ([]string, error) {
+	return a.roles.ListRoles(ctx, normalize(subject))
+}
+
+// Granted returns the permissions a subject's roles grant
+func (a *Authorizer) Granted(ctx context.Context, subject db.RoleSubject) (map[Permission]bool, error) {
+	roles, err := a.Roles(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	granted := make(map[Permission]bool)
+	for _, role := range roles {
+		for _, perm := range rolePermissions[Role(role)] {
+			granted[perm] = true
+		}
+	}
+	return granted, nil
+}
+
+// Bindings lists every role binding
+func (a *Authorizer) Bindings(ctx context.Context) ([]*db.RoleBinding, error) {
+	return a.roles.ListBindings(ctx)
+}
+
+// Assign binds a built-in role to a subject
+func (a *Authorizer) Assign(ctx context.Context, subject db.RoleSubject, role string) error {
+	if !ValidRole(role) {
+		return ErrUnknownRole
+	}
+	return a.roles.AssignRole(ctx, normalize(subject), role)
+}
+
+// Revoke removes a role binding from a subject
+func (a *Authorizer) Revoke(ctx context.Context, subject db.RoleSubject, role string) error {
+	if !ValidRole(role) {
+		return ErrUnknownRole
+	}
+	return a.roles.RevokeRole(ctx, normalize(subject), role)
+}
+
+// normalize fills in the defaults principals use: users, in the default tenant
+func normalize(subject db.RoleSubject) db.RoleSubject {
+	if subject.SubjectType == "" {
+		subject.SubjectType = auth.PrincipalUser
+	}
+	subject.TenantID = auth.TenantOrDefault(subject.TenantID)
+	return subject
+}
@@ -0,0 +1,50 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository/memory"
+)
+
+func TestAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	a := NewAuthorizer(memory.New())
+	alice := db.RoleSubject{SubjectType: "user", TenantID: "acme", SubjectID: "alice"}
+
+	if err := a.Assign(ctx, alice, "root"); err != ErrUnknownRole {
+		t.Errorf("Expected ErrUnknownRole, got %v", err)
+	}
+	if err := a.Assign(ctx, alice, string(RoleKeyManager)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := a.Authorize(ctx, alice, PermKeyCreate); !ok {
+		t.Error("Expected a key manager to create keys")
+	}
+	if roles, ok, _ := a.Authorize(ctx, alice, PermRoleManage); ok || len(roles) != 1 {
+		t.Errorf("Expected a key manager not to manage roles, got %v %v", roles, ok)
+	}
+	// The same ID in another tenant is another subject
+	if _, ok, _ := a.Authorize(ctx, db.RoleSubject{SubjectType: "user", TenantID: "globex", SubjectID: "alice"}, PermKeyCreate); ok {
+		t.Error("Expected no permissions for alice of another tenant")
+	}
+
+	granted, err := a.Granted(ctx, alice)
+	if err != nil || len(granted) != len(Permissions(RoleKeyManager)) || !granted[PermKeyRotate] || granted[PermUserManage] {
+		t.Errorf("Expected exactly the key manager permissions, got %v (err %v)", granted, err)
+	}
+
+	// Type and tenant default to a default-tenant user
+	a.Assign(ctx, db.RoleSubject{SubjectID: "bob"}, string(RoleViewer))
+	if roles, _ := a.Roles(ctx, db.RoleSubject{SubjectType: "user", TenantID: "default", SubjectID: "bob"}); len(roles) != 1 {
+		t.Errorf("Expected bob's binding in the default tenant, got %v", roles)
+	}
+	if err := a.Revoke(ctx, alice, string(RoleKeyManager)); err != nil {
+		t.Fatal(err)
+	}
+	if granted, _ := a.Granted(ctx, alice); len(granted) != 0 {
+		t.Errorf("Expected no permissions after revoke, got %v", granted)
+	}
+}
@@ -5,8 +5,18 @@ type FailureStrategy string
 const (
 	FailOpen   FailureStrategy = "fail_open"
 	FailClosed FailureStrategy = "fail_closed"
+	FailLocal  FailureStrategy = "fail_local" // Enforce with in-process state until the shared backend recovers
 )
 
+// Valid reports whether s is a known strategy
+func (s FailureStrategy) Valid() bool {
+	switch s {
+	case FailOpen, FailClosed, FailLocal:
+		return true
+	}
+	return false
+}
+
 // ShouldAllow determines if we should proceed given an error and a strategy
 func ShouldAllow(strategy FailureStrategy, err error) bool {
 	if err == nil {
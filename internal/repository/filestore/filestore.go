@@ -0,0 +1,371 @@
+package filestore
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+var (
+	ErrClosed = errors.New("filestore is closed")
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	logFile      = "wal.log"
+)
+
+// Options tune compaction
+type Options struct {
+	CompactEvery    int           // Records appended before the log is folded into a snapshot
+	CompactInterval time.Duration // Also compact on this interval if anything changed (0 disables)
+}
+
+func DefaultOptions() Options {
+	return Options{
+		CompactEvery:    1000,
+		CompactInterval: 5 * time.Minute,
+	}
+}
+
+// Store is a single-node persistent repository.
+//
+// Every mutation is appended to wal.log as a checksummed JSON record and fsync'd
+// before it is applied in memory. The log is periodically folded into
+// snapshot.json (written to a temp file, fsync'd and renamed), then truncated.
+// On startup the snapshot is loaded and newer log records are replayed; a torn
+// record at the end of the log (crash mid-write) is discarded.
+// Reads are served from memory under a read lock.
+type Store struct {
+	dir  string
+	opts Options
+
+	mu      sync.RWMutex
+	state   *state
+	wal     *os.File
+	walSize int64 // Offset of the end of the last complete record
+	pending int   // Records in the log since the last snapshot
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open loads (or creates) a store in dir
+func Open(dir string, opts Options) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{dir: dir, opts: opts, state: newState()}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, fmt.Errorf("load snapshot: %w", err)
+	}
+	if err := s.replay(); err != nil {
+		return nil, fmt.Errorf("replay log: %w", err)
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, logFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := wal.Stat()
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+	s.wal = wal
+	s.walSize = info.Size()
+
+	if err := s.upgradeBindings(context.Background()); err != nil {
+		wal.Close()
+		return nil, fmt.Errorf("upgrade role bindings: %w", err)
+	}
+
+	if opts.CompactInterval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.compactLoop()
+	}
+	return s, nil
+}
+
+// Close compacts the log and releases the file
+func (s *Store) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	err := s.compactLocked()
+	if cerr := s.wal.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Compact folds the log into a fresh snapshot
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.compactLocked()
+}
+
+func (s *Store) compactLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.CompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if !s.closed && s.pending > 0 {
+				if err := s.compactLocked(); err != nil {
+					log.Printf("filestore: compaction failed: %v", err)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// commit durably appends records, then applies them. Callers hold s.mu.
+func (s *Store) commit(ctx context.Context, recs ...record) error {
+	if s.closed {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+
+	var buf strings.Builder
+	for i := range recs {
+		recs[i].Seq = s.state.Seq + uint64(i) + 1
+		line, err := encodeRecord(recs[i])
+		if err != nil {
+			return err
+		}
+		buf.WriteString(line)
+	}
+
+	n, err := s.wal.WriteString(buf.String())
+	if err == nil {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		// Drop a partial write so later records aren't appended after garbage
+		if terr := s.wal.Truncate(s.walSize); terr != nil {
+			log.Printf("filestore: truncate after failed write: %v", terr)
+		}
+		return err
+	}
+	s.walSize += int64(n)
+
+	for _, rec := range recs {
+		if err := s.state.apply(rec); err != nil {
+			return err
+		}
+	}
+
+	s.pending += len(recs)
+	if s.opts.CompactEvery > 0 && s.pending >= s.opts.CompactEvery {
+		if err := s.compactLocked(); err != nil {
+			// The records are already durable in the log; retry on the next commit
+			log.Printf("filestore: compaction failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// compactLocked writes a snapshot and truncates the log. Callers hold s.mu.
+func (s *Store) compactLocked() error {
+	if s.pending == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+
+	// Records up to state.Seq are in the snapshot; a crash before the truncate
+	// is harmless because replay skips them by sequence number
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if err := s.wal.Sync(); err != nil {
+		return err
+	}
+	s.walSize = 0
+	s.pending = 0
+	return nil
+}
+
+func (s *Store) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	st := newState()
+	if err := json.Unmarshal(data, st); err != nil {
+		return err
+	}
+	st.init()
+	s.state = st
+	return nil
+}
+
+// replay applies log records newer than the snapshot and cuts off a torn tail
+func (s *Store) replay() error {
+	path := filepath.Join(s.dir, logFile)
+	f, err := os.OpenFile(path, os.O_RDWR, 0o600)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var good int64
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			if line != "" {
+				log.Printf("filestore: discarding incomplete record at offset %d", good)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rec, derr := decodeRecord(line)
+		if derr != nil {
+			log.Printf("filestore: discarding corrupt log tail at offset %d: %v", good, derr)
+			break
+		}
+		if rec.Seq > s.state.Seq {
+			if err := s.state.apply(rec); err != nil {
+				return err
+			}
+			s.pending++
+		}
+		good += int64(len(line))
+	}
+
+	if err := f.Truncate(good); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Log lines are "<crc32 hex> <json>\n"
+func encodeRecord(rec record) (string, error) {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	sum := crc32.ChecksumIEEE(body)
+	return fmt.Sprintf("%08x %s\n", sum, body), nil
+}
+
+func decodeRecord(line string) (record, error) {
+	var rec record
+	sumHex, body, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+	if !ok {
+		return rec, errors.New("malformed record")
+	}
+	sum, err := hex.DecodeString(sumHex)
+	if err != nil || len(sum) != 4 {
+		return rec, errors.New("malformed checksum")
+	}
+	want := uint32(sum[0])<<24 | uint32(sum[1])<<16 | uint32(sum[2])<<8 | uint32(sum[3])
+	if crc32.ChecksumIEEE([]byte(body)) != want {
+		return rec, errors.New("checksum mismatch")
+	}
+	err = json.Unmarshal([]byte(body), &rec)
+	return rec, err
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Interface check
+var _ repository.Store = (*Store)(nil)
+
+// Returned entities are copies so callers can't change state behind the log
+func copyUser(u *db.User) *db.User                                { c := *u; return &c }
+func copyAPIKey(k *db.APIKey) *db.APIKey                          { c := *k; return &c }
+func copyServiceAccount(sa *db.ServiceAccount) *db.ServiceAccount { c := *sa; return &c }
+func copyPolicy(p *db.Policy) *db.Policy                          { c := *p; return &c }
+func copyPlan(p *db.QuotaPlan) *db.QuotaPlan                      { c := *p; return &c }
+func copyAssignment(a *db.PlanAssignment) *db.PlanAssignment      { c := *a; return &c }
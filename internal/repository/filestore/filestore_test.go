@@ -0,0 +1,230 @@
+package filestore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/cache"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/service"
+)
+
+func openTestStore(t *testing.T, dir string, opts Options) *Store {
+	t.Helper()
+	s, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return s
+}
+
+func TestFileStore_RecoversFromLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir, Options{})
+
+	if err := s.CreateUser(ctx, &db.User{ID: "u1", Username: "alice", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := s.CreateAPIKey(ctx, &db.APIKey{ID: "k1", UserID: "u1", KeyHash: "h1", IsActive: true}); err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	u1 := db.RoleSubject{SubjectType: "user", TenantID: "default", SubjectID: "u1"}
+	if err := s.AssignRole(ctx, u1, "admin"); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	if err := s.InvalidateAll(ctx, "u1"); err != nil {
+		t.Fatalf("InvalidateAll failed: %v", err)
+	}
+
+	// Simulate a crash: the log is on disk but no snapshot was written
+	s.wal.Close()
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); !os.IsNotExist(err) {
+		t.Fatalf("Expected no snapshot before compaction, got %v", err)
+	}
+
+	s = openTestStore(t, dir, Options{})
+	defer s.Close()
+
+	if _, err := s.Get(ctx, "u1"); err != nil {
+		t.Errorf("Expected user to survive restart: %v", err)
+	}
+	k, err := s.GetByHash(ctx, "h1")
+	if err != nil {
+		t.Fatalf("Expected key to survive restart: %v", err)
+	}
+	if k.IsActive {
+		t.Error("Expected key to stay invalidated after replay")
+	}
+	if roles, _ := s.ListRoles(ctx, u1); len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("Expected [admin], got %v", roles)
+	}
+}
+
+func TestFileStore_DiscardsTornRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir, Options{})
+
+	if err := s.SavePolicy(ctx, &db.Policy{ID: "p1", Name: "first"}); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	s.wal.Close()
+
+	// A crash in the middle of the next append leaves half a record behind
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`1234abcd {"seq":2,"kind":"policy","op":"put","key":"p2","da`)
+	f.Close()
+
+	s = openTestStore(t, dir, Options{})
+	if _, err := s.GetPolicy(ctx, "p1"); err != nil {
+		t.Errorf("Expected p1 to survive: %v", err)
+	}
+	if _, err := s.GetPolicy(ctx, "p2"); err != repository.ErrNotFound {
+		t.Errorf("Expected torn p2 to be discarded, got %v", err)
+	}
+
+	// New writes after recovery must be readable on the next start
+	if err := s.SavePolicy(ctx, &db.Policy{ID: "p3", Name: "third"}); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	s.wal.Close()
+
+	s = openTestStore(t, dir, Options{})
+	defer s.Close()
+	if list, _ := s.ListPolicies(ctx); len(list) != 2 {
+		t.Errorf("Expected 2 policies after second recovery, got %d", len(list))
+	}
+}
+
+func TestFileStore_Compaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir, Options{CompactEvery: 3})
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := s.SavePolicy(ctx, &db.Policy{ID: id, Name: id}); err != nil {
+			t.Fatalf("SavePolicy failed: %v", err)
+		}
+	}
+	if err := s.DeletePolicy(ctx, "a"); err != nil {
+		t.Fatalf("DeletePolicy failed: %v", err)
+	}
+
+	// Three records were folded into the snapshot, two remain in the log
+	if s.pending != 2 {
+		t.Errorf("Expected 2 pending records, got %d", s.pending)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatalf("Expected snapshot after compaction: %v", err)
+	}
+	s.wal.Close()
+
+	s = openTestStore(t, dir, Options{})
+	defer s.Close()
+	list, _ := s.ListPolicies(ctx)
+	if len(list) != 3 || list[0].ID != "b" {
+		t.Errorf("Expected [b c d], got %d policies", len(list))
+	}
+}
+
+func TestFileStore_KeepsCredentialHashes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir, Options{})
+
+	hash, err := auth.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateUser(ctx, &db.User{ID: "u1", Username: "alice", PasswordHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	svc := func(s *Store) *service.AuthService {
+		return service.NewAuthService(s, s, auth.NewJWTManager("secret", time.Minute), cache.NewMemoryCache())
+	}
+	rawKey, err := svc(s).CreateAPIKey(ctx, "default", "u1", "laptop", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(stage string, s *Store) {
+		t.Helper()
+		if p, err := svc(s).AuthenticateAPIKey(ctx, rawKey); err != nil || p.ID != "u1" {
+			t.Fatalf("%s: Expected the key to authenticate u1, got %v, %v", stage, p, err)
+		}
+		keys, _ := s.ListByUser(ctx, "u1")
+		if len(keys) != 1 || keys[0].KeyHash != auth.HashAPIKey(rawKey) {
+			t.Fatalf("%s: Expected the key hash to be kept, got %+v", stage, keys)
+		}
+		u, err := s.Get(ctx, "u1")
+		if err != nil || !auth.CheckPasswordHash("s3cret", u.PasswordHash) {
+			t.Fatalf("%s: Expected the password hash to be kept, got %+v, %v", stage, u, err)
+		}
+	}
+	check("after write", s)
+
+	// Replayed from the log
+	if err := s.UpdateUser(ctx, &db.User{ID: "u1", Username: "alice", PasswordHash: hash, Email: "alice@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	s.wal.Close()
+	s = openTestStore(t, dir, Options{})
+	check("after replay", s)
+
+	// Loaded from a snapshot
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = openTestStore(t, dir, Options{})
+	defer s.Close()
+	check("after reopen", s)
+}
+
+func TestFileStore_UpgradesLegacyBindings(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := openTestStore(t, dir, Options{})
+
+	now := time.Now()
+	s.CreateUser(ctx, &db.User{ID: "alice", Username: "alice", TenantID: "acme", CreatedAt: now})
+	s.CreateUser(ctx, &db.User{ID: "ci", Username: "ci", CreatedAt: now})
+	s.CreateServiceAccount(ctx, &db.ServiceAccount{ID: "ci", TenantID: "acme", CreatedAt: now.Add(-time.Hour)})
+
+	// Bindings written before they named a subject type and tenant
+	var recs []record
+	for _, id := range []string{"alice", "ci", "ghost"} {
+		rec, err := putRecord(kindRoleBinding, id+"\x00admin", &db.RoleBinding{RoleSubject: db.RoleSubject{SubjectID: id}, Role: "admin", CreatedAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := s.commit(ctx, recs...); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	s.Close()
+
+	s = openTestStore(t, dir, Options{})
+	defer s.Close()
+	for _, subject := range []db.RoleSubject{
+		{SubjectType: "user", TenantID: "acme", SubjectID: "alice"},
+		{SubjectType: "service", TenantID: "acme", SubjectID: "ci"}, // Older than the user ci
+		{SubjectType: "user", TenantID: "default", SubjectID: "ghost"},
+	} {
+		if roles, _ := s.ListRoles(ctx, subject); len(roles) != 1 || roles[0] != "admin" {
+			t.Errorf("Expected [admin] for %+v, got %v", subject, roles)
+		}
+	}
+	if bindings, _ := s.ListBindings(ctx); len(bindings) != 3 {
+		t.Errorf("Expected 3 bindings after upgrade, got %d", len(bindings))
+	}
+}
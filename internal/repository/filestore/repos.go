@@ -0,0 +1,426 @@
+package filestore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+// Tenant Repo Implementation
+func (s *Store) GetTenant(ctx context.Context, id string) (*db.Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if t, ok := s.state.Tenants[id]; ok {
+		c := *t
+		return &c, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) ListTenants(ctx context.Context) ([]*db.Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*db.Tenant
+	for _, t := range s.state.Tenants {
+		c := *t
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *Store) CreateTenant(ctx context.Context, t *db.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.Tenants[t.ID]; ok {
+		return repository.ErrAlreadyExists
+	}
+	rec, err := putRecord(kindTenant, t.ID, t)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+// User Repo Implementation
+func (s *Store) Get(ctx context.Context, id string) (*db.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if u, ok := s.state.Users[id]; ok {
+		return copyUser(u), nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) CreateUser(ctx context.Context, user *db.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.Users[user.ID]; ok || s.usernameTaken(user) {
+		return repository.ErrAlreadyExists
+	}
+	rec, err := putRecord(kindUser, user.ID, user)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+func (s *Store) UpdateUser(ctx context.Context, user *db.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.Users[user.ID]; !ok {
+		return repository.ErrNotFound
+	}
+	if s.usernameTaken(user) {
+		return repository.ErrAlreadyExists
+	}
+	rec, err := putRecord(kindUser, user.ID, user)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+// DeleteUser logs the user, key and role binding deletions as one write
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.state.Users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	recs := []record{deleteRecord(kindUser, id)}
+	for hash, k := range s.state.APIKeys {
+		if k.UserID == id && k.OwnerType != auth.PrincipalService {
+			recs = append(recs, deleteRecord(kindAPIKey, hash))
+		}
+	}
+	subject := db.RoleSubject{SubjectType: auth.PrincipalUser, TenantID: auth.TenantOrDefault(u.TenantID), SubjectID: id}
+	for key, b := range s.state.RoleBindings {
+		if b.RoleSubject == subject {
+			recs = append(recs, deleteRecord(kindRoleBinding, key))
+		}
+	}
+	return s.commit(ctx, recs...)
+}
+
+func (s *Store) ListUsers(ctx context.Context, filter repository.UserFilter) ([]*db.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*db.User
+	for _, u := range s.state.Users {
+		if filter.Matches(u) {
+			list = append(list, copyUser(u))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	if filter.Limit > 0 && len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+	return list, nil
+}
+
+// usernameTaken reports whether another user already has user's username. Callers hold s.mu.
+func (s *Store) usernameTaken(user *db.User) bool {
+	for _, u := range s.state.Users {
+		if u.ID != user.ID && u.Username == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey Repo Implementation
+func (s *Store) GetAPIKey(ctx context.Context, id string) (*db.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.state.APIKeys {
+		if k.ID == id {
+			return copyAPIKey(k), nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) GetByHash(ctx context.Context, keyHash string) (*db.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k, ok := s.state.APIKeys[keyHash]; ok {
+		return copyAPIKey(k), nil
+	}
+	return nil, auth.ErrInvalidToken
+}
+
+func (s *Store) ListByUser(ctx context.Context, userID string) ([]*db.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*db.APIKey
+	for _, k := range s.state.APIKeys {
+		if k.UserID == userID {
+			list = append(list, copyAPIKey(k))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, apiKey *db.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := putRecord(kindAPIKey, apiKey.KeyHash, apiKey)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+// InvalidateAll deactivates every key of a user in a single log write
+func (s *Store) InvalidateAll(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var recs []record
+	for hash, k := range s.state.APIKeys {
+		if k.UserID != userID || !k.IsActive {
+			continue
+		}
+		updated := copyAPIKey(k)
+		updated.IsActive = false
+		rec, err := putRecord(kindAPIKey, hash, updated)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, rec)
+	}
+	return s.commit(ctx, recs...)
+}
+
+// Role Repo Implementation
+func (s *Store) ListRoles(ctx context.Context, subject db.RoleSubject) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var roles []string
+	for _, b := range s.state.RoleBindings {
+		if b.RoleSubject == subject {
+			roles = append(roles, b.Role)
+		}
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+func (s *Store) ListBindings(ctx context.Context) ([]*db.RoleBinding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*db.RoleBinding
+	for _, b := range s.state.RoleBindings {
+		c := *b
+		list = append(list, &c)
+	}
+	repository.SortBindings(list)
+	return list, nil
+}
+
+func (s *Store) AssignRole(ctx context.Context, subject db.RoleSubject, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := roleKey(subject, role)
+	if _, ok := s.state.RoleBindings[key]; ok {
+		return nil
+	}
+	rec, err := putRecord(kindRoleBinding, key, &db.RoleBinding{RoleSubject: subject, Role: role, CreatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+func (s *Store) RevokeRole(ctx context.Context, subject db.RoleSubject, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := roleKey(subject, role)
+	if _, ok := s.state.RoleBindings[key]; !ok {
+		return nil
+	}
+	return s.commit(ctx, deleteRecord(kindRoleBinding, key))
+}
+
+// upgradeBindings rewrites role bindings stored before bindings named their
+// subject's type and tenant. Like the SQL migration, a binding goes to the
+// user or service account with its ID, the older one if both exist, or to a
+// default-tenant user if neither does.
+func (s *Store) upgradeBindings(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var recs []record
+	for key, b := range s.state.RoleBindings {
+		if b.SubjectType != "" {
+			continue
+		}
+		up := *b
+		up.SubjectType, up.TenantID = auth.PrincipalUser, auth.DefaultTenant
+		u, isUser := s.state.Users[b.SubjectID]
+		sa, isService := s.state.ServiceAccounts[b.SubjectID]
+		switch {
+		case isService && (!isUser || sa.CreatedAt.Before(u.CreatedAt)):
+			up.SubjectType, up.TenantID = auth.PrincipalService, auth.TenantOrDefault(sa.TenantID)
+		case isUser:
+			up.TenantID = auth.TenantOrDefault(u.TenantID)
+		}
+		rec, err := putRecord(kindRoleBinding, roleKey(up.RoleSubject, up.Role), &up)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, deleteRecord(kindRoleBinding, key), rec)
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	return s.commit(ctx, recs...)
+}
+
+// Service Account Repo Implementation
+func (s *Store) GetServiceAccount(ctx context.Context, id string) (*db.ServiceAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sa, ok := s.state.ServiceAccounts[id]; ok {
+		return copyServiceAccount(sa), nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) ListServiceAccounts(ctx context.Context, teamID string) ([]*db.ServiceAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*db.ServiceAccount
+	for _, sa := range s.state.ServiceAccounts {
+		if teamID == "" || sa.TeamID == teamID {
+			list = append(list, copyServiceAccount(sa))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *Store) CreateServiceAccount(ctx context.Context, sa *db.ServiceAccount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.ServiceAccounts[sa.ID]; ok {
+		return repository.ErrAlreadyExists
+	}
+	rec, err := putRecord(kindServiceAccount, sa.ID, sa)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+// Policy Repo Implementation
+func (s *Store) ListPolicies(ctx context.Context) ([]*db.Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*db.Policy
+	for _, p := range s.state.Policies {
+		list = append(list, copyPolicy(p))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *Store) GetPolicy(ctx context.Context, id string) (*db.Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.state.Policies[id]; ok {
+		return copyPolicy(p), nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) SavePolicy(ctx context.Context, policy *db.Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.state.Policies[policy.ID]; ok {
+		policy.CreatedAt = existing.CreatedAt
+	}
+	rec, err := putRecord(kindPolicy, policy.ID, policy)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+func (s *Store) DeletePolicy(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.state.Policies[id]; !ok {
+		return repository.ErrNotFound
+	}
+	return s.commit(ctx, deleteRecord(kindPolicy, id))
+}
+
+// Quota plans
+
+func (s *Store) ListPlans(ctx context.Context) ([]*db.QuotaPlan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*db.QuotaPlan
+	for _, p := range s.state.QuotaPlans {
+		list = append(list, copyPlan(p))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *Store) GetPlan(ctx context.Context, id string) (*db.QuotaPlan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.state.QuotaPlans[id]; ok {
+		return copyPlan(p), nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) SavePlan(ctx context.Context, plan *db.QuotaPlan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.state.QuotaPlans[plan.ID]; ok {
+		plan.CreatedAt = existing.CreatedAt
+	}
+	rec, err := putRecord(kindQuotaPlan, plan.ID, plan)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+func (s *Store) GetPlanAssignment(ctx context.Context, subjectType, subjectID string) (*db.PlanAssignment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a, ok := s.state.PlanAssignments[assignmentKey(subjectType, subjectID)]; ok {
+		return copyAssignment(a), nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) SetPlanAssignment(ctx context.Context, a *db.PlanAssignment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := putRecord(kindPlanAssignment, assignmentKey(a.SubjectType, a.SubjectID), a)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, rec)
+}
+
+func (s *Store) DeletePlanAssignment(ctx context.Context, subjectType, subjectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := assignmentKey(subjectType, subjectID)
+	if _, ok := s.state.PlanAssignments[key]; !ok {
+		return repository.ErrNotFound
+	}
+	return s.commit(ctx, deleteRecord(kindPlanAssignment, key))
+}
@@ -0,0 +1,238 @@
+package filestore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+)
+
+// Record kinds
+const (
+	kindTenant         = "tenant"
+	kindUser           = "user"
+	kindAPIKey         = "api_key"
+	kindRoleBinding    = "role_binding"
+	kindServiceAccount = "service_account"
+	kindPolicy         = "policy"
+	kindQuotaPlan      = "quota_plan"
+	kindPlanAssignment = "plan_assignment"
+)
+
+// Record operations
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// record is one log entry: the full new value of an entity, or its deletion
+type record struct {
+	Seq  uint64          `json:"seq"`
+	Kind string          `json:"kind"`
+	Op   string          `json:"op"`
+	Key  string          `json:"key"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+func putRecord(kind, key string, v interface{}) (record, error) {
+	data, err := json.Marshal(onDisk(v))
+	if err != nil {
+		return record{}, err
+	}
+	return record{Kind: kind, Op: opPut, Key: key, Data: data}, nil
+}
+
+func deleteRecord(kind, key string) record {
+	return record{Kind: kind, Op: opDelete, Key: key}
+}
+
+// state is the in-memory image of the store; it is also the snapshot format
+type state struct {
+	Seq             uint64                        `json:"seq"`
+	Tenants         map[string]*db.Tenant         `json:"tenants"`
+	Users           map[string]*db.User           `json:"users"`
+	APIKeys         map[string]*db.APIKey         `json:"api_keys"` // By key hash
+	RoleBindings    map[string]*db.RoleBinding    `json:"role_bindings"`
+	ServiceAccounts map[string]*db.ServiceAccount `json:"service_accounts"`
+	Policies        map[string]*db.Policy         `json:"policies"`
+	QuotaPlans      map[string]*db.QuotaPlan      `json:"quota_plans"`
+	PlanAssignments map[string]*db.PlanAssignment `json:"plan_assignments"` // By assignmentKey
+}
+
+func newState() *state {
+	st := &state{}
+	st.init()
+	return st
+}
+
+// init allocates maps missing from an older or empty snapshot
+func (st *state) init() {
+	if st.Tenants == nil {
+		st.Tenants = make(map[string]*db.Tenant)
+	}
+	if st.Users == nil {
+		st.Users = make(map[string]*db.User)
+	}
+	if st.APIKeys == nil {
+		st.APIKeys = make(map[string]*db.APIKey)
+	}
+	if st.RoleBindings == nil {
+		st.RoleBindings = make(map[string]*db.RoleBinding)
+	}
+	if st.ServiceAccounts == nil {
+		st.ServiceAccounts = make(map[string]*db.ServiceAccount)
+	}
+	if st.Policies == nil {
+		st.Policies = make(map[string]*db.Policy)
+	}
+	if st.QuotaPlans == nil {
+		st.QuotaPlans = make(map[string]*db.QuotaPlan)
+	}
+	if st.PlanAssignments == nil {
+		st.PlanAssignments = make(map[string]*db.PlanAssignment)
+	}
+}
+
+func (st *state) apply(rec record) error {
+	var err error
+	switch rec.Kind {
+	case kindTenant:
+		err = applyTo(st.Tenants, rec)
+	case kindUser:
+		err = applyVia(st.Users, rec, (*diskUser).value)
+	case kindAPIKey:
+		err = applyVia(st.APIKeys, rec, (*diskAPIKey).value)
+	case kindRoleBinding:
+		err = applyTo(st.RoleBindings, rec)
+	case kindServiceAccount:
+		err = applyTo(st.ServiceAccounts, rec)
+	case kindPolicy:
+		err = applyTo(st.Policies, rec)
+	case kindQuotaPlan:
+		err = applyTo(st.QuotaPlans, rec)
+	case kindPlanAssignment:
+		err = applyTo(st.PlanAssignments, rec)
+	default:
+		err = fmt.Errorf("unknown record kind %q", rec.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	st.Seq = rec.Seq
+	return nil
+}
+
+func applyTo[T any](m map[string]*T, rec record) error {
+	switch rec.Op {
+	case opPut:
+		v := new(T)
+		if err := json.Unmarshal(rec.Data, v); err != nil {
+			return err
+		}
+		m[rec.Key] = v
+	case opDelete:
+		delete(m, rec.Key)
+	default:
+		return fmt.Errorf("unknown record op %q", rec.Op)
+	}
+	return nil
+}
+
+// applyVia is applyTo for entities stored in an on-disk form D
+func applyVia[D, T any](m map[string]*T, rec record, value func(*D) *T) error {
+	if rec.Op != opPut {
+		return applyTo(m, rec)
+	}
+	d := new(D)
+	if err := json.Unmarshal(rec.Data, d); err != nil {
+		return err
+	}
+	m[rec.Key] = value(d)
+	return nil
+}
+
+// The db models hide password and key hashes from JSON so they never reach
+// API responses, but the store must keep them. Users and API keys are
+// written in these forms instead, in log records and snapshots alike.
+type diskUser struct {
+	db.User
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+func (d *diskUser) value() *db.User {
+	u := d.User
+	u.PasswordHash = d.PasswordHash
+	return &u
+}
+
+type diskAPIKey struct {
+	db.APIKey
+	KeyHash string `json:"key_hash"`
+}
+
+func (d *diskAPIKey) value() *db.APIKey {
+	k := d.APIKey
+	k.KeyHash = d.KeyHash
+	return &k
+}
+
+// onDisk returns the form v is persisted in
+func onDisk(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *db.User:
+		return &diskUser{User: *v, PasswordHash: v.PasswordHash}
+	case *db.APIKey:
+		return &diskAPIKey{APIKey: *v, KeyHash: v.KeyHash}
+	}
+	return v
+}
+
+// snapshot is state as written to snapshot.json
+type snapshot struct {
+	plainState
+	Users   map[string]*diskUser   `json:"users"`
+	APIKeys map[string]*diskAPIKey `json:"api_keys"`
+}
+
+// plainState is state without its JSON methods
+type plainState state
+
+func (st *state) MarshalJSON() ([]byte, error) {
+	snap := snapshot{
+		plainState: plainState(*st),
+		Users:      make(map[string]*diskUser, len(st.Users)),
+		APIKeys:    make(map[string]*diskAPIKey, len(st.APIKeys)),
+	}
+	for id, u := range st.Users {
+		snap.Users[id] = onDisk(u).(*diskUser)
+	}
+	for hash, k := range st.APIKeys {
+		snap.APIKeys[hash] = onDisk(k).(*diskAPIKey)
+	}
+	return json.Marshal(snap)
+}
+
+func (st *state) UnmarshalJSON(data []byte) error {
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	*st = state(snap.plainState)
+	st.Users = make(map[string]*db.User, len(snap.Users))
+	for id, u := range snap.Users {
+		st.Users[id] = u.value()
+	}
+	st.APIKeys = make(map[string]*db.APIKey, len(snap.APIKeys))
+	for hash, k := range snap.APIKeys {
+		st.APIKeys[hash] = k.value()
+	}
+	return nil
+}
+
+func roleKey(subject db.RoleSubject, role string) string {
+	return subject.SubjectType + "\x00" + subject.TenantID + "\x00" + subject.SubjectID + "\x00" + role
+}
+
+func assignmentKey(subjectType, subjectID string) string {
+	return subjectType + "\x00" + subjectID
+}
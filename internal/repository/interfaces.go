@@ -2,18 +2,125 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"strings"
 
 	"github.com/raakeshmj/apigatewayplane/internal/db"
 )
 
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// UserFilter narrows ListUsers. Results are ordered by ID; pass the last ID
+// of a page as After to fetch the next one.
+type UserFilter struct {
+	TenantID string // Empty matches all tenants
+	Query    string // Case-insensitive substring of username or email
+	Disabled *bool  // nil matches both
+	After    string
+	Limit    int // 0 means no limit
+}
+
+// Matches reports whether u passes the filter's Query, Disabled and After
+// conditions; in-memory backends use it to implement ListUsers
+func (f UserFilter) Matches(u *db.User) bool {
+	if f.TenantID != "" && u.TenantID != f.TenantID {
+		return false
+	}
+	if f.After != "" && u.ID <= f.After {
+		return false
+	}
+	if f.Disabled != nil && u.Disabled != *f.Disabled {
+		return false
+	}
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(u.Username), q) && !strings.Contains(strings.ToLower(u.Email), q) {
+			return false
+		}
+	}
+	return true
+}
+
+// SortBindings orders role bindings by tenant, subject and role, as ListBindings returns them
+func SortBindings(list []*db.RoleBinding) {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.TenantID != b.TenantID {
+			return a.TenantID < b.TenantID
+		}
+		if a.SubjectID != b.SubjectID {
+			return a.SubjectID < b.SubjectID
+		}
+		if a.SubjectType != b.SubjectType {
+			return a.SubjectType < b.SubjectType
+		}
+		return a.Role < b.Role
+	})
+}
+
+type TenantRepository interface {
+	GetTenant(ctx context.Context, id string) (*db.Tenant, error)
+	ListTenants(ctx context.Context) ([]*db.Tenant, error)
+	CreateTenant(ctx context.Context, t *db.Tenant) error
+}
+
 type UserRepository interface {
 	Get(ctx context.Context, id string) (*db.User, error)
 	CreateUser(ctx context.Context, user *db.User) error
+	UpdateUser(ctx context.Context, user *db.User) error
+	DeleteUser(ctx context.Context, id string) error // Also deletes the user's API keys and its own role bindings
+	ListUsers(ctx context.Context, filter UserFilter) ([]*db.User, error)
 }
 
 type APIKeyRepository interface {
+	GetAPIKey(ctx context.Context, id string) (*db.APIKey, error)
 	GetByHash(ctx context.Context, keyHash string) (*db.APIKey, error)
 	ListByUser(ctx context.Context, userID string) ([]*db.APIKey, error)
 	CreateAPIKey(ctx context.Context, apiKey *db.APIKey) error
 	InvalidateAll(ctx context.Context, userID string) error
 }
+
+type RoleRepository interface {
+	ListRoles(ctx context.Context, subject db.RoleSubject) ([]string, error)
+	ListBindings(ctx context.Context) ([]*db.RoleBinding, error)
+	AssignRole(ctx context.Context, subject db.RoleSubject, role string) error
+	RevokeRole(ctx context.Context, subject db.RoleSubject, role string) error
+}
+
+type ServiceAccountRepository interface {
+	GetServiceAccount(ctx context.Context, id string) (*db.ServiceAccount, error)
+	ListServiceAccounts(ctx context.Context, teamID string) ([]*db.ServiceAccount, error) // Empty teamID lists all
+	CreateServiceAccount(ctx context.Context, sa *db.ServiceAccount) error
+}
+
+type PolicyRepository interface {
+	ListPolicies(ctx context.Context) ([]*db.Policy, error)
+	GetPolicy(ctx context.Context, id string) (*db.Policy, error)
+	SavePolicy(ctx context.Context, policy *db.Policy) error // Insert or replace by ID
+	DeletePolicy(ctx context.Context, id string) error
+}
+
+type QuotaRepository interface {
+	ListPlans(ctx context.Context) ([]*db.QuotaPlan, error)
+	GetPlan(ctx context.Context, id string) (*db.QuotaPlan, error)
+	SavePlan(ctx context.Context, plan *db.QuotaPlan) error // Insert or replace by ID
+	GetPlanAssignment(ctx context.Context, subjectType, subjectID string) (*db.PlanAssignment, error)
+	SetPlanAssignment(ctx context.Context, a *db.PlanAssignment) error // Insert or replace by subject
+	DeletePlanAssignment(ctx context.Context, subjectType, subjectID string) error
+}
+
+// Store bundles every repository a storage backend provides
+type Store interface {
+	TenantRepository
+	UserRepository
+	APIKeyRepository
+	RoleRepository
+	ServiceAccountRepository
+	PolicyRepository
+	QuotaRepository
+	Close() error
+}
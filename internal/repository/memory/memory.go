@@ -2,7 +2,9 @@ package memory
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/raakeshmj/apigatewayplane/internal/auth"
 	"github.com/raakeshmj/apigatewayplane/internal/db"
@@ -10,36 +12,149 @@ import (
 )
 
 type MemoryRepository struct {
-	users   map[string]*db.User
-	apiKeys map[string]*db.APIKey // Map keyHash -> APIKey
-	mu      sync.RWMutex
+	tenants  map[string]*db.Tenant
+	users    map[string]*db.User
+	apiKeys  map[string]*db.APIKey                         // Map keyHash -> APIKey
+	roles    map[db.RoleSubject]map[string]*db.RoleBinding // Map subject -> role -> binding
+	svcAccs  map[string]*db.ServiceAccount
+	policies map[string]*db.Policy
+	plans    map[string]*db.QuotaPlan
+	planAsgs map[string]*db.PlanAssignment // Map subjectType:subjectID -> assignment
+	mu       sync.RWMutex
 }
 
 func New() *MemoryRepository {
 	return &MemoryRepository{
-		users:   make(map[string]*db.User),
-		apiKeys: make(map[string]*db.APIKey),
+		tenants:  make(map[string]*db.Tenant),
+		users:    make(map[string]*db.User),
+		apiKeys:  make(map[string]*db.APIKey),
+		roles:    make(map[db.RoleSubject]map[string]*db.RoleBinding),
+		svcAccs:  make(map[string]*db.ServiceAccount),
+		policies: make(map[string]*db.Policy),
+		plans:    make(map[string]*db.QuotaPlan),
+		planAsgs: make(map[string]*db.PlanAssignment),
 	}
 }
 
+// Tenant Repo Implementation
+func (r *MemoryRepository) GetTenant(ctx context.Context, id string) (*db.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.tenants[id]; ok {
+		return t, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *MemoryRepository) ListTenants(ctx context.Context) ([]*db.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list []*db.Tenant
+	for _, t := range r.tenants {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *MemoryRepository) CreateTenant(ctx context.Context, t *db.Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tenants[t.ID]; ok {
+		return repository.ErrAlreadyExists
+	}
+	r.tenants[t.ID] = t
+	return nil
+}
+
 // User Repo Implementation
 func (r *MemoryRepository) Get(ctx context.Context, id string) (*db.User, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	if u, ok := r.users[id]; ok {
-		return u, nil
+		return copyUser(u), nil
 	}
-	return nil, auth.ErrInvalidToken // Simplified
+	return nil, repository.ErrNotFound
 }
 
 func (r *MemoryRepository) CreateUser(ctx context.Context, user *db.User) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.users[user.ID] = user
+	if _, ok := r.users[user.ID]; ok || r.usernameTaken(user) {
+		return repository.ErrAlreadyExists
+	}
+	r.users[user.ID] = copyUser(user)
 	return nil
 }
 
+func (r *MemoryRepository) UpdateUser(ctx context.Context, user *db.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[user.ID]; !ok {
+		return repository.ErrNotFound
+	}
+	if r.usernameTaken(user) {
+		return repository.ErrAlreadyExists
+	}
+	r.users[user.ID] = copyUser(user)
+	return nil
+}
+
+func (r *MemoryRepository) DeleteUser(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.users, id)
+	for hash, k := range r.apiKeys {
+		if k.UserID == id && k.OwnerType != auth.PrincipalService {
+			delete(r.apiKeys, hash)
+		}
+	}
+	delete(r.roles, db.RoleSubject{SubjectType: auth.PrincipalUser, TenantID: auth.TenantOrDefault(u.TenantID), SubjectID: id})
+	return nil
+}
+
+func (r *MemoryRepository) ListUsers(ctx context.Context, filter repository.UserFilter) ([]*db.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list []*db.User
+	for _, u := range r.users {
+		if filter.Matches(u) {
+			list = append(list, copyUser(u))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	if filter.Limit > 0 && len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+	return list, nil
+}
+
+// usernameTaken reports whether another user already has user's username
+func (r *MemoryRepository) usernameTaken(user *db.User) bool {
+	for _, u := range r.users {
+		if u.ID != user.ID && u.Username == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
 // APIKey Repo Implementation
+func (r *MemoryRepository) GetAPIKey(ctx context.Context, id string) (*db.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.apiKeys {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
 func (r *MemoryRepository) GetByHash(ctx context.Context, keyHash string) (*db.APIKey, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -79,6 +194,200 @@ func (r *MemoryRepository) InvalidateAll(ctx context.Context, userID string) err
 	return nil
 }
 
+// Role Repo Implementation
+func (r *MemoryRepository) ListRoles(ctx context.Context, subject db.RoleSubject) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var roles []string
+	for role := range r.roles[subject] {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+func (r *MemoryRepository) ListBindings(ctx context.Context) ([]*db.RoleBinding, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list []*db.RoleBinding
+	for _, bindings := range r.roles {
+		for _, b := range bindings {
+			list = append(list, b)
+		}
+	}
+	repository.SortBindings(list)
+	return list, nil
+}
+
+func (r *MemoryRepository) AssignRole(ctx context.Context, subject db.RoleSubject, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.roles[subject] == nil {
+		r.roles[subject] = make(map[string]*db.RoleBinding)
+	}
+	if _, ok := r.roles[subject][role]; !ok {
+		r.roles[subject][role] = &db.RoleBinding{RoleSubject: subject, Role: role, CreatedAt: time.Now()}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) RevokeRole(ctx context.Context, subject db.RoleSubject, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.roles[subject], role)
+	if len(r.roles[subject]) == 0 {
+		delete(r.roles, subject)
+	}
+	return nil
+}
+
+// Service Account Repo Implementation
+func (r *MemoryRepository) GetServiceAccount(ctx context.Context, id string) (*db.ServiceAccount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if sa, ok := r.svcAccs[id]; ok {
+		return sa, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *MemoryRepository) ListServiceAccounts(ctx context.Context, teamID string) ([]*db.ServiceAccount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list []*db.ServiceAccount
+	for _, sa := range r.svcAccs {
+		if teamID == "" || sa.TeamID == teamID {
+			list = append(list, sa)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *MemoryRepository) CreateServiceAccount(ctx context.Context, sa *db.ServiceAccount) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.svcAccs[sa.ID]; ok {
+		return repository.ErrAlreadyExists
+	}
+	r.svcAccs[sa.ID] = sa
+	return nil
+}
+
+// Policy Repo Implementation
+func (r *MemoryRepository) ListPolicies(ctx context.Context) ([]*db.Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list []*db.Policy
+	for _, p := range r.policies {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *MemoryRepository) GetPolicy(ctx context.Context, id string) (*db.Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.policies[id]; ok {
+		return p, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *MemoryRepository) SavePolicy(ctx context.Context, policy *db.Policy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.policies[policy.ID]; ok {
+		policy.CreatedAt = existing.CreatedAt
+	}
+	r.policies[policy.ID] = policy
+	return nil
+}
+
+func (r *MemoryRepository) DeletePolicy(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.policies[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.policies, id)
+	return nil
+}
+
+// Quota Repo Implementation
+func (r *MemoryRepository) ListPlans(ctx context.Context) ([]*db.QuotaPlan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list []*db.QuotaPlan
+	for _, p := range r.plans {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *MemoryRepository) GetPlan(ctx context.Context, id string) (*db.QuotaPlan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.plans[id]; ok {
+		return p, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *MemoryRepository) SavePlan(ctx context.Context, plan *db.QuotaPlan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.plans[plan.ID]; ok {
+		plan.CreatedAt = existing.CreatedAt
+	}
+	r.plans[plan.ID] = plan
+	return nil
+}
+
+func (r *MemoryRepository) GetPlanAssignment(ctx context.Context, subjectType, subjectID string) (*db.PlanAssignment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if a, ok := r.planAsgs[subjectType+":"+subjectID]; ok {
+		return a, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *MemoryRepository) SetPlanAssignment(ctx context.Context, a *db.PlanAssignment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.planAsgs[a.SubjectType+":"+a.SubjectID] = a
+	return nil
+}
+
+func (r *MemoryRepository) DeletePlanAssignment(ctx context.Context, subjectType, subjectID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := subjectType + ":" + subjectID
+	if _, ok := r.planAsgs[key]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.planAsgs, key)
+	return nil
+}
+
+// Users are stored and handed out as copies, so callers can't change the
+// stored user, or race with one another, without UpdateUser
+func copyUser(u *db.User) *db.User { c := *u; return &c }
+
+// Close is a no-op; it satisfies repository.Store
+func (r *MemoryRepository) Close() error {
+	return nil
+}
+
 // Interface check
+var _ repository.TenantRepository = (*MemoryRepository)(nil)
 var _ repository.UserRepository = (*MemoryRepository)(nil)
 var _ repository.APIKeyRepository = (*MemoryRepository)(nil)
+var _ repository.RoleRepository = (*MemoryRepository)(nil)
+var _ repository.ServiceAccountRepository = (*MemoryRepository)(nil)
+var _ repository.PolicyRepository = (*MemoryRepository)(nil)
+var _ repository.QuotaRepository = (*MemoryRepository)(nil)
+var _ repository.Store = (*MemoryRepository)(nil)
@@ -0,0 +1,80 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+const apiKeyColumns = "id, user_id, tenant_id, owner_type, key_hash, prefix, name, scopes, expires_at, created_at, is_active"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*db.APIKey, error) {
+	k := &db.APIKey{}
+	var scopes string
+	var expires sql.NullTime
+	if err := row.Scan(&k.ID, &k.UserID, &k.TenantID, &k.OwnerType, &k.KeyHash, &k.Prefix, &k.Name, &scopes, &expires, &k.CreatedAt, &k.IsActive); err != nil {
+		return nil, err
+	}
+	k.Scopes = decodeList(scopes)
+	k.ExpiresAt = expires.Time
+	return k, nil
+}
+
+func (s *Store) GetAPIKey(ctx context.Context, id string) (*db.APIKey, error) {
+	k, err := scanAPIKey(s.queryRow(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return k, err
+}
+
+func (s *Store) GetByHash(ctx context.Context, keyHash string) (*db.APIKey, error) {
+	k, err := scanAPIKey(s.queryRow(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", keyHash))
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrInvalidToken // Unknown keys are invalid credentials, as in the memory store
+	}
+	return k, err
+}
+
+func (s *Store) ListByUser(ctx context.Context, userID string) ([]*db.APIKey, error) {
+	rows, err := s.query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*db.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, k *db.APIKey) error {
+	_, err := s.exec(ctx, "INSERT INTO api_keys ("+apiKeyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		k.ID, k.UserID, auth.TenantOrDefault(k.TenantID), ownerType(k.OwnerType), k.KeyHash, k.Prefix, k.Name, encodeList(k.Scopes), nullTime(k.ExpiresAt), k.CreatedAt, k.IsActive)
+	return err
+}
+
+func (s *Store) InvalidateAll(ctx context.Context, userID string) error {
+	_, err := s.exec(ctx, "UPDATE api_keys SET is_active = ? WHERE user_id = ?", false, userID)
+	return err
+}
+
+func ownerType(t string) string {
+	if t == "" {
+		return auth.PrincipalUser
+	}
+	return t
+}
@@ -0,0 +1,53 @@
+-- Initial schema: users, API keys, role bindings, service accounts and policies.
+-- Portable between SQLite and Postgres. List-valued columns are stored as JSON text.
+
+CREATE TABLE users (
+	id            TEXT PRIMARY KEY,
+	username      TEXT NOT NULL,
+	password_hash TEXT NOT NULL DEFAULT '',
+	created_at    TIMESTAMP NOT NULL,
+	updated_at    TIMESTAMP NOT NULL
+);
+
+CREATE TABLE api_keys (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	owner_type TEXT NOT NULL DEFAULT 'user',
+	key_hash   TEXT NOT NULL UNIQUE,
+	prefix     TEXT NOT NULL,
+	name       TEXT NOT NULL DEFAULT '',
+	scopes     TEXT NOT NULL DEFAULT '[]',
+	expires_at TIMESTAMP NULL,
+	created_at TIMESTAMP NOT NULL,
+	is_active  BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE role_bindings (
+	subject_id TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (subject_id, role)
+);
+
+CREATE TABLE service_accounts (
+	id          TEXT PRIMARY KEY,
+	name        TEXT NOT NULL,
+	team_id     TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	scopes      TEXT NOT NULL DEFAULT '[]',
+	created_at  TIMESTAMP NOT NULL,
+	updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_service_accounts_team_id ON service_accounts (team_id);
+
+CREATE TABLE policies (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL DEFAULT '',
+	type       TEXT NOT NULL,
+	definition TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,7 @@
+-- User lifecycle: contact email, disabled flag and unique usernames.
+
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX idx_users_username ON users (username);
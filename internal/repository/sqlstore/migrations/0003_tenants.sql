@@ -0,0 +1,19 @@
+-- Multi-tenancy: tenants table and tenant membership of users, keys, service accounts and policies.
+-- Existing rows move to the operator's "default" tenant. Policies with an empty tenant_id are global.
+
+CREATE TABLE tenants (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE users ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX idx_users_tenant_id ON users (tenant_id);
+
+ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE service_accounts ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE policies ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
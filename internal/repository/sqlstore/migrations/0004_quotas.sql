@@ -0,0 +1,19 @@
+-- Quota plans and their assignment to users, API keys and tenants.
+
+CREATE TABLE quota_plans (
+	id            TEXT PRIMARY KEY,
+	name          TEXT NOT NULL,
+	request_limit BIGINT NOT NULL,
+	period        TEXT NOT NULL,
+	created_at    TIMESTAMP NOT NULL,
+	updated_at    TIMESTAMP NOT NULL
+);
+
+CREATE TABLE plan_assignments (
+	subject_type TEXT NOT NULL,
+	subject_id   TEXT NOT NULL,
+	tenant_id    TEXT NOT NULL,
+	plan_id      TEXT NOT NULL REFERENCES quota_plans (id),
+	updated_at   TIMESTAMP NOT NULL,
+	PRIMARY KEY (subject_type, subject_id)
+);
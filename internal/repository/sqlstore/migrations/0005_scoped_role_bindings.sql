@@ -0,0 +1,34 @@
+-- Role bindings name their subject's type and tenant as well as its ID, so a
+-- user never inherits the roles of a service account, or of a subject in
+-- another tenant, with the same ID.
+-- Existing bindings go to the user or service account with their subject ID.
+-- If both exist the older one keeps it. If neither does (admins bootstrapped
+-- before they were created) it goes to a default-tenant user.
+
+CREATE TABLE role_bindings_scoped (
+	subject_type TEXT NOT NULL,
+	tenant_id    TEXT NOT NULL,
+	subject_id   TEXT NOT NULL,
+	role         TEXT NOT NULL,
+	created_at   TIMESTAMP NOT NULL,
+	PRIMARY KEY (subject_type, tenant_id, subject_id, role)
+);
+
+INSERT INTO role_bindings_scoped (subject_type, tenant_id, subject_id, role, created_at)
+SELECT 'service', sa.tenant_id, rb.subject_id, rb.role, rb.created_at
+FROM role_bindings rb
+JOIN service_accounts sa ON sa.id = rb.subject_id
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = rb.subject_id AND u.created_at <= sa.created_at);
+
+INSERT INTO role_bindings_scoped (subject_type, tenant_id, subject_id, role, created_at)
+SELECT 'user', COALESCE(u.tenant_id, 'default'), rb.subject_id, rb.role, rb.created_at
+FROM role_bindings rb
+LEFT JOIN users u ON u.id = rb.subject_id
+WHERE NOT EXISTS (
+	SELECT 1 FROM service_accounts sa
+	WHERE sa.id = rb.subject_id AND (u.id IS NULL OR sa.created_at < u.created_at)
+);
+
+DROP TABLE role_bindings;
+
+ALTER TABLE role_bindings_scoped RENAME TO role_bindings;
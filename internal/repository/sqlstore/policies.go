@@ -0,0 +1,66 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+const policyColumns = "id, tenant_id, name, type, definition, created_at, updated_at"
+
+func scanPolicy(row rowScanner) (*db.Policy, error) {
+	p := &db.Policy{}
+	var def string
+	if err := row.Scan(&p.ID, &p.TenantID, &p.Name, &p.Type, &def, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.Definition = json.RawMessage(def)
+	return p, nil
+}
+
+func (s *Store) ListPolicies(ctx context.Context) ([]*db.Policy, error) {
+	rows, err := s.query(ctx, "SELECT "+policyColumns+" FROM policies ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*db.Policy
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) GetPolicy(ctx context.Context, id string) (*db.Policy, error) {
+	p, err := scanPolicy(s.queryRow(ctx, "SELECT "+policyColumns+" FROM policies WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return p, err
+}
+
+func (s *Store) SavePolicy(ctx context.Context, p *db.Policy) error {
+	_, err := s.exec(ctx, "INSERT INTO policies ("+policyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?) "+
+		"ON CONFLICT (id) DO UPDATE SET tenant_id = excluded.tenant_id, name = excluded.name, type = excluded.type, definition = excluded.definition, updated_at = excluded.updated_at",
+		p.ID, p.TenantID, p.Name, p.Type, string(p.Definition), p.CreatedAt, p.UpdatedAt)
+	return err
+}
+
+func (s *Store) DeletePolicy(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, "DELETE FROM policies WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+const (
+	planColumns       = "id, name, request_limit, period, created_at, updated_at"
+	assignmentColumns = "subject_type, subject_id, tenant_id, plan_id, updated_at"
+)
+
+func scanPlan(row rowScanner) (*db.QuotaPlan, error) {
+	p := &db.QuotaPlan{}
+	if err := row.Scan(&p.ID, &p.Name, &p.Limit, &p.Period, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Store) ListPlans(ctx context.Context) ([]*db.QuotaPlan, error) {
+	rows, err := s.query(ctx, "SELECT "+planColumns+" FROM quota_plans ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*db.QuotaPlan
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) GetPlan(ctx context.Context, id string) (*db.QuotaPlan, error) {
+	p, err := scanPlan(s.queryRow(ctx, "SELECT "+planColumns+" FROM quota_plans WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return p, err
+}
+
+func (s *Store) SavePlan(ctx context.Context, p *db.QuotaPlan) error {
+	_, err := s.exec(ctx, "INSERT INTO quota_plans ("+planColumns+") VALUES (?, ?, ?, ?, ?, ?) "+
+		"ON CONFLICT (id) DO UPDATE SET name = excluded.name, request_limit = excluded.request_limit, period = excluded.period, updated_at = excluded.updated_at",
+		p.ID, p.Name, p.Limit, p.Period, p.CreatedAt, p.UpdatedAt)
+	return err
+}
+
+func (s *Store) GetPlanAssignment(ctx context.Context, subjectType, subjectID string) (*db.PlanAssignment, error) {
+	a := &db.PlanAssignment{}
+	err := s.queryRow(ctx, "SELECT "+assignmentColumns+" FROM plan_assignments WHERE subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Scan(&a.SubjectType, &a.SubjectID, &a.TenantID, &a.PlanID, &a.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *Store) SetPlanAssignment(ctx context.Context, a *db.PlanAssignment) error {
+	_, err := s.exec(ctx, "INSERT INTO plan_assignments ("+assignmentColumns+") VALUES (?, ?, ?, ?, ?) "+
+		"ON CONFLICT (subject_type, subject_id) DO UPDATE SET tenant_id = excluded.tenant_id, plan_id = excluded.plan_id, updated_at = excluded.updated_at",
+		a.SubjectType, a.SubjectID, a.TenantID, a.PlanID, a.UpdatedAt)
+	return err
+}
+
+func (s *Store) DeletePlanAssignment(ctx context.Context, subjectType, subjectID string) error {
+	res, err := s.exec(ctx, "DELETE FROM plan_assignments WHERE subject_type = ? AND subject_id = ?", subjectType, subjectID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+)
+
+func (s *Store) ListRoles(ctx context.Context, subject db.RoleSubject) ([]string, error) {
+	rows, err := s.query(ctx, "SELECT role FROM role_bindings WHERE subject_type = ? AND tenant_id = ? AND subject_id = ? ORDER BY role",
+		subject.SubjectType, subject.TenantID, subject.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (s *Store) ListBindings(ctx context.Context) ([]*db.RoleBinding, error) {
+	rows, err := s.query(ctx, "SELECT subject_type, tenant_id, subject_id, role, created_at FROM role_bindings ORDER BY tenant_id, subject_id, subject_type, role")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*db.RoleBinding
+	for rows.Next() {
+		b := &db.RoleBinding{}
+		if err := rows.Scan(&b.SubjectType, &b.TenantID, &b.SubjectID, &b.Role, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, b)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) AssignRole(ctx context.Context, subject db.RoleSubject, role string) error {
+	_, err := s.exec(ctx, `INSERT INTO role_bindings (subject_type, tenant_id, subject_id, role, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (subject_type, tenant_id, subject_id, role) DO NOTHING`,
+		subject.SubjectType, subject.TenantID, subject.SubjectID, role, time.Now())
+	return err
+}
+
+func (s *Store) RevokeRole(ctx context.Context, subject db.RoleSubject, role string) error {
+	_, err := s.exec(ctx, "DELETE FROM role_bindings WHERE subject_type = ? AND tenant_id = ? AND subject_id = ? AND role = ?",
+		subject.SubjectType, subject.TenantID, subject.SubjectID, role)
+	return err
+}
@@ -0,0 +1,63 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+const serviceAccountColumns = "id, name, tenant_id, team_id, description, scopes, created_at, updated_at"
+
+func scanServiceAccount(row rowScanner) (*db.ServiceAccount, error) {
+	sa := &db.ServiceAccount{}
+	var scopes string
+	if err := row.Scan(&sa.ID, &sa.Name, &sa.TenantID, &sa.TeamID, &sa.Description, &scopes, &sa.CreatedAt, &sa.UpdatedAt); err != nil {
+		return nil, err
+	}
+	sa.Scopes = decodeList(scopes)
+	return sa, nil
+}
+
+func (s *Store) GetServiceAccount(ctx context.Context, id string) (*db.ServiceAccount, error) {
+	sa, err := scanServiceAccount(s.queryRow(ctx, "SELECT "+serviceAccountColumns+" FROM service_accounts WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return sa, err
+}
+
+func (s *Store) ListServiceAccounts(ctx context.Context, teamID string) ([]*db.ServiceAccount, error) {
+	query := "SELECT " + serviceAccountColumns + " FROM service_accounts"
+	var args []interface{}
+	if teamID != "" {
+		query += " WHERE team_id = ?"
+		args = append(args, teamID)
+	}
+
+	rows, err := s.query(ctx, query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*db.ServiceAccount
+	for rows.Next() {
+		sa, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, sa)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) CreateServiceAccount(ctx context.Context, sa *db.ServiceAccount) error {
+	_, err := s.exec(ctx, "INSERT INTO service_accounts ("+serviceAccountColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		sa.ID, sa.Name, sa.TenantID, sa.TeamID, sa.Description, encodeList(sa.Scopes), sa.CreatedAt, sa.UpdatedAt)
+	if isUniqueViolation(err) {
+		return repository.ErrAlreadyExists
+	}
+	return err
+}
@@ -0,0 +1,340 @@
+package sqlstore
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+// openTestStore opens a fresh SQLite file, or Postgres when TEST_POSTGRES_URL is set
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		url = "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	}
+	s, err := Open(context.Background(), url)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStore_MigrationsIdempotent(t *testing.T) {
+	path := "sqlite://" + filepath.Join(t.TempDir(), "migrate.db")
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		s, err := Open(ctx, path)
+		if err != nil {
+			t.Fatalf("Open #%d failed: %v", i+1, err)
+		}
+		var version int
+		if err := s.queryRow(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+			t.Fatalf("Reading schema version failed: %v", err)
+		}
+		migrations, _ := loadMigrations()
+		if version != migrations[len(migrations)-1].version {
+			t.Errorf("Expected schema version %d, got %d", migrations[len(migrations)-1].version, version)
+		}
+		s.Close()
+	}
+}
+
+func TestStore_APIKeys(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	key := &db.APIKey{
+		ID:        "key_1",
+		UserID:    "user-1",
+		KeyHash:   auth.HashAPIKey("raw"),
+		Prefix:    "raw",
+		Name:      "primary",
+		Scopes:    []string{"read", "write"},
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+		IsActive:  true,
+	}
+	if err := s.CreateAPIKey(ctx, key); err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+
+	got, err := s.GetByHash(ctx, key.KeyHash)
+	if err != nil {
+		t.Fatalf("GetByHash failed: %v", err)
+	}
+	if got.UserID != "user-1" || got.OwnerType != auth.PrincipalUser || len(got.Scopes) != 2 || !got.IsActive {
+		t.Errorf("Round trip mismatch: %+v", got)
+	}
+	if !got.CreatedAt.Equal(key.CreatedAt) || !got.ExpiresAt.IsZero() {
+		t.Errorf("Expected created_at %v and no expiry, got %v / %v", key.CreatedAt, got.CreatedAt, got.ExpiresAt)
+	}
+
+	if _, err := s.GetByHash(ctx, "missing"); err != auth.ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken for unknown hash, got %v", err)
+	}
+
+	if err := s.InvalidateAll(ctx, "user-1"); err != nil {
+		t.Fatalf("InvalidateAll failed: %v", err)
+	}
+	list, err := s.ListByUser(ctx, "user-1")
+	if err != nil || len(list) != 1 || list[0].IsActive {
+		t.Errorf("Expected one inactive key, got %v (err %v)", list, err)
+	}
+}
+
+func TestStore_MigratesLegacyBindings(t *testing.T) {
+	path := "sqlite://" + filepath.Join(t.TempDir(), "legacy.db")
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	s, err := Open(ctx, path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	s.CreateUser(ctx, &db.User{ID: "alice", TenantID: "acme", Username: "alice", CreatedAt: now, UpdatedAt: now})
+	s.CreateUser(ctx, &db.User{ID: "ci", Username: "ci", CreatedAt: now, UpdatedAt: now})
+	s.CreateServiceAccount(ctx, &db.ServiceAccount{ID: "ci", TenantID: "acme", Name: "ci", CreatedAt: now.Add(-time.Hour), UpdatedAt: now})
+
+	// Roll role bindings back to their unscoped form
+	for _, stmt := range []string{
+		"DELETE FROM schema_migrations WHERE version = 5",
+		"DROP TABLE role_bindings",
+		"CREATE TABLE role_bindings (subject_id TEXT NOT NULL, role TEXT NOT NULL, created_at TIMESTAMP NOT NULL, PRIMARY KEY (subject_id, role))",
+	} {
+		if _, err := s.exec(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	for _, id := range []string{"alice", "ci", "ghost"} {
+		if _, err := s.exec(ctx, "INSERT INTO role_bindings (subject_id, role, created_at) VALUES (?, 'admin', ?)", id, now); err != nil {
+			t.Fatalf("Inserting legacy binding failed: %v", err)
+		}
+	}
+	s.Close()
+
+	s, err = Open(ctx, path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer s.Close()
+	for _, subject := range []db.RoleSubject{
+		{SubjectType: "user", TenantID: "acme", SubjectID: "alice"},
+		{SubjectType: "service", TenantID: "acme", SubjectID: "ci"}, // Older than the user ci
+		{SubjectType: "user", TenantID: "default", SubjectID: "ghost"},
+	} {
+		if roles, _ := s.ListRoles(ctx, subject); len(roles) != 1 || roles[0] != "admin" {
+			t.Errorf("Expected [admin] for %+v, got %v", subject, roles)
+		}
+	}
+	if bindings, _ := s.ListBindings(ctx); len(bindings) != 3 {
+		t.Errorf("Expected 3 bindings after migration, got %d", len(bindings))
+	}
+}
+
+func TestStore_RolesAndServiceAccounts(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	alice := db.RoleSubject{SubjectType: "user", TenantID: "default", SubjectID: "alice"}
+	for i := 0; i < 2; i++ { // Assigning twice is a no-op
+		if err := s.AssignRole(ctx, alice, "admin"); err != nil {
+			t.Fatalf("AssignRole failed: %v", err)
+		}
+	}
+	s.AssignRole(ctx, alice, "viewer")
+	s.RevokeRole(ctx, alice, "viewer")
+	roles, err := s.ListRoles(ctx, alice)
+	if err != nil || len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("Expected [admin], got %v (err %v)", roles, err)
+	}
+
+	// Bindings are scoped: the same ID in another tenant or of another type is another subject
+	for _, other := range []db.RoleSubject{
+		{SubjectType: "user", TenantID: "acme", SubjectID: "alice"},
+		{SubjectType: "service", TenantID: "default", SubjectID: "alice"},
+	} {
+		if roles, _ := s.ListRoles(ctx, other); len(roles) != 0 {
+			t.Errorf("Expected no roles for %+v, got %v", other, roles)
+		}
+	}
+	s.AssignRole(ctx, db.RoleSubject{SubjectType: "service", TenantID: "default", SubjectID: "alice"}, "viewer")
+	if bindings, _ := s.ListBindings(ctx); len(bindings) != 2 || bindings[0].SubjectType != "service" || bindings[1].Role != "admin" {
+		t.Errorf("Expected a service and a user binding, got %v", bindings)
+	}
+
+	sa := &db.ServiceAccount{ID: "sa-1", Name: "ci", TeamID: "platform", Scopes: []string{"deploy"}, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := s.CreateServiceAccount(ctx, sa); err != nil {
+		t.Fatalf("CreateServiceAccount failed: %v", err)
+	}
+	if err := s.CreateServiceAccount(ctx, sa); err != repository.ErrAlreadyExists {
+		t.Errorf("Expected ErrAlreadyExists, got %v", err)
+	}
+	list, err := s.ListServiceAccounts(ctx, "platform")
+	if err != nil || len(list) != 1 || list[0].Scopes[0] != "deploy" {
+		t.Errorf("Expected one platform account, got %v (err %v)", list, err)
+	}
+}
+
+func TestStore_Policies(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	p := &db.Policy{ID: "p1", Name: "admin", Type: "route", Definition: json.RawMessage(`{"id":"p1"}`), CreatedAt: now, UpdatedAt: now}
+	if err := s.SavePolicy(ctx, p); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	p.Definition = json.RawMessage(`{"id":"p1","rules":{}}`)
+	if err := s.SavePolicy(ctx, p); err != nil {
+		t.Fatalf("SavePolicy (update) failed: %v", err)
+	}
+
+	got, err := s.GetPolicy(ctx, "p1")
+	if err != nil || string(got.Definition) != `{"id":"p1","rules":{}}` {
+		t.Errorf("Expected updated definition, got %v (err %v)", got, err)
+	}
+
+	if err := s.DeletePolicy(ctx, "p1"); err != nil {
+		t.Fatalf("DeletePolicy failed: %v", err)
+	}
+	if _, err := s.GetPolicy(ctx, "p1"); err != repository.ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestStore_UserLifecycle(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, u := range []*db.User{
+		{ID: "u1", Username: "alice", Email: "alice@example.com", CreatedAt: now, UpdatedAt: now},
+		{ID: "u2", Username: "bob", CreatedAt: now, UpdatedAt: now},
+		{ID: "u3", Username: "carol_100%", CreatedAt: now, UpdatedAt: now},
+	} {
+		if err := s.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser %s failed: %v", u.ID, err)
+		}
+	}
+	if err := s.CreateUser(ctx, &db.User{ID: "u4", Username: "alice", CreatedAt: now, UpdatedAt: now}); err != repository.ErrAlreadyExists {
+		t.Errorf("Expected ErrAlreadyExists for duplicate username, got %v", err)
+	}
+
+	u, _ := s.Get(ctx, "u2")
+	u.Disabled = true
+	if err := s.UpdateUser(ctx, u); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+
+	disabled := true
+	if list, _ := s.ListUsers(ctx, repository.UserFilter{Disabled: &disabled}); len(list) != 1 || list[0].ID != "u2" {
+		t.Errorf("Expected only u2 to be disabled, got %d users", len(list))
+	}
+	if list, _ := s.ListUsers(ctx, repository.UserFilter{Query: "EXAMPLE"}); len(list) != 1 || list[0].ID != "u1" {
+		t.Errorf("Expected email match for u1, got %d users", len(list))
+	}
+	if list, _ := s.ListUsers(ctx, repository.UserFilter{Query: "0%"}); len(list) != 1 || list[0].ID != "u3" {
+		t.Errorf("Expected literal %% match for u3, got %d users", len(list))
+	}
+	if list, _ := s.ListUsers(ctx, repository.UserFilter{After: "u1", Limit: 1}); len(list) != 1 || list[0].ID != "u2" {
+		t.Errorf("Expected page [u2], got %d users", len(list))
+	}
+
+	// Deleting cascades to the user's keys and role bindings, not to other owners
+	s.CreateAPIKey(ctx, &db.APIKey{ID: "k1", UserID: "u1", KeyHash: "h1", Prefix: "p", CreatedAt: now, IsActive: true})
+	s.CreateAPIKey(ctx, &db.APIKey{ID: "k2", UserID: "u2", KeyHash: "h2", Prefix: "p", CreatedAt: now, IsActive: true})
+	u1 := db.RoleSubject{SubjectType: "user", TenantID: "default", SubjectID: "u1"}
+	s.AssignRole(ctx, u1, "admin")
+
+	if err := s.DeleteUser(ctx, "u1"); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := s.Get(ctx, "u1"); err != repository.ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if keys, _ := s.ListByUser(ctx, "u1"); len(keys) != 0 {
+		t.Errorf("Expected u1 keys to be deleted, got %d", len(keys))
+	}
+	if roles, _ := s.ListRoles(ctx, u1); len(roles) != 0 {
+		t.Errorf("Expected u1 roles to be deleted, got %v", roles)
+	}
+	if keys, _ := s.ListByUser(ctx, "u2"); len(keys) != 1 {
+		t.Errorf("Expected u2 keys to remain, got %d", len(keys))
+	}
+	if err := s.DeleteUser(ctx, "u1"); err != repository.ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestStore_Tenants(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if err := s.CreateTenant(ctx, &db.Tenant{ID: "acme", Name: "Acme", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("CreateTenant failed: %v", err)
+	}
+	if err := s.CreateTenant(ctx, &db.Tenant{ID: "acme", Name: "Again", CreatedAt: now, UpdatedAt: now}); err != repository.ErrAlreadyExists {
+		t.Errorf("Expected ErrAlreadyExists, got %v", err)
+	}
+	if _, err := s.GetTenant(ctx, "missing"); err != repository.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	s.CreateUser(ctx, &db.User{ID: "u1", TenantID: "acme", Username: "alice", CreatedAt: now, UpdatedAt: now})
+	s.CreateUser(ctx, &db.User{ID: "u2", Username: "bob", CreatedAt: now, UpdatedAt: now})
+
+	if u, _ := s.Get(ctx, "u2"); u.TenantID != auth.DefaultTenant {
+		t.Errorf("Expected users without a tenant to join %q, got %q", auth.DefaultTenant, u.TenantID)
+	}
+	if list, _ := s.ListUsers(ctx, repository.UserFilter{TenantID: "acme"}); len(list) != 1 || list[0].ID != "u1" {
+		t.Errorf("Expected only u1 in acme, got %d users", len(list))
+	}
+
+	s.CreateAPIKey(ctx, &db.APIKey{ID: "k1", UserID: "u1", TenantID: "acme", KeyHash: "h1", Prefix: "p", CreatedAt: now, IsActive: true})
+	if k, _ := s.GetByHash(ctx, "h1"); k.TenantID != "acme" {
+		t.Errorf("Expected key in acme, got %q", k.TenantID)
+	}
+}
+
+func TestStore_Quotas(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if err := s.SavePlan(ctx, &db.QuotaPlan{ID: "free", Name: "Free", Limit: 1000, Period: "month", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("SavePlan failed: %v", err)
+	}
+	s.SavePlan(ctx, &db.QuotaPlan{ID: "free", Name: "Free", Limit: 2000, Period: "day", CreatedAt: now, UpdatedAt: now})
+	if p, _ := s.GetPlan(ctx, "free"); p.Limit != 2000 || p.Period != "day" {
+		t.Errorf("Expected the plan to be replaced, got %+v", p)
+	}
+
+	a := &db.PlanAssignment{SubjectType: "tenant", SubjectID: "acme", TenantID: "acme", PlanID: "free", UpdatedAt: now}
+	if err := s.SetPlanAssignment(ctx, a); err != nil {
+		t.Fatalf("SetPlanAssignment failed: %v", err)
+	}
+	if got, err := s.GetPlanAssignment(ctx, "tenant", "acme"); err != nil || got.PlanID != "free" {
+		t.Errorf("Expected acme on free, got %+v (%v)", got, err)
+	}
+	if err := s.DeletePlanAssignment(ctx, "tenant", "acme"); err != nil {
+		t.Fatalf("DeletePlanAssignment failed: %v", err)
+	}
+	if _, err := s.GetPlanAssignment(ctx, "tenant", "acme"); err != repository.ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+
+	s.CreateAPIKey(ctx, &db.APIKey{ID: "k1", UserID: "u1", TenantID: "acme", KeyHash: "h1", Prefix: "p", CreatedAt: now, IsActive: true})
+	if k, err := s.GetAPIKey(ctx, "k1"); err != nil || k.KeyHash != "h1" {
+		t.Errorf("Expected key k1, got %+v (%v)", k, err)
+	}
+}
@@ -0,0 +1,54 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+const tenantColumns = "id, name, created_at, updated_at"
+
+func scanTenant(row rowScanner) (*db.Tenant, error) {
+	t := &db.Tenant{}
+	if err := row.Scan(&t.ID, &t.Name, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *Store) GetTenant(ctx context.Context, id string) (*db.Tenant, error) {
+	t, err := scanTenant(s.queryRow(ctx, "SELECT "+tenantColumns+" FROM tenants WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return t, err
+}
+
+func (s *Store) ListTenants(ctx context.Context) ([]*db.Tenant, error) {
+	rows, err := s.query(ctx, "SELECT "+tenantColumns+" FROM tenants ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*db.Tenant
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *Store) CreateTenant(ctx context.Context, t *db.Tenant) error {
+	_, err := s.exec(ctx, "INSERT INTO tenants ("+tenantColumns+") VALUES (?, ?, ?, ?)",
+		t.ID, t.Name, t.CreatedAt, t.UpdatedAt)
+	if isUniqueViolation(err) {
+		return repository.ErrAlreadyExists
+	}
+	return err
+}
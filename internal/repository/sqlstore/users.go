@@ -0,0 +1,134 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+const userColumns = "id, tenant_id, username, email, password_hash, disabled, created_at, updated_at"
+
+func scanUser(row rowScanner) (*db.User, error) {
+	u := &db.User{}
+	if err := row.Scan(&u.ID, &u.TenantID, &u.Username, &u.Email, &u.PasswordHash, &u.Disabled, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (*db.User, error) {
+	u, err := scanUser(s.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	return u, err
+}
+
+func (s *Store) CreateUser(ctx context.Context, user *db.User) error {
+	_, err := s.exec(ctx, "INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		user.ID, auth.TenantOrDefault(user.TenantID), user.Username, user.Email, user.PasswordHash, user.Disabled, user.CreatedAt, user.UpdatedAt)
+	if isUniqueViolation(err) {
+		return repository.ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *Store) UpdateUser(ctx context.Context, user *db.User) error {
+	res, err := s.exec(ctx, "UPDATE users SET username = ?, email = ?, password_hash = ?, disabled = ?, updated_at = ? WHERE id = ?",
+		user.Username, user.Email, user.PasswordHash, user.Disabled, user.UpdatedAt, user.ID)
+	if isUniqueViolation(err) {
+		return repository.ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteUser removes the user with its keys and role bindings in one transaction
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tenantID string
+	if err := tx.QueryRowContext(ctx, s.rebind("SELECT tenant_id FROM users WHERE id = ?"), id).Scan(&tenantID); err != nil {
+		if err == sql.ErrNoRows {
+			return repository.ErrNotFound
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM users WHERE id = ?"), id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM api_keys WHERE user_id = ? AND owner_type = ?"), id, auth.PrincipalUser); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind("DELETE FROM role_bindings WHERE subject_type = ? AND tenant_id = ? AND subject_id = ?"),
+		auth.PrincipalUser, tenantID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) ListUsers(ctx context.Context, filter repository.UserFilter) ([]*db.User, error) {
+	var where []string
+	var args []interface{}
+	if filter.TenantID != "" {
+		where = append(where, "tenant_id = ?")
+		args = append(args, filter.TenantID)
+	}
+	if filter.After != "" {
+		where = append(where, "id > ?")
+		args = append(args, filter.After)
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Query)) + "%"
+		where = append(where, `(LOWER(username) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	if filter.Disabled != nil {
+		where = append(where, "disabled = ?")
+		args = append(args, *filter.Disabled)
+	}
+
+	query := "SELECT " + userColumns + " FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*db.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
+
+// escapeLike makes LIKE wildcards in user input match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
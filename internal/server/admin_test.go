@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+)
+
+func TestKeyHandlers_RefuseTargetsWithMorePermissions(t *testing.T) {
+	s := newTestServer(t)
+	addUser(t, s, "acme", "km", rbac.RoleKeyManager)
+	addUser(t, s, "acme", "boss", rbac.RoleAdmin)
+	addUser(t, s, "acme", "reader", rbac.RoleViewer)
+	addUser(t, s, "acme", "plain")
+
+	for _, h := range []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"create", s.GenerateAPIKeyHandler},
+		{"rotate", s.RevokeAPIKeyHandler},
+	} {
+		// viewer's only permission is one a key manager has too
+		for target, want := range map[string]int{"boss": http.StatusForbidden, "reader": http.StatusOK, "plain": http.StatusOK} {
+			w := call(h.handler, "acme", "km", "POST", "/", `{"user_id": "`+target+`"}`)
+			if w.Code != want {
+				t.Errorf("%s key for %s: expected %d, got %d: %s", h.name, target, want, w.Code, w.Body)
+			}
+		}
+	}
+
+	// An admin may key anyone in its tenant
+	if w := call(s.GenerateAPIKeyHandler, "acme", "boss", "POST", "/", `{"user_id": "km"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected an admin to key a key manager, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSavePolicyHandler_TenantLimitsStayInTenant(t *testing.T) {
+	s := newTestServer(t)
+	addUser(t, s, "acme", "boss", rbac.RoleAdmin)
+
+	tests := map[string]int{
+		`{"id": "acme-route", "matcher": {"path": "/api"}, "rules": {"rate_limit": 10, "burst": 10, "limits": [{"scope": "route", "rate_limit": 5, "burst": 5}]}}`:   http.StatusOK,
+		`{"id": "acme-global", "matcher": {"path": "/api"}, "rules": {"rate_limit": 10, "burst": 10, "limits": [{"scope": "global", "rate_limit": 1, "burst": 1}]}}`: http.StatusBadRequest,
+	}
+	for body, want := range tests {
+		if w := call(s.SavePolicyHandler, "acme", "boss", "POST", "/", body); w.Code != want {
+			t.Errorf("Expected %d saving %s, got %d: %s", want, body, w.Code, w.Body)
+		}
+	}
+	if _, err := s.repo.GetPolicy(context.Background(), "acme-global"); err == nil {
+		t.Error("Expected the global limit policy not to be stored")
+	}
+}
+
+func TestAuthorize_EnforcesScopes(t *testing.T) {
+	s := newTestServer(t)
+	addUser(t, s, "acme", "boss", rbac.RoleAdmin)
+	svc := db.RoleSubject{SubjectType: auth.PrincipalService, TenantID: "acme", SubjectID: "svc-ci"}
+	if err := s.authorizer.Assign(context.Background(), svc, string(rbac.RoleAdmin)); err != nil {
+		t.Fatalf("Assign failed: %v", err)
+	}
+	read := []string{string(rbac.PermServiceAccountRead)}
+
+	tests := []struct {
+		name   string
+		p      *auth.Principal
+		method string
+		want   int
+	}{
+		{"service in scope", &auth.Principal{ID: "svc-ci", Type: auth.PrincipalService, TenantID: "acme", Scopes: read}, "GET", http.StatusOK},
+		{"service out of scope", &auth.Principal{ID: "svc-ci", Type: auth.PrincipalService, TenantID: "acme", Scopes: read}, "POST", http.StatusForbidden},
+		{"service without scopes", &auth.Principal{ID: "svc-ci", Type: auth.PrincipalService, TenantID: "acme"}, "GET", http.StatusForbidden},
+		{"delegated in scope", &auth.Principal{ID: "boss", Type: auth.PrincipalUser, TenantID: "acme", ActorID: "svc-ci", Scopes: read}, "GET", http.StatusOK},
+		{"delegated without scopes", &auth.Principal{ID: "boss", Type: auth.PrincipalUser, TenantID: "acme", ActorID: "svc-ci"}, "GET", http.StatusForbidden},
+		// A user's own credentials carry no scopes; roles alone decide
+		{"user", &auth.Principal{ID: "boss", Type: auth.PrincipalUser, TenantID: "acme"}, "POST", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := callAs(s.ServiceAccountsHandler, tt.p, tt.method, "/", "{}"); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/service"
+)
+
+// bootstrapAdmin grants the user or service account id the admin role. If
+// neither exists yet, it creates a default-tenant user with an API key, so a
+// fresh install can reach the admin API at all. The key is written to a file
+// in keyDir only its owner can read, never to the log.
+func bootstrapAdmin(ctx context.Context, authz *rbac.Authorizer, repo repository.Store, users *service.UserService, authSvc *service.AuthService, keyDir, id string) error {
+	subject, err := resolveSubject(ctx, repo, "", id)
+	if errors.Is(err, repository.ErrNotFound) {
+		if err := createBootstrapUser(ctx, repo, users, authSvc, keyDir, id); err != nil {
+			return err
+		}
+		subject, err = resolveSubject(ctx, repo, auth.PrincipalUser, id)
+	}
+	if err != nil {
+		return err
+	}
+	return authz.Assign(ctx, subject, string(rbac.RoleAdmin))
+}
+
+func createBootstrapUser(ctx context.Context, repo repository.Store, users *service.UserService, authSvc *service.AuthService, keyDir, id string) error {
+	name := "bootstrap-admin-" + id + ".key"
+	if filepath.Base(name) != name {
+		return fmt.Errorf("bootstrap admin ID %q can't name a key file", id)
+	}
+	path := filepath.Join(keyDir, name)
+	// Claim the file first: a key that can't be saved must not be created
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := users.Create(ctx, &db.User{ID: id, Username: id}); err != nil {
+		os.Remove(path)
+		return err
+	}
+	rawKey, err := authSvc.CreateAPIKey(ctx, auth.DefaultTenant, id, "bootstrap", nil)
+	if err != nil {
+		repo.DeleteUser(ctx, id) // So the next start tries again
+		os.Remove(path)
+		return err
+	}
+	if _, err := f.WriteString(rawKey + "\n"); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	keyID := ""
+	if keys, err := repo.ListByUser(ctx, id); err == nil && len(keys) > 0 {
+		keyID = keys[0].ID
+	}
+	log.Printf("rbac: created bootstrap admin %s with API key %s, written to %s", id, keyID, path)
+	return nil
+}
+
+// testKeyHandler hands out an API key for an existing user, ?user_id=,
+// without authentication. It is only mounted with DEV_TEST_KEYS, and never
+// issues keys for users holding a role, whose keys would grant more than a
+// plain user's.
+func (s *Server) testKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = "test-user"
+	}
+	u, err := s.users.Get(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	roles, err := s.authorizer.Roles(r.Context(), userSubject(u))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(roles) > 0 {
+		http.Error(w, "Test keys are not issued for users with roles", http.StatusForbidden)
+		return
+	}
+
+	rawKey, err := s.authService.CreateAPIKey(r.Context(), u.TenantID, u.ID, "test-key", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(rawKey))
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+)
+
+func TestBootstrapAdmin_WritesKeyFile(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	dir := t.TempDir()
+
+	if err := bootstrapAdmin(ctx, s.authorizer, s.repo, s.users, s.authService, dir, "root"); err != nil {
+		t.Fatalf("bootstrapAdmin failed: %v", err)
+	}
+	path := filepath.Join(dir, "bootstrap-admin-root.key")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected a key file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(path)
+	p, err := s.authService.AuthenticateAPIKey(ctx, strings.TrimSpace(string(data)))
+	if err != nil || p.ID != "root" {
+		t.Fatalf("Expected the written key to authenticate root, got %v (err %v)", p, err)
+	}
+	if _, ok, _ := s.authorizer.Authorize(ctx, db.RoleSubject{SubjectID: "root"}, rbac.PermRoleManage); !ok {
+		t.Error("Expected root to be an admin")
+	}
+
+	// Later starts keep the existing user and key
+	if err := bootstrapAdmin(ctx, s.authorizer, s.repo, s.users, s.authService, dir, "root"); err != nil {
+		t.Fatalf("Second bootstrapAdmin failed: %v", err)
+	}
+	if again, _ := os.ReadFile(path); string(again) != string(data) {
+		t.Error("Expected the key file to be left alone")
+	}
+	if keys, _ := s.repo.ListByUser(ctx, "root"); len(keys) != 1 {
+		t.Errorf("Expected one key, got %d", len(keys))
+	}
+
+	// An existing subject is only granted the role
+	addUser(t, s, "default", "ops")
+	if err := bootstrapAdmin(ctx, s.authorizer, s.repo, s.users, s.authService, dir, "ops"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bootstrap-admin-ops.key")); !os.IsNotExist(err) {
+		t.Errorf("Expected no key file for an existing user, got %v", err)
+	}
+
+	if err := bootstrapAdmin(ctx, s.authorizer, s.repo, s.users, s.authService, dir, "../escape"); err == nil {
+		t.Error("Expected an ID with a path separator to be refused")
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/circuitbreaker"
+	"github.com/raakeshmj/apigatewayplane/internal/metrics"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/webhook"
+)
+
+// Breakers guard upstreams shared by every tenant, so only the operator
+// tenant sees and operates them.
+
+// webhookTimeout bounds each webhook delivery
+const webhookTimeout = 5 * time.Second
+
+// breakerEvents reports every breaker transition as an audit entry and, with
+// a hook, a webhook
+func breakerEvents(logger audit.Logger, hook *webhook.Sender) func(circuitbreaker.Transition) {
+	return func(tr circuitbreaker.Transition) {
+		logger.Log(audit.LogEntry{
+			Timestamp: tr.At,
+			TenantID:  auth.DefaultTenant,
+			ActorID:   "system",
+			Action:    "circuit_breaker_transition",
+			Resource:  "circuit_breaker:" + tr.Breaker,
+			Status:    http.StatusOK,
+			Metadata:  map[string]interface{}{"from": tr.From.String(), "to": tr.To.String(), "reason": tr.Reason, "local": tr.Local},
+		})
+		if hook != nil {
+			hook.Send(tr)
+		}
+	}
+}
+
+// breakerGauge keeps the circuit_breaker_state:<name> gauge at the state this
+// instance sees, whether it moved the breaker itself or followed Redis
+func breakerGauge(met *metrics.MetricsCollector) func(string, circuitbreaker.State) {
+	return func(name string, state circuitbreaker.State) {
+		met.SetGauge("circuit_breaker_state:"+name, float64(state))
+	}
+}
+
+// CircuitBreakersHandler lists every breaker with its state and counters
+func (s *Server) CircuitBreakersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermBreakerRead) || !requireOperator(w, r) {
+		return
+	}
+
+	list, err := s.circuitBreaker.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ForceOpenBreakerHandler rejects every request through a breaker until it is reset
+func (s *Server) ForceOpenBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	s.operateBreaker(w, r, "circuit_breaker_force_open", s.circuitBreaker.ForceOpen)
+}
+
+// ForceCloseBreakerHandler lets every request through a breaker until it is reset
+func (s *Server) ForceCloseBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	s.operateBreaker(w, r, "circuit_breaker_force_close", s.circuitBreaker.ForceClose)
+}
+
+// ResetBreakerHandler closes a breaker and clears its counters
+func (s *Server) ResetBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	s.operateBreaker(w, r, "circuit_breaker_reset", s.circuitBreaker.Reset)
+}
+
+// operateBreaker applies an operator action to the breaker named in the body: {"name": "..."}
+func (s *Server) operateBreaker(w http.ResponseWriter, r *http.Request, action string, apply func(ctx context.Context, name string) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermBreakerManage) || !requireOperator(w, r) {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := apply(r.Context(), req.Name); err != nil {
+		switch {
+		case errors.Is(err, circuitbreaker.ErrNameRequired):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, circuitbreaker.ErrUnknownBreaker):
+			http.Error(w, "Circuit breaker not found", http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+		return
+	}
+
+	s.audit(r, audit.LogEntry{
+		Action:   action,
+		Resource: "circuit_breaker:" + req.Name,
+		Status:   http.StatusOK,
+	})
+
+	st, err := s.circuitBreaker.Status(r.Context(), req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/circuitbreaker"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestOperateBreaker_UnknownNames(t *testing.T) {
+	s := newTestServer(t)
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	s.circuitBreaker = circuitbreaker.New(rdb, nil, circuitbreaker.Config{})
+	s.circuitBreaker.Execute(context.Background(), "billing", func() error { return nil })
+	addUser(t, s, auth.DefaultTenant, "op", rbac.RoleAdmin)
+
+	tests := map[string]int{
+		`{"name": "billing"}`: http.StatusOK,
+		`{"name": "biling"}`:  http.StatusNotFound,
+		`{"name": ""}`:        http.StatusBadRequest,
+	}
+	for _, h := range []http.HandlerFunc{s.ForceOpenBreakerHandler, s.ForceCloseBreakerHandler, s.ResetBreakerHandler} {
+		for body, want := range tests {
+			if w := call(h, auth.DefaultTenant, "op", "POST", "/", body); w.Code != want {
+				t.Errorf("Expected %d for %s, got %d: %s", want, body, w.Code, w.Body)
+			}
+		}
+	}
+	if list, _ := s.circuitBreaker.List(context.Background()); len(list) != 1 {
+		t.Errorf("Expected only billing to exist, got %+v", list)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+// Stored policies use this db.Policy type; the definition is a JSON policy.Policy
+const routePolicyType = "route"
+
+// defaultPolicies are seeded into a new repository on its first start
+func defaultPolicies() []policy.Policy {
+	return []policy.Policy{
+		{
+			ID:       "admin-policy",
+			Priority: 10,
+			Matcher:  policy.Matcher{Path: "/api/admin"},
+			Rules:    policy.Rules{AuthRequired: true, RateLimit: 10, Burst: 20},
+		},
+		{
+			ID:       "token-policy",
+			Priority: 20,
+			Matcher:  policy.Matcher{Path: "/api/auth"},
+			Rules:    policy.Rules{AuthRequired: true, RateLimit: 10, Burst: 20},
+		},
+		{
+			ID:       "public-policy",
+			Priority: 30,
+			Matcher:  policy.Matcher{Path: "/api/public"},
+			Rules:    policy.Rules{AuthRequired: false, RateLimit: 5, Burst: 10},
+		},
+		{
+			ID:       "health-policy",
+			Priority: 40,
+			Matcher:  policy.Matcher{Path: "/health"},
+			Rules:    policy.Rules{AuthRequired: false, RateLimit: 100, Burst: 100},
+		},
+		{
+			ID:       "ready-policy",
+			Priority: 50,
+			Matcher:  policy.Matcher{Path: "/ready"},
+			Rules:    policy.Rules{AuthRequired: false, RateLimit: 100, Burst: 100},
+		},
+		{
+			ID:       "test-policy",
+			Priority: 60,
+			Matcher:  policy.Matcher{Path: "/api/test"},
+			Rules:    policy.Rules{AuthRequired: false, RateLimit: 10, Burst: 20},
+		},
+		{
+			ID:       "unstable-policy",
+			Priority: 70,
+			Matcher:  policy.Matcher{Path: "/api/unstable"},
+			Rules: policy.Rules{
+				AuthRequired:   false,
+				RateLimit:      10,
+				Burst:          20,
+				CircuitBreaker: &policy.CircuitBreakerRule{Name: "unstable", FailureThreshold: 3, SuccessThreshold: 5, TimeoutMs: 10000},
+			},
+		},
+		// Default implies fallback logic in middleware if no match
+	}
+}
+
+// seedPolicies stores the defaults into a new repository. It only runs on a
+// store's first start, so deleting policies later never brings them back.
+func seedPolicies(ctx context.Context, repo repository.PolicyRepository) error {
+	stored, err := repo.ListPolicies(ctx)
+	if err != nil || len(stored) > 0 {
+		return err
+	}
+	for _, p := range defaultPolicies() {
+		if err := savePolicy(ctx, repo, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPolicies reads stored policies into the engine. A policy that no
+// longer validates, such as one with a key template that doesn't parse, fails
+// the whole load and leaves the engine as it was, rather than being enforced
+// differently from what was saved.
+func loadPolicies(ctx context.Context, repo repository.PolicyRepository, eng *policy.Engine) error {
+	stored, err := repo.ListPolicies(ctx)
+	if err != nil {
+		return err
+	}
+
+	policies := make([]policy.Policy, 0, len(stored))
+	for _, sp := range stored {
+		var p policy.Policy
+		if err := json.Unmarshal(sp.Definition, &p); err != nil {
+			return fmt.Errorf("policy %s: %w", sp.ID, err)
+		}
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("policy %s: %w", sp.ID, err)
+		}
+		policies = append(policies, p)
+	}
+
+	// First match wins, so order by priority (then ID for a stable result)
+	sort.SliceStable(policies, func(i, j int) bool {
+		if policies[i].Priority != policies[j].Priority {
+			return policies[i].Priority < policies[j].Priority
+		}
+		return policies[i].ID < policies[j].ID
+	})
+
+	eng.LoadPolicies(policies)
+	return nil
+}
+
+func savePolicy(ctx context.Context, repo repository.PolicyRepository, p policy.Policy) error {
+	def, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return repo.SavePolicy(ctx, &db.Policy{
+		ID:         p.ID,
+		TenantID:   p.TenantID,
+		Name:       p.ID,
+		Type:       routePolicyType,
+		Definition: def,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+	"github.com/raakeshmj/apigatewayplane/internal/repository/memory"
+)
+
+func TestLoadPolicies_RejectsInvalidStoredPolicies(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	eng := policy.NewEngine()
+	if err := savePolicy(ctx, repo, policy.Policy{ID: "orders", Matcher: policy.Matcher{Path: "/api"}, Rules: policy.Rules{RateLimit: 1, Burst: 1}}); err != nil {
+		t.Fatalf("savePolicy failed: %v", err)
+	}
+	if err := loadPolicies(ctx, repo, eng); err != nil {
+		t.Fatalf("loadPolicies failed: %v", err)
+	}
+
+	// Saved before templates were validated, or edited in the store by hand
+	bad := []byte(`{"id": "broken", "matcher": {"path": "/"}, "rules": {"rate_limit": 1, "burst": 1, "rate_limit_key": "{nope}"}}`)
+	if err := repo.SavePolicy(ctx, &db.Policy{ID: "broken", Name: "broken", Type: routePolicyType, Definition: bad}); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	if err := loadPolicies(ctx, repo, eng); !errors.Is(err, policy.ErrInvalidRules) {
+		t.Fatalf("Expected ErrInvalidRules, got %v", err)
+	}
+	if got := eng.Policies(); len(got) != 1 || got[0].ID != "orders" {
+		t.Errorf("Expected the engine to keep the last good set, got %+v", got)
+	}
+}
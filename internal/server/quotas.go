@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/quota"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/service"
+)
+
+// Plans are shared by all tenants and only the operator tenant changes them
+// or moves subjects between them. Tenants may read their own subjects' usage.
+
+// QuotaPlansHandler lists (GET) or creates and replaces (POST) plans
+func (s *Server) QuotaPlansHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !s.authorize(w, r, rbac.PermQuotaRead) {
+			return
+		}
+		plans, err := s.quotas.ListPlans(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if plans == nil {
+			plans = []*db.QuotaPlan{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plans)
+
+	case http.MethodPost:
+		if !s.authorize(w, r, rbac.PermQuotaManage) || !requireOperator(w, r) {
+			return
+		}
+		var p db.QuotaPlan
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := s.quotas.SavePlan(r.Context(), &p); err != nil {
+			writeQuotaError(w, err)
+			return
+		}
+
+		s.audit(r, audit.LogEntry{
+			Action:   "quota_plan_save",
+			Resource: "quota_plan:" + p.ID,
+			Status:   http.StatusOK,
+			Metadata: map[string]interface{}{"limit": p.Limit, "period": p.Period},
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AssignQuotaPlanHandler moves a subject onto a plan, or off its plan when plan_id is empty
+func (s *Server) AssignQuotaPlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermQuotaManage) || !requireOperator(w, r) {
+		return
+	}
+
+	var req struct {
+		quota.Subject
+		PlanID string `json:"plan_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := s.quotaSubjectTenant(w, r, req.Subject)
+	if !ok {
+		return
+	}
+
+	var previous string
+	if a, err := s.quotas.Assignment(r.Context(), req.Subject); err == nil {
+		previous = a.PlanID
+	}
+
+	if req.PlanID == "" {
+		if err := s.quotas.Unassign(r.Context(), req.Subject); err != nil {
+			writeQuotaError(w, err)
+			return
+		}
+	} else if _, err := s.quotas.Assign(r.Context(), req.Subject, tenantID, req.PlanID); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	s.audit(r, audit.LogEntry{
+		Action:   "quota_assign",
+		Resource: "quota:" + req.Type + ":" + req.ID,
+		Status:   http.StatusOK,
+		Metadata: map[string]interface{}{"plan_id": req.PlanID, "previous_plan_id": previous, "tenant_id": tenantID},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"subject_type": req.Type,
+		"subject_id":   req.ID,
+		"plan_id":      req.PlanID,
+	})
+}
+
+// QuotaUsageHandler reports a subject's usage in the current period.
+// Query parameters: subject_type, subject_id.
+func (s *Server) QuotaUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermQuotaRead) {
+		return
+	}
+
+	subject := quota.Subject{Type: r.URL.Query().Get("subject_type"), ID: r.URL.Query().Get("subject_id")}
+	if _, ok := s.quotaSubjectTenant(w, r, subject); !ok {
+		return
+	}
+
+	u, err := s.quotas.Usage(r.Context(), subject)
+	if err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subject_type": subject.Type,
+		"subject_id":   subject.ID,
+		"plan_id":      u.PlanID,
+		"period":       u.Period,
+		"used":         u.Used,
+		"limit":        u.Limit,
+		"remaining":    u.Remaining(),
+		"reset_at":     u.ResetAt,
+	})
+}
+
+// ResetQuotaHandler clears a subject's usage in the current period
+func (s *Server) ResetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermQuotaManage) || !requireOperator(w, r) {
+		return
+	}
+
+	var subject quota.Subject
+	if err := json.NewDecoder(r.Body).Decode(&subject); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.quotaSubjectTenant(w, r, subject); !ok {
+		return
+	}
+	if err := s.quotas.Reset(r.Context(), subject); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	s.audit(r, audit.LogEntry{
+		Action:   "quota_reset",
+		Resource: "quota:" + subject.Type + ":" + subject.ID,
+		Status:   http.StatusOK,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Usage reset"))
+}
+
+// quotaSubjectTenant resolves the tenant of a quota subject the caller may
+// administer. Subjects of other tenants are reported as not found.
+func (s *Server) quotaSubjectTenant(w http.ResponseWriter, r *http.Request, subject quota.Subject) (string, bool) {
+	tenantID, err := s.lookupSubjectTenant(r.Context(), subject)
+	if err == nil && !sameTenant(r, tenantID) {
+		err = repository.ErrNotFound
+	}
+	switch {
+	case err == nil:
+		return tenantID, true
+	case errors.Is(err, service.ErrInvalidSubject):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "Subject not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return "", false
+}
+
+func (s *Server) lookupSubjectTenant(ctx context.Context, subject quota.Subject) (string, error) {
+	if subject.ID == "" {
+		return "", service.ErrInvalidSubject
+	}
+	switch subject.Type {
+	case quota.SubjectUser:
+		user, err := s.resolveSubject(ctx, auth.PrincipalUser, subject.ID)
+		return user.TenantID, err
+	case quota.SubjectKey:
+		k, err := s.repo.GetAPIKey(ctx, subject.ID)
+		if err != nil {
+			return "", err
+		}
+		return auth.TenantOrDefault(k.TenantID), nil
+	case quota.SubjectTenant:
+		if _, err := s.tenants.Get(ctx, subject.ID); err != nil {
+			if errors.Is(err, service.ErrUnknownTenant) {
+				return "", repository.ErrNotFound
+			}
+			return "", err
+		}
+		return subject.ID, nil
+	default:
+		return "", service.ErrInvalidSubject
+	}
+}
+
+func writeQuotaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPlan), errors.Is(err, service.ErrInvalidSubject), errors.Is(err, service.ErrUnknownPlan):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrNoPlan):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
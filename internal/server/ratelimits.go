@@ -0,0 +1,371 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/raakeshmj/apigatewayplane/internal/middleware"
+	"github.com/raakeshmj/apigatewayplane/internal/overrides"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+	"github.com/raakeshmj/apigatewayplane/internal/quota"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/service"
+	"github.com/raakeshmj/apigatewayplane/internal/throttle"
+)
+
+// Buckets are addressed by the Redis key the rate limiter uses, such as
+// "ratelimit:tenant:acme:user:u1". Tenants only see keys under their own
+// prefix; route and global buckets are the operator's.
+
+// RateLimitBucketHandler reports a bucket's tokens without spending any.
+// Query parameters: key, policy_id, scope (default "user") to pick the
+// policy's limit for the bucket; subject_type and subject_id to include the
+// subject's quota usage.
+func (s *Server) RateLimitBucketHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermRateLimitRead) {
+		return
+	}
+
+	q := r.URL.Query()
+	key := q.Get("key")
+	if !bucketVisible(r, key) {
+		http.Error(w, "Bucket not found", http.StatusNotFound)
+		return
+	}
+	p, ok := s.visiblePolicy(w, r, q.Get("policy_id"))
+	if !ok {
+		return
+	}
+	scope := q.Get("scope")
+	if scope == "" {
+		scope = "user"
+	}
+	limit, ok := scopeLimit(p, scope)
+	if !ok {
+		http.Error(w, "Policy has no "+scope+" limit", http.StatusBadRequest)
+		return
+	}
+	limit = s.adaptive.Adjust(p, limit)
+
+	d, err := s.redisLimiter.Peek(r.Context(), []limiter.Level{{Name: scope, Key: key, Limit: limit}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	res := d.Levels[0]
+
+	out := map[string]interface{}{
+		"key":        key,
+		"policy_id":  p.ID,
+		"scope":      scope,
+		"algorithm":  limit.Algorithm,
+		"rate_limit": limit.Rate,
+		"burst":      limit.Burst,
+		"tokens":     res.Remaining,
+	}
+	if res.RetryAfter != limiter.Never {
+		out["retry_after_ms"] = res.RetryAfter.Milliseconds()
+	}
+	if res.ResetAfter != limiter.Never {
+		out["reset_after_ms"] = res.ResetAfter.Milliseconds()
+	}
+
+	if subject := (quota.Subject{Type: q.Get("subject_type"), ID: q.Get("subject_id")}); subject.ID != "" {
+		if _, ok := s.quotaSubjectTenant(w, r, subject); !ok {
+			return
+		}
+		u, err := s.quotas.Usage(r.Context(), subject)
+		switch {
+		case err == nil:
+			out["quota"] = map[string]interface{}{
+				"plan_id":   u.PlanID,
+				"period":    u.Period,
+				"used":      u.Used,
+				"limit":     u.Limit,
+				"remaining": u.Remaining(),
+				"reset_at":  u.ResetAt,
+			}
+		case !errors.Is(err, service.ErrNoPlan):
+			writeQuotaError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// RateLimitResetHandler refills a bucket. Body: {"key": "..."}
+func (s *Server) RateLimitResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermRateLimitManage) {
+		return
+	}
+
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !bucketVisible(r, req.Key) {
+		http.Error(w, "Bucket not found", http.StatusNotFound)
+		return
+	}
+	if err := s.redisLimiter.Reset(r.Context(), req.Key); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	s.audit(r, audit.LogEntry{
+		Action:   "ratelimit_reset",
+		Resource: req.Key,
+		Status:   http.StatusOK,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Bucket reset"))
+}
+
+// ThrottledClientsHandler lists the buckets that throttled the most requests.
+// Query parameters: window (default 5m, at most 1h), n (default 10).
+func (s *Server) ThrottledClientsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermRateLimitRead) {
+		return
+	}
+
+	window := 5 * time.Minute
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = min(d, throttle.Retention)
+	}
+	n := 10
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 {
+			http.Error(w, "Invalid n", http.StatusBadRequest)
+			return
+		}
+	}
+
+	prefix := ""
+	if own, operator := callerTenant(r); !operator {
+		prefix = "ratelimit:tenant:" + own + ":"
+	}
+	top, err := s.throttled.Top(r.Context(), window, n, prefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":  window.String(),
+		"clients": top,
+	})
+}
+
+// RateLimitOverridesHandler lists (GET), sets (POST) or removes (DELETE)
+// temporary per-principal limits. POST takes an override with expires_at, or
+// ttl_seconds instead; DELETE takes principal_id and policy_id query parameters.
+func (s *Server) RateLimitOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !s.authorize(w, r, rbac.PermRateLimitRead) {
+			return
+		}
+		all, err := s.overrides.List(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		list := []overrides.Override{}
+		for _, o := range all {
+			if sameTenant(r, o.TenantID) {
+				list = append(list, o)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case http.MethodPost:
+		if !s.authorize(w, r, rbac.PermRateLimitManage) {
+			return
+		}
+		var req struct {
+			overrides.Override
+			TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		o := req.Override
+		if req.TTLSeconds > 0 {
+			o.ExpiresAt = time.Now().Add(time.Duration(req.TTLSeconds) * time.Second)
+		}
+		tenantID, ok := s.principalTenant(w, r, o.PrincipalID)
+		if !ok {
+			return
+		}
+		if o.PolicyID != "" {
+			if _, ok := s.visiblePolicy(w, r, o.PolicyID); !ok {
+				return
+			}
+		}
+		o.TenantID = tenantID
+		o.CreatedBy, _ = middleware.Actor(middleware.GetPrincipal(r.Context()))
+
+		if err := s.overrides.Set(r.Context(), o); err != nil {
+			writeOverrideError(w, err)
+			return
+		}
+
+		s.audit(r, audit.LogEntry{
+			Action:   "ratelimit_override_set",
+			Resource: "ratelimit_override:" + o.PrincipalID,
+			Status:   http.StatusOK,
+			Metadata: map[string]interface{}{"policy_id": o.PolicyID, "rate_limit": o.RateLimit, "burst": o.Burst, "expires_at": o.ExpiresAt},
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(o)
+
+	case http.MethodDelete:
+		if !s.authorize(w, r, rbac.PermRateLimitManage) {
+			return
+		}
+		principalID, policyID := r.URL.Query().Get("principal_id"), r.URL.Query().Get("policy_id")
+		o, err := s.overrides.Get(r.Context(), principalID, policyID)
+		if err == nil && !sameTenant(r, o.TenantID) {
+			err = overrides.ErrNotFound
+		}
+		if err == nil {
+			err = s.overrides.Delete(r.Context(), principalID, policyID)
+		}
+		if err != nil {
+			writeOverrideError(w, err)
+			return
+		}
+
+		s.audit(r, audit.LogEntry{
+			Action:   "ratelimit_override_delete",
+			Resource: "ratelimit_override:" + principalID,
+			Status:   http.StatusOK,
+			Metadata: map[string]interface{}{"policy_id": policyID},
+		})
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Override removed"))
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// bucketVisible reports whether the caller may see a bucket key
+func bucketVisible(r *http.Request, key string) bool {
+	if !strings.HasPrefix(key, "ratelimit:") {
+		return false
+	}
+	own, operator := callerTenant(r)
+	prefix := "ratelimit:tenant:" + own
+	return operator || key == prefix || strings.HasPrefix(key, prefix+":")
+}
+
+// visiblePolicy finds a loaded policy the caller may see: a global one or
+// one of their tenant's
+func (s *Server) visiblePolicy(w http.ResponseWriter, r *http.Request, id string) (*policy.Policy, bool) {
+	for _, p := range s.policyEngine.Policies() {
+		if p.ID == id && (p.TenantID == "" || sameTenant(r, p.TenantID)) {
+			return &p, true
+		}
+	}
+	http.Error(w, "Policy not found", http.StatusNotFound)
+	return nil, false
+}
+
+// scopeLimit returns the policy's limit for a level, as the rate limiter builds it
+func scopeLimit(p *policy.Policy, scope string) (limiter.Limit, bool) {
+	if scope == "user" {
+		return p.Rules.Limit(), true
+	}
+	for _, sl := range p.Rules.Limits {
+		if sl.Scope == scope {
+			return p.Rules.ScopedLimit(sl), true
+		}
+	}
+	return limiter.Limit{}, false
+}
+
+// principalTenant resolves the tenant of a user, service account or API key
+// ID the caller may administer. Others are reported as not found.
+func (s *Server) principalTenant(w http.ResponseWriter, r *http.Request, id string) (string, bool) {
+	if id == "" {
+		http.Error(w, "principal_id is required", http.StatusBadRequest)
+		return "", false
+	}
+	tenantID, err := s.lookupPrincipalTenant(r.Context(), id)
+	if err == nil && !sameTenant(r, tenantID) {
+		err = repository.ErrNotFound
+	}
+	switch {
+	case err == nil:
+		return tenantID, true
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "Principal not found", http.StatusNotFound)
+	case errors.Is(err, errAmbiguousSubject):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return "", false
+}
+
+func (s *Server) lookupPrincipalTenant(ctx context.Context, id string) (string, error) {
+	tenantID, err := s.subjectTenant(ctx, id)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return tenantID, err
+	}
+	k, err := s.repo.GetAPIKey(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return auth.TenantOrDefault(k.TenantID), nil
+}
+
+func writeOverrideError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, overrides.ErrInvalidOverride):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, overrides.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
@@ -11,17 +11,27 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/raakeshmj/apigatewayplane/internal/adaptive"
 	"github.com/raakeshmj/apigatewayplane/internal/audit"
 	"github.com/raakeshmj/apigatewayplane/internal/auth"
 	"github.com/raakeshmj/apigatewayplane/internal/cache"
 	"github.com/raakeshmj/apigatewayplane/internal/circuitbreaker"
+	"github.com/raakeshmj/apigatewayplane/internal/concurrency"
 	"github.com/raakeshmj/apigatewayplane/internal/config"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
 	"github.com/raakeshmj/apigatewayplane/internal/limiter"
+	"github.com/raakeshmj/apigatewayplane/internal/lockout"
 	"github.com/raakeshmj/apigatewayplane/internal/metrics"
 	"github.com/raakeshmj/apigatewayplane/internal/middleware"
+	"github.com/raakeshmj/apigatewayplane/internal/overrides"
 	"github.com/raakeshmj/apigatewayplane/internal/policy"
-	"github.com/raakeshmj/apigatewayplane/internal/repository/memory"
+	"github.com/raakeshmj/apigatewayplane/internal/quota"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
 	"github.com/raakeshmj/apigatewayplane/internal/service"
+	"github.com/raakeshmj/apigatewayplane/internal/throttle"
+	"github.com/raakeshmj/apigatewayplane/internal/tlsconfig"
+	"github.com/raakeshmj/apigatewayplane/internal/webhook"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -29,88 +39,152 @@ type Server struct {
 	cfg            *config.Config
 	router         *http.ServeMux
 	authService    *service.AuthService
-	rateLimiter    *limiter.TokenBucketLimiter
+	authorizer     *rbac.Authorizer
+	svcAccounts    *service.ServiceAccountService
+	users          *service.UserService
+	tenants        *service.TenantService
+	quotas         *service.QuotaService
+	rateLimiter    *limiter.Failover
+	redisLimiter   *limiter.RedisLimiter
+	localLimiter   *limiter.LocalLimiter
+	concurrency    *concurrency.Limiter
+	adaptive       *adaptive.Controller
+	overrides      *overrides.Store
+	throttled      *throttle.Tracker
+	replicas       *limiter.Replicas
 	circuitBreaker *circuitbreaker.CircuitBreaker
 	metrics        *metrics.MetricsCollector
 	auditLogger    audit.Logger
+	lockoutGuard   *lockout.Guard
 	configManager  *config.DynamicConfigManager
 	policyEngine   *policy.Engine // Policy Engine
 	redisClient    *redis.Client
+	repo           repository.Store
 	// Cache not exposed in struct? Or useful for stats?
 	l1Cache *cache.MemoryCache
 }
 
-func New(cfg *config.Config) *Server {
+func New(cfg *config.Config) (*Server, error) {
+	ctx := context.Background()
+
 	// Initialize Redis
 	rdb := redis.NewClient(&redis.Options{
 		Addr: cfg.RedisAddr,
 	})
 
 	// Initialize Dependencies
-	repo := memory.New()
+	repo, err := openStore(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("open repository: %w", err)
+	}
 	jwtManager := auth.NewJWTManager(cfg.JWTSecret, time.Hour)
 
 	// L1 Cache
 	l1 := cache.NewMemoryCache()
 
 	authSvc := service.NewAuthService(repo, repo, jwtManager, l1)
+	saSvc := service.NewServiceAccountService(repo, authSvc)
+	userSvc := service.NewUserService(repo)
+	tenantSvc := service.NewTenantService(repo)
+	firstStart, err := tenantSvc.EnsureDefault(ctx)
+	if err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("create default tenant: %w", err)
+	}
+
+	// RBAC (bootstrap admins so the admin API is reachable on a fresh install)
+	authz := rbac.NewAuthorizer(repo)
+	for _, id := range cfg.BootstrapAdmins {
+		if err := bootstrapAdmin(ctx, authz, repo, userSvc, authSvc, cfg.BootstrapKeyDir, id); err != nil {
+			log.Printf("rbac: failed to bootstrap admin %s: %v", id, err)
+		}
+	}
+
+	// Rate limiting runs on Redis; while Redis is down each replica enforces its share locally
+	replicas := limiter.NewReplicas(rdb, db.NewID("replica"), 3*cfg.RateLimitHeartbeat)
+	redisLimit := limiter.NewRedisLimiter(rdb)
+	limit := limiter.NewFailover(redisLimit, replicas)
+	local := limiter.NewLocalLimiter(replicas)
+	inFlight := concurrency.New(rdb, replicas, cfg.ConcurrencyLeaseTTL)
 
-	limit := limiter.NewTokenBucketLimiter(rdb)
+	// Usage quotas count in Redis per calendar period
+	quotaSvc := service.NewQuotaService(repo, l1, quota.NewCounter(rdb))
 
-	cb := circuitbreaker.New(rdb, 3, 5, 10*time.Second)
+	// Breakers are configured per policy; this config only serves Execute
+	cb := circuitbreaker.New(rdb, replicas, circuitbreaker.Config{FailureThreshold: 5, SuccessThreshold: 1, Timeout: 30 * time.Second})
 
 	met := metrics.NewCollector(1000)
 
+	// Adaptive policies scale their limits by the last 10s of latency and errors
+	adapt := adaptive.New(met, 10*time.Second)
+
+	// Temporary per-principal limits and throttling stats for the rate limit admin API
+	ovr := overrides.New(rdb)
+	throttled := throttle.New(rdb)
+
 	auditLog := audit.NewJSONLogger(os.Stdout)
 
+	// Breaker transitions go to the audit log, metrics and, if configured, a webhook
+	var breakerHook *webhook.Sender
+	if cfg.CircuitBreakerWebhookURL != "" {
+		breakerHook = webhook.New(cfg.CircuitBreakerWebhookURL, webhookTimeout)
+	}
+	cb.OnTransition(breakerEvents(auditLog, breakerHook))
+	cb.OnStateChange(breakerGauge(met))
+
+	// Brute-force Protection
+	guard := lockout.New(rdb, lockout.Config{
+		Window:          cfg.AuthFailureWindow,
+		BackoffAfter:    cfg.AuthBackoffAfter,
+		BaseBackoff:     lockout.DefaultConfig().BaseBackoff,
+		MaxBackoff:      lockout.DefaultConfig().MaxBackoff,
+		LockoutAfter:    cfg.AuthLockoutAfter,
+		LockoutDuration: cfg.AuthLockoutDuration,
+	}, auditLog)
+
 	// Dynamic Config
 	cfgMgr := config.NewDynamicConfigManager()
 
-	// Policy Engine
+	// Policy Engine (policies live in the repository; seed defaults on first start)
 	eng := policy.NewEngine()
-	// Load Initial Policies
-	eng.LoadPolicies([]policy.Policy{
-		{
-			ID:      "admin-policy",
-			Matcher: policy.Matcher{Path: "/api/admin"},
-			Rules:   policy.Rules{AuthRequired: true, RateLimit: 10, Burst: 20},
-		},
-		{
-			ID:      "public-policy",
-			Matcher: policy.Matcher{Path: "/api/public"},
-			Rules:   policy.Rules{AuthRequired: false, RateLimit: 5, Burst: 10},
-		},
-		{
-			ID:      "health-policy",
-			Matcher: policy.Matcher{Path: "/health"},
-			Rules:   policy.Rules{AuthRequired: false, RateLimit: 100, Burst: 100},
-		},
-		{
-			ID:      "ready-policy",
-			Matcher: policy.Matcher{Path: "/ready"},
-			Rules:   policy.Rules{AuthRequired: false, RateLimit: 100, Burst: 100},
-		},
-		{
-			ID:      "test-policy",
-			Matcher: policy.Matcher{Path: "/api/test"},
-			Rules:   policy.Rules{AuthRequired: false, RateLimit: 10, Burst: 20},
-		},
-		// Default implies fallback logic in middleware if no match
-	})
+	if firstStart {
+		if err := seedPolicies(ctx, repo); err != nil {
+			repo.Close()
+			return nil, fmt.Errorf("seed policies: %w", err)
+		}
+	}
+	if err := loadPolicies(ctx, repo, eng); err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("load policies: %w", err)
+	}
 
 	return &Server{
 		cfg:            cfg,
 		router:         http.NewServeMux(),
 		authService:    authSvc,
+		authorizer:     authz,
+		svcAccounts:    saSvc,
+		users:          userSvc,
+		tenants:        tenantSvc,
+		quotas:         quotaSvc,
 		rateLimiter:    limit,
+		redisLimiter:   redisLimit,
+		localLimiter:   local,
+		concurrency:    inFlight,
+		adaptive:       adapt,
+		overrides:      ovr,
+		throttled:      throttled,
+		replicas:       replicas,
 		circuitBreaker: cb,
 		metrics:        met,
 		auditLogger:    auditLog,
+		lockoutGuard:   guard,
 		configManager:  cfgMgr,
 		policyEngine:   eng,
 		redisClient:    rdb,
+		repo:           repo,
 		l1Cache:        l1,
-	}
+	}, nil
 }
 
 func (s *Server) Start() error {
@@ -141,6 +215,34 @@ func (s *Server) Start() error {
 
 	// Admin Endpoints (Protected by /api/admin/* policy)
 	s.router.HandleFunc("/api/admin/reload", s.ReloadPolicies)
+	s.router.HandleFunc("/api/admin/policies", s.PoliciesHandler)
+	s.router.HandleFunc("/api/admin/roles", s.ListRolesHandler)
+	s.router.HandleFunc("/api/admin/roles/assign", s.AssignRoleHandler)
+	s.router.HandleFunc("/api/admin/roles/revoke", s.RevokeRoleHandler)
+	s.router.HandleFunc("/api/admin/lockouts", s.ListLockoutsHandler)
+	s.router.HandleFunc("/api/admin/lockouts/clear", s.ClearLockoutHandler)
+	s.router.HandleFunc("/api/admin/service-accounts", s.ServiceAccountsHandler)
+	s.router.HandleFunc("/api/admin/service-accounts/keys", s.CreateServiceAccountKeyHandler)
+	s.router.HandleFunc("/api/admin/tenants", s.TenantsHandler)
+	s.router.HandleFunc("/api/admin/users", s.UsersHandler)
+	s.router.HandleFunc("/api/admin/users/update", s.UpdateUserHandler)
+	s.router.HandleFunc("/api/admin/users/disable", s.DisableUserHandler)
+	s.router.HandleFunc("/api/admin/users/enable", s.EnableUserHandler)
+	s.router.HandleFunc("/api/admin/quota/plans", s.QuotaPlansHandler)
+	s.router.HandleFunc("/api/admin/quota/assign", s.AssignQuotaPlanHandler)
+	s.router.HandleFunc("/api/admin/quota/usage", s.QuotaUsageHandler)
+	s.router.HandleFunc("/api/admin/quota/reset", s.ResetQuotaHandler)
+	s.router.HandleFunc("/api/admin/ratelimit/bucket", s.RateLimitBucketHandler)
+	s.router.HandleFunc("/api/admin/ratelimit/reset", s.RateLimitResetHandler)
+	s.router.HandleFunc("/api/admin/ratelimit/throttled", s.ThrottledClientsHandler)
+	s.router.HandleFunc("/api/admin/ratelimit/overrides", s.RateLimitOverridesHandler)
+	s.router.HandleFunc("/api/admin/circuit-breakers", s.CircuitBreakersHandler)
+	s.router.HandleFunc("/api/admin/circuit-breakers/force-open", s.ForceOpenBreakerHandler)
+	s.router.HandleFunc("/api/admin/circuit-breakers/force-close", s.ForceCloseBreakerHandler)
+	s.router.HandleFunc("/api/admin/circuit-breakers/reset", s.ResetBreakerHandler)
+
+	// Token Exchange (service accounts obtain delegated user tokens)
+	s.router.HandleFunc("/api/auth/token/exchange", s.TokenExchangeHandler)
 	s.router.HandleFunc("/api/admin/keys/create", s.GenerateAPIKeyHandler)
 	s.router.HandleFunc("/api/admin/keys/rotate", s.RevokeAPIKeyHandler)
 
@@ -164,11 +266,26 @@ func (s *Server) Start() error {
 
 	// Policy Enforcer
 	policyMw := middleware.PolicyEnforcer(s.policyEngine)
-
-	authMiddleware := middleware.NewAuth(s.authService.JWTManager(), s.authService)
+	tenantPolicyMw := middleware.TenantPolicyEnforcer(s.policyEngine)
+
+	authMiddleware := middleware.NewAuth(s.authService.JWTManager(), s.authService).
+		WithLockout(s.lockoutGuard).
+		WithUserStatus(s.users)
+	if s.cfg.TLSCertFile != "" && s.cfg.TLSClientAuth != "none" {
+		var rules []auth.CertRule
+		if s.cfg.MTLSIdentityFile != "" {
+			var err error
+			if rules, err = auth.LoadCertRules(s.cfg.MTLSIdentityFile); err != nil {
+				return fmt.Errorf("load mTLS identity rules: %w", err)
+			}
+		}
+		authMiddleware.WithCertMapper(auth.NewCertMapper(rules))
+	}
 	// Pass Config Manager
-	rateLimitMiddleware := middleware.RateLimit(s.rateLimiter, s.configManager)
-	cbMiddleware := middleware.CircuitBreakerMiddleware(s.circuitBreaker, "main-service")
+	rateLimitMiddleware := middleware.RateLimit(s.rateLimiter, s.localLimiter, s.configManager, s.adaptive, s.overrides, s.throttled)
+	concurrencyMiddleware := middleware.Concurrency(s.concurrency)
+	quotaMiddleware := middleware.Quota(s.quotas, s.auditLogger)
+	breakerMiddleware := middleware.CircuitBreaker(s.circuitBreaker)
 
 	// Public Chain (Need middleware to apply Policy so RateLimit works!)
 	// Wait, /api/public is also needing RateLimit?
@@ -186,9 +303,8 @@ func (s *Server) Start() error {
 		w.Write([]byte(fmt.Sprintf("Hello, User %s!", userID)))
 	})
 
-	// Faulty Endpoint (Wrapped with Circuit Breaker + Metrics + Audit)
-	// Metrics -> Audit -> CircuitBreaker -> Handler
-	s.router.Handle("/api/unstable", cbMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// Faulty Endpoint (its policy puts it behind a circuit breaker)
+	s.router.Handle("/api/unstable", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Simulate Failure
 		if r.URL.Query().Get("fail") == "true" {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -196,26 +312,18 @@ func (s *Server) Start() error {
 			return
 		}
 		w.Write([]byte("Stable"))
-	})))
+	}))
 
-	// Helper endpoint to generate a key (FOR TESTING ONLY)
-	s.router.HandleFunc("/api/test/generate-key", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.URL.Query().Get("user_id")
-		if userID == "" {
-			userID = "test-user"
-		}
-		rawKey, err := s.authService.CreateAPIKey(r.Context(), userID, "test-key", nil)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Write([]byte(rawKey))
-	})
+	// Helper endpoint to generate a key (FOR TESTING ONLY; off unless DEV_TEST_KEYS is set)
+	if s.cfg.DevTestKeys {
+		log.Printf("server: DEV_TEST_KEYS is set, /api/test/generate-key hands out API keys without authentication")
+		s.router.HandleFunc("/api/test/generate-key", s.testKeyHandler)
+	}
 
 	// Global Chain
 	globalChain := func(h http.Handler) http.Handler {
-		// Metrics -> Audit -> Security -> Policy -> Auth -> RateLimit -> Handler
-		return metricsMw(auditMw(securityMw(policyMw(authMiddleware.Handle(rateLimitMiddleware(h))))))
+		// Metrics -> Audit -> Security -> Policy -> Auth -> TenantPolicy -> RateLimit -> Concurrency -> Quota -> CircuitBreaker -> Handler
+		return metricsMw(auditMw(securityMw(policyMw(authMiddleware.Handle(tenantPolicyMw(rateLimitMiddleware(concurrencyMiddleware(quotaMiddleware(breakerMiddleware(h))))))))))
 	}
 
 	srv := &http.Server{
@@ -223,10 +331,40 @@ func (s *Server) Start() error {
 		Handler: globalChain(s.router), // Wrap everything
 	}
 
+	// TLS Termination (optional)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	go s.replicas.Run(watchCtx, s.cfg.RateLimitHeartbeat)
+	go s.redisLimiter.RunLeases(watchCtx, 250*time.Millisecond)
+	go s.adaptive.Run(watchCtx, s.cfg.AdaptiveInterval, s.policyEngine.Policies)
+	go s.overrides.Run(watchCtx, time.Second)
+
+	if s.cfg.TLSCertFile != "" {
+		clientAuth, err := tlsconfig.ParseClientAuth(s.cfg.TLSClientAuth)
+		if err != nil {
+			return err
+		}
+		reloader, err := tlsconfig.NewReloader(s.cfg.TLSCertFile, s.cfg.TLSKeyFile, s.cfg.TLSClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tls setup: %w", err)
+		}
+		if srv.TLSConfig, err = reloader.TLSConfig(clientAuth); err != nil {
+			return fmt.Errorf("tls setup: %w", err)
+		}
+		go reloader.Watch(watchCtx, s.cfg.TLSReloadInterval)
+	}
+
 	// Channel to listen for errors coming from the listener.
 	serverErrors := make(chan error, 1)
 
 	go func() {
+		if srv.TLSConfig != nil {
+			log.Printf("Server starting on port %s (TLS, client auth: %s)", s.cfg.ServerPort, s.cfg.TLSClientAuth)
+			// Certificates come from TLSConfig.GetCertificate
+			serverErrors <- srv.ListenAndServeTLS("", "")
+			return
+		}
 		log.Printf("Server starting on port %s", s.cfg.ServerPort)
 		serverErrors <- srv.ListenAndServe()
 	}()
@@ -253,5 +391,5 @@ func (s *Server) Start() error {
 		}
 	}
 
-	return nil
+	return s.repo.Close()
 }
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/cache"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/middleware"
+	"github.com/raakeshmj/apigatewayplane/internal/policy"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/repository/memory"
+	"github.com/raakeshmj/apigatewayplane/internal/service"
+)
+
+// newTestServer returns a Server with in-memory storage, enough for the admin handlers
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	repo := memory.New()
+	l1 := cache.NewMemoryCache()
+	authSvc := service.NewAuthService(repo, repo, auth.NewJWTManager("test-secret", time.Hour), l1)
+	return &Server{
+		authService:  authSvc,
+		authorizer:   rbac.NewAuthorizer(repo),
+		svcAccounts:  service.NewServiceAccountService(repo, authSvc),
+		users:        service.NewUserService(repo),
+		auditLogger:  audit.NewJSONLogger(io.Discard),
+		repo:         repo,
+		policyEngine: policy.NewEngine(),
+	}
+}
+
+// addUser creates a user in tenant bound to roles
+func addUser(t *testing.T, s *Server, tenant, id string, roles ...rbac.Role) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.users.Create(ctx, &db.User{ID: id, Username: id, TenantID: tenant}); err != nil {
+		t.Fatalf("Create %s failed: %v", id, err)
+	}
+	for _, role := range roles {
+		subject := db.RoleSubject{SubjectType: auth.PrincipalUser, TenantID: tenant, SubjectID: id}
+		if err := s.authorizer.Assign(ctx, subject, string(role)); err != nil {
+			t.Fatalf("Assign %s to %s failed: %v", role, id, err)
+		}
+	}
+}
+
+// call serves a JSON request as the user callerID of tenant
+func call(h http.HandlerFunc, tenant, callerID, method, path, body string) *httptest.ResponseRecorder {
+	return callAs(h, &auth.Principal{ID: callerID, Type: auth.PrincipalUser, TenantID: tenant}, method, path, body)
+}
+
+// callAs serves a JSON request as principal p
+func callAs(h http.HandlerFunc, p *auth.Principal, method, path, body string) *httptest.ResponseRecorder {
+	ctx := context.WithValue(context.Background(), middleware.PrincipalContextKey, p)
+	ctx = context.WithValue(ctx, middleware.TenantContextKey, p.Tenant())
+	ctx = context.WithValue(ctx, middleware.UserContextKey, p.ID)
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(method, path, strings.NewReader(body)).WithContext(ctx))
+	return w
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/middleware"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/service"
+)
+
+// ServiceAccountsHandler lists (GET, optional ?team_id=) or creates (POST) service accounts
+func (s *Server) ServiceAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !s.authorize(w, r, rbac.PermServiceAccountRead) {
+			return
+		}
+		list, err := s.svcAccounts.List(r.Context(), r.URL.Query().Get("team_id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		visible := []*db.ServiceAccount{}
+		for _, sa := range list {
+			if sameTenant(r, sa.TenantID) {
+				visible = append(visible, sa)
+			}
+		}
+		list = visible
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case http.MethodPost:
+		if !s.authorize(w, r, rbac.PermServiceAccountManage) {
+			return
+		}
+		var sa db.ServiceAccount
+		if err := json.NewDecoder(r.Body).Decode(&sa); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		tenantID, ok := s.targetTenant(w, r, sa.TenantID)
+		if !ok || !s.requireFreeSubjectID(w, r, sa.ID) {
+			return
+		}
+		sa.TenantID = tenantID
+		if err := s.svcAccounts.Create(r.Context(), &sa); err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidServiceAccount):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, repository.ErrAlreadyExists):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		s.audit(r, audit.LogEntry{
+			Action:   "service_account_create",
+			Resource: "service_account:" + sa.ID,
+			Status:   http.StatusCreated,
+			Metadata: map[string]interface{}{"tenant_id": sa.TenantID, "team_id": sa.TeamID, "scopes": sa.Scopes},
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sa)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CreateServiceAccountKeyHandler mints a scope-restricted API key for a service account
+func (s *Server) CreateServiceAccountKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermServiceAccountManage) {
+		return
+	}
+
+	var req struct {
+		ServiceAccountID string   `json:"service_account_id"`
+		Name             string   `json:"name"`
+		Scopes           []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if sa, err := s.repo.GetServiceAccount(r.Context(), req.ServiceAccountID); err == nil {
+		if !sameTenant(r, sa.TenantID) {
+			http.Error(w, "Service account not found", http.StatusNotFound)
+			return
+		}
+		target := db.RoleSubject{SubjectType: auth.PrincipalService, TenantID: auth.TenantOrDefault(sa.TenantID), SubjectID: sa.ID}
+		if !s.requireNoEscalation(w, r, target) {
+			return
+		}
+	}
+
+	rawKey, scopes, err := s.svcAccounts.CreateKey(r.Context(), req.ServiceAccountID, req.Name, req.Scopes)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			http.Error(w, "Service account not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrScopeNotAllowed):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.audit(r, audit.LogEntry{
+		Action:   "key_create",
+		Resource: "apikey:" + req.ServiceAccountID,
+		Status:   http.StatusOK,
+		Metadata: map[string]interface{}{"service_account": req.ServiceAccountID, "key_name": req.Name, "scopes": scopes},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"api_key": rawKey, "scopes": scopes})
+}
+
+// TokenExchangeHandler lets a service account obtain a short-lived token acting on behalf of a user
+func (s *Server) TokenExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID     string   `json:"user_id"`
+		Scopes     []string `json:"scopes"`
+		TTLSeconds int      `json:"ttl_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	caller := middleware.GetPrincipal(r.Context())
+	token, scopes, ttl, err := s.svcAccounts.Exchange(r.Context(), caller, req.UserID, req.Scopes, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrExchangeNotPermitted) || errors.Is(err, service.ErrScopeNotAllowed) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	// Checked after the caller's own permission so outsiders can't probe for users.
+	// The token carries the caller's tenant, so users of other tenants are unknown here.
+	target := &auth.Principal{ID: req.UserID, Type: auth.PrincipalUser, TenantID: caller.Tenant()}
+	if err := s.users.CheckActive(r.Context(), target); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrUnknownUser) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, auth.ErrUserDisabled) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	actorID, _ := middleware.Actor(caller)
+	s.auditLogger.Log(audit.LogEntry{
+		Timestamp:  time.Now(),
+		Action:     "token_exchange",
+		ActorID:    actorID,
+		OnBehalfOf: req.UserID,
+		Resource:   "token:" + req.UserID,
+		Status:     http.StatusOK,
+		Metadata:   map[string]interface{}{"scopes": scopes, "ttl_seconds": int(ttl.Seconds())},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":      token,
+		"token_type":        "Bearer",
+		"expires_in":        int(ttl.Seconds()),
+		"scope":             scopes,
+		"issued_token_type": "urn:ietf:params:oauth:token-type:jwt",
+	})
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/repository/filestore"
+	"github.com/raakeshmj/apigatewayplane/internal/repository/memory"
+	"github.com/raakeshmj/apigatewayplane/internal/repository/sqlstore"
+)
+
+// openStore picks the repository backend from the DATABASE_URL scheme:
+// memory:// (default), file://dir, sqlite://path or postgres://...
+func openStore(ctx context.Context, databaseURL string) (repository.Store, error) {
+	scheme, rest, _ := strings.Cut(databaseURL, "://")
+	switch scheme {
+	case "", "memory":
+		return memory.New(), nil
+	case "file":
+		return filestore.Open(rest, filestore.DefaultOptions())
+	default:
+		return sqlstore.Open(ctx, databaseURL)
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/middleware"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/service"
+)
+
+// Admin operations are confined to the caller's tenant. Callers in the default
+// (operator) tenant may act on any tenant and manage tenants themselves.
+
+// callerTenant returns the caller's tenant and whether it is the operator tenant
+func callerTenant(r *http.Request) (string, bool) {
+	tenantID := middleware.GetTenant(r.Context())
+	return tenantID, tenantID == auth.DefaultTenant
+}
+
+// sameTenant reports whether the caller may act on a resource in tenantID
+func sameTenant(r *http.Request, tenantID string) bool {
+	own, operator := callerTenant(r)
+	return operator || auth.TenantOrDefault(tenantID) == own
+}
+
+// targetTenant resolves the tenant a create/list request acts on: the caller's
+// own unless an operator asks for another. Writes an error and returns false otherwise.
+func (s *Server) targetTenant(w http.ResponseWriter, r *http.Request, requested string) (string, bool) {
+	own, operator := callerTenant(r)
+	if requested == "" || requested == own {
+		return own, true
+	}
+	if !operator {
+		http.Error(w, "Forbidden: cannot act on another tenant", http.StatusForbidden)
+		return "", false
+	}
+	if _, err := s.tenants.Get(r.Context(), requested); err != nil {
+		if errors.Is(err, service.ErrUnknownTenant) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return "", false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	return requested, true
+}
+
+// requireOperator rejects callers outside the operator tenant with 403
+func requireOperator(w http.ResponseWriter, r *http.Request) bool {
+	if _, operator := callerTenant(r); !operator {
+		http.Error(w, "Forbidden: operator tenant only", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+var (
+	errAmbiguousSubject   = errors.New("a user and a service account share this ID; set subject_type")
+	errInvalidSubjectType = errors.New(`subject_type must be "user" or "service"`)
+)
+
+// resolveSubject finds the user or service account with an ID, only of
+// subjectType if one is given, as role bindings name it
+func (s *Server) resolveSubject(ctx context.Context, subjectType, id string) (db.RoleSubject, error) {
+	return resolveSubject(ctx, s.repo, subjectType, id)
+}
+
+func resolveSubject(ctx context.Context, repo repository.Store, subjectType, id string) (db.RoleSubject, error) {
+	if subjectType != "" && subjectType != auth.PrincipalUser && subjectType != auth.PrincipalService {
+		return db.RoleSubject{}, errInvalidSubjectType
+	}
+
+	var found []db.RoleSubject
+	if subjectType != auth.PrincipalService {
+		u, err := repo.Get(ctx, id)
+		if err == nil {
+			found = append(found, db.RoleSubject{SubjectType: auth.PrincipalUser, TenantID: auth.TenantOrDefault(u.TenantID), SubjectID: id})
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return db.RoleSubject{}, err
+		}
+	}
+	if subjectType != auth.PrincipalUser {
+		sa, err := repo.GetServiceAccount(ctx, id)
+		if err == nil {
+			found = append(found, db.RoleSubject{SubjectType: auth.PrincipalService, TenantID: auth.TenantOrDefault(sa.TenantID), SubjectID: id})
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return db.RoleSubject{}, err
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return db.RoleSubject{}, repository.ErrNotFound
+	case 1:
+		return found[0], nil
+	}
+	return db.RoleSubject{}, errAmbiguousSubject
+}
+
+// subjectTenant finds the tenant of a user or service account ID
+func (s *Server) subjectTenant(ctx context.Context, subjectID string) (string, error) {
+	subject, err := s.resolveSubject(ctx, "", subjectID)
+	return subject.TenantID, err
+}
+
+// subjectIDTaken reports whether a user or service account already has id.
+// IDs are unique across both, so a new subject never shares one.
+func (s *Server) subjectIDTaken(ctx context.Context, id string) (bool, error) {
+	if id == "" {
+		return false, nil // Generated
+	}
+	_, err := s.resolveSubject(ctx, "", id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if errors.Is(err, errAmbiguousSubject) {
+		return true, nil
+	}
+	return err == nil, err
+}
+
+// requireFreeSubjectID rejects a create request for an ID already in use with 409
+func (s *Server) requireFreeSubjectID(w http.ResponseWriter, r *http.Request, id string) bool {
+	taken, err := s.subjectIDTaken(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if taken {
+		http.Error(w, "ID is already used by a user or service account", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// userInTenant loads a user the caller may administer. Users of other tenants
+// are reported as not found.
+func (s *Server) userInTenant(w http.ResponseWriter, r *http.Request, id string) (*db.User, bool) {
+	u, err := s.users.Get(r.Context(), id)
+	if err == nil && !sameTenant(r, u.TenantID) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		writeUserError(w, err)
+		return nil, false
+	}
+	return u, true
+}
+
+// userSubject names a user as role bindings do
+func userSubject(u *db.User) db.RoleSubject {
+	return db.RoleSubject{SubjectType: auth.PrincipalUser, TenantID: auth.TenantOrDefault(u.TenantID), SubjectID: u.ID}
+}
+
+// subjectInTenant resolves the subject of a role binding request. Non-operator
+// callers only reach users and service accounts in their own tenant.
+func (s *Server) subjectInTenant(w http.ResponseWriter, r *http.Request, subjectType, subjectID string) (db.RoleSubject, bool) {
+	subject, err := s.resolveSubject(r.Context(), subjectType, subjectID)
+	if err == nil && !sameTenant(r, subject.TenantID) {
+		err = repository.ErrNotFound
+	}
+	switch {
+	case err == nil:
+		return subject, true
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "Subject not found", http.StatusNotFound)
+	case errors.Is(err, errInvalidSubjectType):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errAmbiguousSubject):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return db.RoleSubject{}, false
+}
+
+// TenantsHandler lists (GET) or creates (POST) tenants.
+// Non-operator callers only see their own tenant.
+func (s *Server) TenantsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !s.authorize(w, r, rbac.PermTenantRead) {
+			return
+		}
+		own, operator := callerTenant(r)
+
+		var list []*db.Tenant
+		if operator {
+			var err error
+			if list, err = s.tenants.List(r.Context()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			t, err := s.tenants.Get(r.Context(), own)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			list = []*db.Tenant{t}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case http.MethodPost:
+		if !s.authorize(w, r, rbac.PermTenantManage) || !requireOperator(w, r) {
+			return
+		}
+		var t db.Tenant
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := s.tenants.Create(r.Context(), &t); err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidTenant):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, repository.ErrAlreadyExists):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		s.audit(r, audit.LogEntry{
+			Action:   "tenant_create",
+			Resource: "tenant:" + t.ID,
+			Status:   http.StatusCreated,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(t)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
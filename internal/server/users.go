@@ -0,0 +1,256 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/raakeshmj/apigatewayplane/internal/audit"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/rbac"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/service"
+)
+
+// UsersHandler lists (GET), fetches (GET ?id=), creates (POST) and deletes (DELETE ?id=) users
+func (s *Server) UsersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("id") != "" {
+			s.GetUserHandler(w, r)
+			return
+		}
+		s.ListUsersHandler(w, r)
+	case http.MethodPost:
+		s.CreateUserHandler(w, r)
+	case http.MethodDelete:
+		s.DeleteUserHandler(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ListUsersHandler returns a page of users in the caller's tenant.
+// Query parameters: q (username/email substring), disabled (true/false), cursor, limit,
+// and for operators tenant_id (all tenants if omitted).
+func (s *Server) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, rbac.PermUserRead) {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := repository.UserFilter{Query: q.Get("q"), After: q.Get("cursor")}
+	if _, operator := callerTenant(r); !operator || q.Get("tenant_id") != "" {
+		tenantID, ok := s.targetTenant(w, r, q.Get("tenant_id"))
+		if !ok {
+			return
+		}
+		filter.TenantID = tenantID
+	}
+	if v := q.Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid disabled filter", http.StatusBadRequest)
+			return
+		}
+		filter.Disabled = &disabled
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	users, next, err := s.users.List(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []*db.User{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"users": users, "next_cursor": next})
+}
+
+func (s *Server) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, rbac.PermUserRead) {
+		return
+	}
+
+	u, ok := s.userInTenant(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+func (s *Server) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, rbac.PermUserManage) {
+		return
+	}
+
+	var req struct {
+		ID       string `json:"id"` // Optional, generated if empty
+		TenantID string `json:"tenant_id"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := s.targetTenant(w, r, req.TenantID)
+	if !ok || !s.requireFreeSubjectID(w, r, req.ID) {
+		return
+	}
+
+	u := &db.User{ID: req.ID, TenantID: tenantID, Username: req.Username, Email: req.Email}
+	if err := s.users.Create(r.Context(), u); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	s.audit(r, audit.LogEntry{
+		Action:   "user_create",
+		Resource: "user:" + u.ID,
+		Status:   http.StatusCreated,
+		Metadata: map[string]interface{}{"username": u.Username, "tenant_id": u.TenantID},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(u)
+}
+
+// UpdateUserHandler changes a user's username and/or email
+func (s *Server) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermUserManage) {
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+		service.UserUpdate
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.userInTenant(w, r, req.ID); !ok {
+		return
+	}
+
+	u, err := s.users.Update(r.Context(), req.ID, req.UserUpdate)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	s.audit(r, audit.LogEntry{
+		Action:   "user_update",
+		Resource: "user:" + u.ID,
+		Status:   http.StatusOK,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// DisableUserHandler blocks all of a user's API keys and tokens
+func (s *Server) DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, true)
+}
+
+// EnableUserHandler restores a disabled user's access
+func (s *Server) EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, false)
+}
+
+func (s *Server) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, rbac.PermUserManage) {
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.userInTenant(w, r, req.ID); !ok {
+		return
+	}
+
+	u, err := s.users.SetDisabled(r.Context(), req.ID, disabled)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	action := "user_enable"
+	if disabled {
+		action = "user_disable"
+	}
+	s.audit(r, audit.LogEntry{
+		Action:   action,
+		Resource: "user:" + u.ID,
+		Status:   http.StatusOK,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// DeleteUserHandler removes a user along with their API keys and role bindings
+func (s *Server) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, rbac.PermUserManage) {
+		return
+	}
+
+	u, ok := s.userInTenant(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+	if err := s.users.Delete(r.Context(), u); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	s.audit(r, audit.LogEntry{
+		Action:   "user_delete",
+		Resource: "user:" + u.ID,
+		Status:   http.StatusOK,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrAlreadyExists):
+		http.Error(w, "User ID or username already exists", http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidUser):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
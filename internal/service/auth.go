@@ -32,39 +32,67 @@ func (s *AuthService) JWTManager() *auth.JWTManager {
 
 // VerifyAPIKey verifies the API key and returns the UserID
 func (s *AuthService) VerifyAPIKey(ctx context.Context, rawKey string) (string, error) {
+	p, err := s.AuthenticateAPIKey(ctx, rawKey)
+	if err != nil {
+		return "", err
+	}
+	return p.ID, nil
+}
+
+// AuthenticateAPIKey verifies the API key and returns its owner as a principal
+func (s *AuthService) AuthenticateAPIKey(ctx context.Context, rawKey string) (*auth.Principal, error) {
 	hashed := auth.HashAPIKey(rawKey)
 
 	// L1 Cache Check
 	if val, found := s.cache.Get(hashed); found {
-		if userID, ok := val.(string); ok {
-			return userID, nil
+		if p, ok := val.(*auth.Principal); ok {
+			return p, nil
 		}
 	}
 
 	apiKey, err := s.apiKeyRepo.GetByHash(ctx, hashed)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if !apiKey.IsActive {
-		return "", auth.ErrInvalidToken
+		return nil, auth.ErrInvalidToken
+	}
+
+	p := &auth.Principal{
+		ID:       apiKey.UserID,
+		Type:     apiKey.OwnerType,
+		Scopes:   apiKey.Scopes,
+		Method:   auth.MethodAPIKey,
+		TenantID: apiKey.TenantID,
+		KeyID:    apiKey.ID,
+	}
+	if p.Type == "" {
+		p.Type = auth.PrincipalUser
 	}
 
 	// Set Cache
-	s.cache.Set(hashed, apiKey.UserID, 1*time.Minute)
+	s.cache.Set(hashed, p, 1*time.Minute)
+
+	return p, nil
+}
 
-	return apiKey.UserID, nil
+// CreateAPIKey generates a new key for the user; the key belongs to the user's tenant
+func (s *AuthService) CreateAPIKey(ctx context.Context, tenantID, userID, name string, scopes []string) (string, error) {
+	return s.createKey(ctx, tenantID, userID, auth.PrincipalUser, name, scopes)
 }
 
-// CreateAPIKey generates a new key for the user
-func (s *AuthService) CreateAPIKey(ctx context.Context, userID, name string, scopes []string) (string, error) {
+func (s *AuthService) createKey(ctx context.Context, tenantID, ownerID, ownerType, name string, scopes []string) (string, error) {
 	rawKey, keyHash, prefix, err := auth.GenerateAPIKey()
 	if err != nil {
 		return "", err
 	}
 
 	apiKey := &db.APIKey{
-		UserID:    userID,
+		ID:        db.NewID("key"),
+		UserID:    ownerID,
+		TenantID:  tenantID,
+		OwnerType: ownerType,
 		KeyHash:   keyHash,
 		Prefix:    prefix,
 		Name:      name,
@@ -81,12 +109,12 @@ func (s *AuthService) CreateAPIKey(ctx context.Context, userID, name string, sco
 }
 
 // RotateAPIKey invalidates old keys and creates a new one
-func (s *AuthService) RotateAPIKey(ctx context.Context, userID string) (string, error) {
+func (s *AuthService) RotateAPIKey(ctx context.Context, tenantID, userID string) (string, error) {
 	// 1. Invalidate all existing keys for this user
 	if err := s.apiKeyRepo.InvalidateAll(ctx, userID); err != nil {
 		return "", err
 	}
 
 	// 2. Create new key
-	return s.CreateAPIKey(ctx, userID, "rotated-key", nil)
+	return s.CreateAPIKey(ctx, tenantID, userID, "rotated-key", nil)
 }
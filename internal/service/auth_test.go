@@ -8,6 +8,7 @@ import (
 	"github.com/raakeshmj/apigatewayplane/internal/auth"
 	"github.com/raakeshmj/apigatewayplane/internal/cache"
 	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
 )
 
 // MockAPIKeyRepo
@@ -30,6 +31,15 @@ func (m *MockAPIKeyRepo) GetByHash(ctx context.Context, keyHash string) (*db.API
 	return nil, auth.ErrInvalidToken // Simulate not found as invalid
 }
 
+func (m *MockAPIKeyRepo) GetAPIKey(ctx context.Context, id string) (*db.APIKey, error) {
+	for _, k := range m.keys {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
 func (m *MockAPIKeyRepo) ListByUser(ctx context.Context, userID string) ([]*db.APIKey, error) {
 	var list []*db.APIKey
 	for _, k := range m.keys {
@@ -65,7 +75,7 @@ func TestAuthService_RotateAPIKey(t *testing.T) {
 	userID := "user-123"
 
 	// 1. Create initial key
-	key1, err := svc.CreateAPIKey(ctx, userID, "initial-key", nil)
+	key1, err := svc.CreateAPIKey(ctx, auth.DefaultTenant, userID, "initial-key", nil)
 	if err != nil {
 		t.Fatalf("CreateAPIKey failed: %v", err)
 	}
@@ -80,7 +90,7 @@ func TestAuthService_RotateAPIKey(t *testing.T) {
 	}
 
 	// 2. Rotate Key
-	key2, err := svc.RotateAPIKey(ctx, userID)
+	key2, err := svc.RotateAPIKey(ctx, auth.DefaultTenant, userID)
 	if err != nil {
 		t.Fatalf("RotateAPIKey failed: %v", err)
 	}
@@ -118,7 +128,7 @@ func TestAuthService_Cache(t *testing.T) {
 
 	ctx := context.Background()
 	userID := "user-cache"
-	key, err := svc.CreateAPIKey(ctx, userID, "cache-key", nil)
+	key, err := svc.CreateAPIKey(ctx, auth.DefaultTenant, userID, "cache-key", nil)
 	if err != nil {
 		t.Fatalf("CreateAPIKey failed: %v", err)
 	}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/cache"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/quota"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+var (
+	ErrInvalidPlan    = errors.New("plan requires an id, a positive limit and a period of day or month")
+	ErrUnknownPlan    = errors.New("plan does not exist")
+	ErrNoPlan         = errors.New("subject has no plan")
+	ErrInvalidSubject = errors.New("subject type must be user, key or tenant")
+)
+
+// How long plan assignments are cached per instance; other replicas see
+// changes within this TTL
+const planCacheTTL = 5 * time.Second
+
+// QuotaService manages quota plans and their assignments and counts requests against them
+type QuotaService struct {
+	repo    repository.QuotaRepository
+	cache   *cache.MemoryCache
+	counter *quota.Counter
+}
+
+func NewQuotaService(repo repository.QuotaRepository, c *cache.MemoryCache, counter *quota.Counter) *QuotaService {
+	return &QuotaService{repo: repo, cache: c, counter: counter}
+}
+
+func (s *QuotaService) ListPlans(ctx context.Context) ([]*db.QuotaPlan, error) {
+	return s.repo.ListPlans(ctx)
+}
+
+// GetPlan returns ErrUnknownPlan for missing plans
+func (s *QuotaService) GetPlan(ctx context.Context, id string) (*db.QuotaPlan, error) {
+	if val, found := s.cache.Get(planCacheKey(id)); found {
+		return val.(*db.QuotaPlan), nil
+	}
+	p, err := s.repo.GetPlan(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUnknownPlan
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(planCacheKey(id), p, planCacheTTL)
+	return p, nil
+}
+
+// SavePlan creates or replaces a plan; subjects on it get the new limit right away
+func (s *QuotaService) SavePlan(ctx context.Context, p *db.QuotaPlan) error {
+	if p.ID == "" || p.Limit <= 0 || !quota.Period(p.Period).Valid() {
+		return ErrInvalidPlan
+	}
+	if p.Name == "" {
+		p.Name = p.ID
+	}
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	if err := s.repo.SavePlan(ctx, p); err != nil {
+		return err
+	}
+	s.cache.Delete(planCacheKey(p.ID))
+	return nil
+}
+
+// Assignment returns ErrNoPlan when the subject isn't on a plan
+func (s *QuotaService) Assignment(ctx context.Context, subject quota.Subject) (*db.PlanAssignment, error) {
+	a, err := s.repo.GetPlanAssignment(ctx, subject.Type, subject.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrNoPlan
+	}
+	return a, err
+}
+
+// Assign puts subject, which belongs to tenantID, on a plan. Usage so far in
+// the current period carries over.
+func (s *QuotaService) Assign(ctx context.Context, subject quota.Subject, tenantID, planID string) (*db.PlanAssignment, error) {
+	if !validSubject(subject) {
+		return nil, ErrInvalidSubject
+	}
+	if _, err := s.GetPlan(ctx, planID); err != nil {
+		return nil, err
+	}
+	a := &db.PlanAssignment{
+		SubjectType: subject.Type,
+		SubjectID:   subject.ID,
+		TenantID:    tenantID,
+		PlanID:      planID,
+		UpdatedAt:   time.Now(),
+	}
+	if err := s.repo.SetPlanAssignment(ctx, a); err != nil {
+		return nil, err
+	}
+	s.cache.Delete(assignmentCacheKey(subject))
+	return a, nil
+}
+
+// Unassign takes subject off its plan, leaving it without a quota
+func (s *QuotaService) Unassign(ctx context.Context, subject quota.Subject) error {
+	err := s.repo.DeletePlanAssignment(ctx, subject.Type, subject.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrNoPlan
+	}
+	if err != nil {
+		return err
+	}
+	s.cache.Delete(assignmentCacheKey(subject))
+	return nil
+}
+
+// Quotas returns the quotas a request by p counts against: its API key's,
+// its user's and its tenant's, for whichever of those are on a plan.
+// Anonymous requests have no quota.
+func (s *QuotaService) Quotas(ctx context.Context, p *auth.Principal) ([]quota.Quota, error) {
+	if p == nil {
+		return nil, nil
+	}
+	var subjects []quota.Subject
+	if p.KeyID != "" {
+		subjects = append(subjects, quota.Subject{Type: quota.SubjectKey, ID: p.KeyID})
+	}
+	if p.Type == auth.PrincipalUser {
+		subjects = append(subjects, quota.Subject{Type: quota.SubjectUser, ID: p.ID})
+	}
+	subjects = append(subjects, quota.Subject{Type: quota.SubjectTenant, ID: p.Tenant()})
+
+	var list []quota.Quota
+	for _, subject := range subjects {
+		q, err := s.quotaFor(ctx, subject)
+		if errors.Is(err, ErrNoPlan) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, q)
+	}
+	return list, nil
+}
+
+// Consume counts a request against quotas (see quota.Counter.Consume)
+func (s *QuotaService) Consume(ctx context.Context, quotas []quota.Quota) ([]quota.Usage, error) {
+	return s.counter.Consume(ctx, quotas, time.Now())
+}
+
+// Usage reads a subject's usage in the current period
+func (s *QuotaService) Usage(ctx context.Context, subject quota.Subject) (quota.Usage, error) {
+	q, err := s.quotaFor(ctx, subject)
+	if err != nil {
+		return quota.Usage{}, err
+	}
+	return s.counter.Get(ctx, q, time.Now())
+}
+
+// Reset clears a subject's usage in the current period
+func (s *QuotaService) Reset(ctx context.Context, subject quota.Subject) error {
+	q, err := s.quotaFor(ctx, subject)
+	if err != nil {
+		return err
+	}
+	return s.counter.Reset(ctx, subject, q.Period, time.Now())
+}
+
+// quotaFor resolves a subject's plan, caching the assignment
+func (s *QuotaService) quotaFor(ctx context.Context, subject quota.Subject) (quota.Quota, error) {
+	var planID string
+	if val, found := s.cache.Get(assignmentCacheKey(subject)); found {
+		planID = val.(string) // Empty means no plan
+	} else {
+		a, err := s.Assignment(ctx, subject)
+		switch {
+		case err == nil:
+			planID = a.PlanID
+		case !errors.Is(err, ErrNoPlan):
+			return quota.Quota{}, err // Don't cache backend failures
+		}
+		s.cache.Set(assignmentCacheKey(subject), planID, planCacheTTL)
+	}
+	if planID == "" {
+		return quota.Quota{}, ErrNoPlan
+	}
+
+	p, err := s.GetPlan(ctx, planID)
+	if err != nil {
+		return quota.Quota{}, err
+	}
+	return quota.Quota{Subject: subject, PlanID: p.ID, Limit: p.Limit, Period: quota.Period(p.Period)}, nil
+}
+
+func validSubject(s quota.Subject) bool {
+	switch s.Type {
+	case quota.SubjectUser, quota.SubjectKey, quota.SubjectTenant:
+		return s.ID != ""
+	}
+	return false
+}
+
+func planCacheKey(id string) string {
+	return "quota-plan:" + id
+}
+
+func assignmentCacheKey(s quota.Subject) string {
+	return "quota-assignment:" + s.Type + ":" + s.ID
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+var (
+	ErrInvalidServiceAccount = errors.New("service account requires a name and team_id")
+	ErrScopeNotAllowed       = errors.New("requested scopes exceed the allowed set")
+	ErrExchangeNotPermitted  = errors.New("caller may not exchange tokens")
+)
+
+const (
+	DefaultDelegationTTL = 5 * time.Minute
+	MaxDelegationTTL     = 15 * time.Minute
+)
+
+// ServiceAccountService manages service accounts, their keys and delegated tokens
+type ServiceAccountService struct {
+	accounts repository.ServiceAccountRepository
+	authSvc  *AuthService
+}
+
+func NewServiceAccountService(accounts repository.ServiceAccountRepository, authSvc *AuthService) *ServiceAccountService {
+	return &ServiceAccountService{
+		accounts: accounts,
+		authSvc:  authSvc,
+	}
+}
+
+// Create stores a new service account, generating an ID if none is given
+func (s *ServiceAccountService) Create(ctx context.Context, sa *db.ServiceAccount) error {
+	if sa.Name == "" || sa.TeamID == "" {
+		return ErrInvalidServiceAccount
+	}
+	if sa.ID == "" {
+		sa.ID = db.NewID("sa")
+	}
+	if sa.TenantID == "" {
+		sa.TenantID = auth.DefaultTenant
+	}
+	sa.CreatedAt = time.Now()
+	sa.UpdatedAt = sa.CreatedAt
+	return s.accounts.CreateServiceAccount(ctx, sa)
+}
+
+// List returns service accounts, optionally only those owned by teamID
+func (s *ServiceAccountService) List(ctx context.Context, teamID string) ([]*db.ServiceAccount, error) {
+	return s.accounts.ListServiceAccounts(ctx, teamID)
+}
+
+// CreateKey mints an API key for the account. Scopes must be a subset of the
+// account's scopes; an empty list grants all of them.
+func (s *ServiceAccountService) CreateKey(ctx context.Context, accountID, name string, scopes []string) (string, []string, error) {
+	sa, err := s.accounts.GetServiceAccount(ctx, accountID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(scopes) == 0 {
+		scopes = sa.Scopes
+	}
+	if !subset(scopes, sa.Scopes) {
+		return "", nil, ErrScopeNotAllowed
+	}
+
+	rawKey, err := s.authSvc.createKey(ctx, sa.TenantID, sa.ID, auth.PrincipalService, name, scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	return rawKey, scopes, nil
+}
+
+// Exchange issues a short-lived token acting on behalf of userID.
+// The caller must be a service holding the token:exchange scope, and the
+// delegated scopes are limited to the caller's own.
+func (s *ServiceAccountService) Exchange(ctx context.Context, caller *auth.Principal, userID string, scopes []string, ttl time.Duration) (string, []string, time.Duration, error) {
+	if caller == nil || caller.Type != auth.PrincipalService || !caller.HasScope(auth.ScopeTokenExchange) {
+		return "", nil, 0, ErrExchangeNotPermitted
+	}
+
+	// The exchange scope itself is never delegated
+	var allowed []string
+	for _, sc := range caller.Scopes {
+		if sc != auth.ScopeTokenExchange {
+			allowed = append(allowed, sc)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	if !subset(scopes, allowed) {
+		return "", nil, 0, ErrScopeNotAllowed
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultDelegationTTL
+	}
+	if ttl > MaxDelegationTTL {
+		ttl = MaxDelegationTTL
+	}
+
+	token, err := s.authSvc.JWTManager().GenerateDelegated(userID, caller.Tenant(), caller.ID, scopes, ttl)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	return token, scopes, ttl, nil
+}
+
+func subset(requested, allowed []string) bool {
+	set := make(map[string]bool, len(allowed))
+	for _, a := range allowed {
+		set[a] = true
+	}
+	for _, r := range requested {
+		if !set[r] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/cache"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository/memory"
+)
+
+func TestServiceAccount_KeyScopes(t *testing.T) {
+	repo := memory.New()
+	authSvc := NewAuthService(repo, repo, auth.NewJWTManager("secret", time.Hour), cache.NewMemoryCache())
+	svc := NewServiceAccountService(repo, authSvc)
+	ctx := context.Background()
+
+	sa := &db.ServiceAccount{Name: "billing", TeamID: "payments", Scopes: []string{"invoices:read", auth.ScopeTokenExchange}}
+	if err := svc.Create(ctx, sa); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if _, _, err := svc.CreateKey(ctx, sa.ID, "too-broad", []string{"invoices:write"}); err != ErrScopeNotAllowed {
+		t.Errorf("Expected ErrScopeNotAllowed, got %v", err)
+	}
+
+	key, scopes, err := svc.CreateKey(ctx, sa.ID, "default", nil)
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+	if len(scopes) != 2 {
+		t.Errorf("Expected key to inherit account scopes, got %v", scopes)
+	}
+
+	p, err := authSvc.AuthenticateAPIKey(ctx, key)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey failed: %v", err)
+	}
+	if p.ID != sa.ID || p.Type != auth.PrincipalService {
+		t.Errorf("Expected service principal %s, got %+v", sa.ID, p)
+	}
+}
+
+func TestServiceAccount_Exchange(t *testing.T) {
+	repo := memory.New()
+	jwtManager := auth.NewJWTManager("secret", time.Hour)
+	svc := NewServiceAccountService(repo, NewAuthService(repo, repo, jwtManager, cache.NewMemoryCache()))
+	ctx := context.Background()
+
+	caller := &auth.Principal{ID: "svc-billing", Type: auth.PrincipalService, Scopes: []string{"invoices:read", auth.ScopeTokenExchange}}
+
+	// Users can't exchange, and the exchange scope itself is never delegated
+	user := &auth.Principal{ID: "bob", Type: auth.PrincipalUser, Scopes: caller.Scopes}
+	if _, _, _, err := svc.Exchange(ctx, user, "alice", nil, 0); err != ErrExchangeNotPermitted {
+		t.Errorf("Expected ErrExchangeNotPermitted for user caller, got %v", err)
+	}
+	if _, _, _, err := svc.Exchange(ctx, caller, "alice", []string{auth.ScopeTokenExchange}, 0); err != ErrScopeNotAllowed {
+		t.Errorf("Expected ErrScopeNotAllowed for re-delegation, got %v", err)
+	}
+
+	token, scopes, ttl, err := svc.Exchange(ctx, caller, "alice", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if ttl != MaxDelegationTTL {
+		t.Errorf("Expected ttl capped at %v, got %v", MaxDelegationTTL, ttl)
+	}
+	if len(scopes) != 1 || scopes[0] != "invoices:read" {
+		t.Errorf("Expected narrowed scopes [invoices:read], got %v", scopes)
+	}
+
+	claims, err := jwtManager.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.UserID != "alice" || claims.Actor == nil || claims.Actor.Subject != "svc-billing" {
+		t.Errorf("Expected alice acted on by svc-billing, got %+v", claims)
+	}
+}
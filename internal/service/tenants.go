@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+var (
+	ErrInvalidTenant = errors.New("tenant requires an id")
+	ErrUnknownTenant = errors.New("tenant does not exist")
+)
+
+// TenantService manages tenants
+type TenantService struct {
+	tenants repository.TenantRepository
+}
+
+func NewTenantService(tenants repository.TenantRepository) *TenantService {
+	return &TenantService{tenants: tenants}
+}
+
+// EnsureDefault creates the operator's default tenant if it doesn't exist
+// yet, reporting whether it did: only the first start of a store creates it
+func (s *TenantService) EnsureDefault(ctx context.Context) (bool, error) {
+	err := s.Create(ctx, &db.Tenant{ID: auth.DefaultTenant, Name: "Default"})
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *TenantService) Create(ctx context.Context, t *db.Tenant) error {
+	if t.ID == "" {
+		return ErrInvalidTenant
+	}
+	if t.Name == "" {
+		t.Name = t.ID
+	}
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+	return s.tenants.CreateTenant(ctx, t)
+}
+
+// Get returns ErrUnknownTenant for missing tenants
+func (s *TenantService) Get(ctx context.Context, id string) (*db.Tenant, error) {
+	t, err := s.tenants.GetTenant(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUnknownTenant
+	}
+	return t, err
+}
+
+func (s *TenantService) List(ctx context.Context) ([]*db.Tenant, error) {
+	return s.tenants.ListTenants(ctx)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+)
+
+var (
+	ErrInvalidUser = errors.New("user requires a username")
+)
+
+const (
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 500
+)
+
+// UserUpdate holds the fields to change; nil fields are left as they are
+type UserUpdate struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+}
+
+// UserService manages the user lifecycle and answers whether a user may
+// authenticate. Status is read from the repository on every check, not
+// cached, so disabling a user takes effect on every replica at once.
+type UserService struct {
+	users repository.UserRepository
+}
+
+func NewUserService(users repository.UserRepository) *UserService {
+	return &UserService{
+		users: users,
+	}
+}
+
+// Create stores a new user, generating an ID if none is given.
+// Users without a tenant join the default tenant.
+func (s *UserService) Create(ctx context.Context, u *db.User) error {
+	if u.Username == "" {
+		return ErrInvalidUser
+	}
+	if u.ID == "" {
+		u.ID = db.NewID("usr")
+	}
+	if u.TenantID == "" {
+		u.TenantID = auth.DefaultTenant
+	}
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+	return s.users.CreateUser(ctx, u)
+}
+
+func (s *UserService) Get(ctx context.Context, id string) (*db.User, error) {
+	return s.users.Get(ctx, id)
+}
+
+func (s *UserService) Update(ctx context.Context, id string, upd UserUpdate) (*db.User, error) {
+	u, err := s.users.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upd.Username != nil {
+		if *upd.Username == "" {
+			return nil, ErrInvalidUser
+		}
+		u.Username = *upd.Username
+	}
+	if upd.Email != nil {
+		u.Email = *upd.Email
+	}
+	u.UpdatedAt = time.Now()
+	if err := s.users.UpdateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SetDisabled disables or re-enables a user. A disabled user's API keys and
+// tokens are rejected, but kept, so re-enabling restores access.
+func (s *UserService) SetDisabled(ctx context.Context, id string, disabled bool) (*db.User, error) {
+	u, err := s.users.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	u.Disabled = disabled
+	u.UpdatedAt = time.Now()
+	if err := s.users.UpdateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Delete removes a user together with their API keys and role bindings
+func (s *UserService) Delete(ctx context.Context, u *db.User) error {
+	return s.users.DeleteUser(ctx, u.ID)
+}
+
+// List returns one page of users and the cursor for the next page ("" on the last page)
+func (s *UserService) List(ctx context.Context, filter repository.UserFilter) ([]*db.User, string, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultUserPageSize
+	}
+	if filter.Limit > MaxUserPageSize {
+		filter.Limit = MaxUserPageSize
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	limit := filter.Limit
+	filter.Limit++
+	users, err := s.users.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(users) > limit {
+		users = users[:limit]
+		next = users[limit-1].ID
+	}
+	return users, next, nil
+}
+
+// CheckActive returns auth.ErrUnknownUser or auth.ErrUserDisabled if p is a user principal
+// that may no longer authenticate, or that claims a tenant the user isn't in.
+// Other principal types always pass.
+func (s *UserService) CheckActive(ctx context.Context, p *auth.Principal) error {
+	if p == nil || p.Type != auth.PrincipalUser {
+		return nil
+	}
+
+	u, err := s.users.Get(ctx, p.ID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return auth.ErrUnknownUser
+	case err != nil:
+		return err
+	case auth.TenantOrDefault(u.TenantID) != p.Tenant():
+		return auth.ErrUnknownUser
+	case u.Disabled:
+		return auth.ErrUserDisabled
+	}
+	return nil
+}
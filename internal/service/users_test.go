@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/raakeshmj/apigatewayplane/internal/auth"
+	"github.com/raakeshmj/apigatewayplane/internal/db"
+	"github.com/raakeshmj/apigatewayplane/internal/repository"
+	"github.com/raakeshmj/apigatewayplane/internal/repository/memory"
+)
+
+func TestUserService_CheckActive(t *testing.T) {
+	ctx := context.Background()
+	svc := NewUserService(memory.New())
+
+	u := &db.User{Username: "alice"}
+	if err := svc.Create(ctx, u); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	p := &auth.Principal{ID: u.ID, Type: auth.PrincipalUser, Method: auth.MethodAPIKey}
+
+	if err := svc.CheckActive(ctx, p); err != nil {
+		t.Fatalf("Expected active user, got %v", err)
+	}
+
+	// Disabling takes effect at once
+	if _, err := svc.SetDisabled(ctx, u.ID, true); err != nil {
+		t.Fatalf("SetDisabled failed: %v", err)
+	}
+	if err := svc.CheckActive(ctx, p); err != auth.ErrUserDisabled {
+		t.Errorf("Expected ErrUserDisabled, got %v", err)
+	}
+
+	if err := svc.Delete(ctx, u); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := svc.CheckActive(ctx, p); err != auth.ErrUnknownUser {
+		t.Errorf("Expected ErrUnknownUser, got %v", err)
+	}
+
+	// Service principals aren't users
+	if err := svc.CheckActive(ctx, &auth.Principal{ID: "sa_1", Type: auth.PrincipalService}); err != nil {
+		t.Errorf("Expected service principal to pass, got %v", err)
+	}
+}
+
+func TestUserService_ListPagination(t *testing.T) {
+	ctx := context.Background()
+	svc := NewUserService(memory.New())
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		if err := svc.Create(ctx, &db.User{ID: id, Username: "user-" + id}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	var seen []string
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		users, next, err := svc.List(ctx, repository.UserFilter{After: cursor, Limit: 2})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for _, u := range users {
+			seen = append(seen, u.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(seen) != 5 || seen[0] != "a" || seen[4] != "e" {
+		t.Errorf("Expected a..e across pages, got %v", seen)
+	}
+}
+
+func TestUserService_RejectedRenameLeavesUserUnchanged(t *testing.T) {
+	ctx := context.Background()
+	svc := NewUserService(memory.New())
+	alice, bob := &db.User{Username: "alice"}, &db.User{Username: "bob"}
+	for _, u := range []*db.User{alice, bob} {
+		if err := svc.Create(ctx, u); err != nil {
+			t.Fatalf("Create %s failed: %v", u.Username, err)
+		}
+	}
+
+	taken := "alice"
+	if _, err := svc.Update(ctx, bob.ID, UserUpdate{Username: &taken}); !errors.Is(err, repository.ErrAlreadyExists) {
+		t.Fatalf("Expected ErrAlreadyExists, got %v", err)
+	}
+	if u, err := svc.Get(ctx, bob.ID); err != nil || u.Username != "bob" || !u.UpdatedAt.Equal(bob.UpdatedAt) {
+		t.Errorf("Expected bob unchanged, got %+v (%v)", u, err)
+	}
+}
@@ -0,0 +1,90 @@
+package throttle
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Denials are counted in one sorted set per minute, kept for Retention
+const (
+	slot      = time.Minute
+	Retention = time.Hour
+)
+
+// Client is a bucket and how often it throttled requests
+type Client struct {
+	Key       string `json:"key"`
+	Throttled int64  `json:"throttled"`
+}
+
+// Tracker counts rate limited requests per bucket key in Redis, so the
+// denials of every replica add up
+type Tracker struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+func New(client *redis.Client) *Tracker {
+	return &Tracker{client: client, now: time.Now}
+}
+
+// Record counts one throttled request against key
+func (t *Tracker) Record(ctx context.Context, key string) error {
+	k := slotKey(t.now())
+	pipe := t.client.Pipeline()
+	pipe.ZIncrBy(ctx, k, 1, key)
+	pipe.Expire(ctx, k, Retention+slot)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Top returns the n keys starting with prefix that throttled the most
+// requests in the last window, most throttled first. The window is rounded
+// up to whole minutes and capped at Retention.
+func (t *Tracker) Top(ctx context.Context, window time.Duration, n int, prefix string) ([]Client, error) {
+	window = min(max(window, slot), Retention)
+	slots := int((window + slot - 1) / slot)
+
+	now := t.now()
+	pipe := t.client.Pipeline()
+	cmds := make([]*redis.ZSliceCmd, slots)
+	for i := range cmds {
+		cmds[i] = pipe.ZRangeWithScores(ctx, slotKey(now.Add(-time.Duration(i)*slot)), 0, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	for _, cmd := range cmds {
+		for _, z := range cmd.Val() {
+			if key, _ := z.Member.(string); strings.HasPrefix(key, prefix) {
+				counts[key] += int64(z.Score)
+			}
+		}
+	}
+
+	top := make([]Client, 0, len(counts))
+	for key, c := range counts {
+		top = append(top, Client{Key: key, Throttled: c})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Throttled != top[j].Throttled {
+			return top[i].Throttled > top[j].Throttled
+		}
+		return top[i].Key < top[j].Key
+	})
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top, nil
+}
+
+func slotKey(t time.Time) string {
+	return "ratelimit:throttled:" + strconv.FormatInt(t.Unix()/int64(slot/time.Second), 10)
+}
@@ -0,0 +1,53 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTracker_Top(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	now := time.Unix(1_700_000_000, 0)
+	tr := New(rdb)
+	tr.now = func() time.Time { return now }
+
+	record := func(key string, n int) {
+		for i := 0; i < n; i++ {
+			if err := tr.Record(ctx, key); err != nil {
+				t.Fatalf("record: %v", err)
+			}
+		}
+	}
+
+	// An old burst from a, then recent ones from everyone
+	record("ratelimit:tenant:acme:user:a", 5)
+	now = now.Add(10 * time.Minute)
+	record("ratelimit:tenant:acme:user:a", 1)
+	record("ratelimit:tenant:acme:user:b", 3)
+	record("ratelimit:tenant:other:user:c", 9)
+
+	top, err := tr.Top(ctx, 5*time.Minute, 10, "ratelimit:tenant:acme:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Key != "ratelimit:tenant:acme:user:b" || top[0].Throttled != 3 || top[1].Throttled != 1 {
+		t.Fatalf("Expected b (3) then a (1), got %+v", top)
+	}
+
+	// A longer window includes a's old burst
+	top, err = tr.Top(ctx, 15*time.Minute, 1, "ratelimit:tenant:acme:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 1 || top[0].Key != "ratelimit:tenant:acme:user:a" || top[0].Throttled != 6 {
+		t.Fatalf("Expected a (6), got %+v", top)
+	}
+}
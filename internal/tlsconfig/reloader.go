@@ -0,0 +1,184 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoCertificates = errors.New("no certificates found in CA bundle")
+	ErrMissingCA      = errors.New("client certificate verification requires a CA bundle")
+)
+
+// ParseClientAuth maps the TLS_CLIENT_AUTH setting to a tls.ClientAuthType
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", mode)
+	}
+}
+
+// Reloader serves the server certificate and client CA pool from disk.
+// Files are re-read when their modification time changes, so rotated
+// certificates are picked up without a restart.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	certMod time.Time
+	caMod   time.Time
+}
+
+// NewReloader loads the initial key pair (and CA bundle, if caFile is set)
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Watch polls the files every interval until ctx is cancelled.
+// A failed reload keeps serving the previous material.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.reload(); err != nil {
+				log.Printf("tls: reload failed, keeping previous certificates: %v", err)
+			}
+		}
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// ClientCAs returns the current client CA pool (nil if none configured)
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// TLSConfig builds a server config that always uses the latest certificate and CA pool
+func (r *Reloader) TLSConfig(clientAuth tls.ClientAuthType) (*tls.Config, error) {
+	if clientAuth != tls.NoClientCert && r.caFile == "" {
+		return nil, ErrMissingCA
+	}
+
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+		ClientAuth:     clientAuth,
+	}
+
+	// Resolve the CA pool per handshake so a reloaded bundle applies to new connections
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = r.ClientCAs()
+		return cfg, nil
+	}
+
+	return base, nil
+}
+
+func (r *Reloader) reload() error {
+	certMod, err := modTime(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var caMod time.Time
+	if r.caFile != "" {
+		if caMod, err = modTime(r.caFile); err != nil {
+			return err
+		}
+	}
+
+	r.mu.RLock()
+	certChanged := r.cert == nil || !certMod.Equal(r.certMod)
+	caChanged := r.caFile != "" && (r.pool == nil || !caMod.Equal(r.caMod))
+	r.mu.RUnlock()
+
+	if !certChanged && !caChanged {
+		return nil
+	}
+
+	var cert *tls.Certificate
+	if certChanged {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("load key pair: %w", err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if caChanged {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return ErrNoCertificates
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cert != nil {
+		r.cert = cert
+		r.certMod = certMod
+		log.Printf("tls: loaded certificate from %s", r.certFile)
+	}
+	if pool != nil {
+		r.pool = pool
+		r.caMod = caMod
+		log.Printf("tls: loaded client CA bundle from %s", r.caFile)
+	}
+	return nil
+}
+
+// modTime returns the latest modification time across the given files
+func modTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Sender posts JSON events to a URL in the background, so callers never wait
+// on the receiver. Failed deliveries are logged and dropped.
+type Sender struct {
+	url     string
+	client  *http.Client
+	timeout time.Duration
+}
+
+func New(url string, timeout time.Duration) *Sender {
+	return &Sender{url: url, client: &http.Client{}, timeout: timeout}
+}
+
+// Send posts event as JSON without blocking
+func (s *Sender) Send(event interface{}) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("webhook: failed to encode event: %v", err)
+		return
+	}
+	go func() {
+		if err := s.post(body); err != nil {
+			log.Printf("webhook: delivery to %s failed: %v", s.url, err)
+		}
+	}()
+}
+
+func (s *Sender) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return nil
+}